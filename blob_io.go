@@ -0,0 +1,214 @@
+package iceberg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	iceio "github.com/apache/iceberg-go/io"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/azureblob"
+	"gocloud.dev/blob/gcsblob"
+	"gocloud.dev/gcp"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+// Properties of the ADLS FileIO, named as in the Java implementation of Iceberg.
+// Per-account properties end with the account host, such as "account.dfs.core.windows.net", or the account name.
+const (
+	adlsSASTokenPrefix         = "adls.sas-token."
+	adlsConnectionStringPrefix = "adls.connection-string."
+	adlsSharedKeyAccountName   = "adls.auth.shared-key.account.name"
+	adlsSharedKeyAccountKey    = "adls.auth.shared-key.account.key"
+)
+
+// azureSchemes are the schemes of ADLS and Blob Storage locations, "<scheme>://<container>@<account host>/<path>".
+var azureSchemes = []string{"abfs", "abfss", "wasb", "wasbs"}
+
+var (
+	_ iceio.WriteFileIO = (*blobIO)(nil)
+	_ objectBucket      = (*blobIO)(nil)
+)
+
+// loadFS is iceio.LoadFS with the object storages iceberg-go lacks: ADLS and Blob Storage,
+// and GCS with credentials from "gcs.keypath" or "gcs.jsonkey", which iceberg-go accesses anonymously.
+func loadFS(ctx context.Context, props map[string]string, location string) (iceio.IO, error) {
+	if location == "" {
+		location = props["warehouse"]
+	}
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid location: %w", err)
+	}
+	var bucket *blob.Bucket
+	switch {
+	case slices.Contains(azureSchemes, parsed.Scheme):
+		bucket, err = openAzureBucket(ctx, parsed, props)
+	case parsed.Scheme == "gs" && (props[iceio.GCSKeyPath] != "" || props[iceio.GCSJSONKey] != ""):
+		bucket, err = openGCSBucket(ctx, parsed, props)
+	default:
+		return iceio.LoadFS(ctx, props, location)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &blobIO{Bucket: bucket, ctx: context.WithoutCancel(ctx)}, nil
+}
+
+func openAzureBucket(ctx context.Context, parsed *url.URL, props map[string]string) (*blob.Bucket, error) {
+	containerName := parsed.User.Username()
+	if containerName == "" || parsed.Host == "" {
+		return nil, xerrors.Errorf("location %s has no container@account", parsed.Redacted())
+	}
+	accountName, _, _ := strings.Cut(parsed.Host, ".")
+	accountProp := func(prefix string) string {
+		if value := props[prefix+parsed.Host]; value != "" {
+			return value
+		}
+		return props[prefix+accountName]
+	}
+
+	serviceURL := accountProp(adlsConnectionStringPrefix)
+	if serviceURL == "" {
+		serviceURL = "https://" + strings.Replace(parsed.Host, ".dfs.", ".blob.", 1)
+	}
+	containerURL, err := url.JoinPath(serviceURL, containerName)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid ADLS endpoint %q: %w", serviceURL, err)
+	}
+
+	var client *container.Client
+	if sas := accountProp(adlsSASTokenPrefix); sas != "" {
+		client, err = container.NewClientWithNoCredential(containerURL+"?"+strings.TrimPrefix(sas, "?"), nil)
+	} else if key := props[adlsSharedKeyAccountKey]; key != "" {
+		name := props[adlsSharedKeyAccountName]
+		if name == "" {
+			name = accountName
+		}
+		var cred *container.SharedKeyCredential
+		if cred, err = container.NewSharedKeyCredential(name, key); err == nil {
+			client, err = container.NewClientWithSharedKeyCredential(containerURL, cred, nil)
+		}
+	} else {
+		var cred *azidentity.DefaultAzureCredential
+		if cred, err = azidentity.NewDefaultAzureCredential(nil); err == nil {
+			client, err = container.NewClient(containerURL, cred, nil)
+		}
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init ADLS client of %s: %w", containerURL, err)
+	}
+	bucket, err := azureblob.OpenBucket(ctx, client, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to open container %s: %w", containerURL, err)
+	}
+	return bucket, nil
+}
+
+func openGCSBucket(ctx context.Context, parsed *url.URL, props map[string]string) (*blob.Bucket, error) {
+	key := []byte(props[iceio.GCSJSONKey])
+	if len(key) == 0 {
+		var err error
+		if key, err = os.ReadFile(props[iceio.GCSKeyPath]); err != nil {
+			return nil, xerrors.Errorf("read GCS key: %w", err)
+		}
+	}
+	creds, err := google.CredentialsFromJSON(ctx, key, storage.ScopeReadWrite)
+	if err != nil {
+		return nil, xerrors.Errorf("parse GCS key: %w", err)
+	}
+	client, err := gcp.NewHTTPClient(gcp.DefaultTransport(), creds.TokenSource)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init GCS client: %w", err)
+	}
+	opts := &gcsblob.Options{}
+	if endpoint := props[iceio.GCSEndpoint]; endpoint != "" {
+		opts.ClientOptions = append(opts.ClientOptions, option.WithEndpoint(endpoint))
+	}
+	bucket, err := gcsblob.OpenBucket(ctx, client, parsed.Host, opts)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to open bucket %s: %w", parsed.Host, err)
+	}
+	return bucket, nil
+}
+
+// blobIO is the FileIO of a bucket, names are full locations whose path is the key in the bucket.
+// Unlike the one of iceberg-go it accepts locations with user info, like the container of ADLS ones.
+type blobIO struct {
+	*blob.Bucket
+	ctx context.Context
+}
+
+func blobKey(name string) string {
+	if _, rest, ok := strings.Cut(name, "://"); ok {
+		_, key, _ := strings.Cut(rest, "/")
+		return key
+	}
+	return strings.TrimPrefix(name, "/")
+}
+
+func (b *blobIO) Open(name string) (iceio.File, error) {
+	key := blobKey(name)
+	if !fs.ValidPath(key) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	r, err := b.NewReader(b.ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &blobFile{Reader: r, bucket: b, key: key}, nil
+}
+
+func (b *blobIO) Remove(name string) error {
+	return b.Delete(b.ctx, blobKey(name))
+}
+
+func (b *blobIO) Create(name string) (iceio.FileWriter, error) {
+	key := blobKey(name)
+	if !fs.ValidPath(key) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	return b.NewWriter(b.ctx, key, nil)
+}
+
+func (b *blobIO) WriteFile(name string, content []byte) error {
+	return b.WriteAll(b.ctx, blobKey(name), content, nil)
+}
+
+// blobFile is an open blob, it reads ranges of the blob for ReadAt as Parquet readers need.
+type blobFile struct {
+	*blob.Reader
+	bucket *blobIO
+	key    string
+}
+
+func (f *blobFile) ReadAt(p []byte, off int64) (int, error) {
+	r, err := f.bucket.NewRangeReader(f.bucket.ctx, f.key, off, int64(len(p)), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	n, err := io.ReadFull(r, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *blobFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *blobFile) Name() string               { return path.Base(f.key) }
+func (f *blobFile) Mode() fs.FileMode          { return fs.ModeIrregular }
+func (f *blobFile) IsDir() bool                { return false }
+func (f *blobFile) Sys() any                   { return nil }
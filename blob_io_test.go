@@ -0,0 +1,94 @@
+package iceberg
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	iceio "github.com/apache/iceberg-go/io"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+)
+
+func TestBlobIO(t *testing.T) {
+	ctx := context.Background()
+	fileIO := &blobIO{Bucket: memblob.OpenBucket(nil), ctx: ctx}
+	location := "abfss://data@account.dfs.core.windows.net/db/events/data/file.parquet"
+
+	require.NoError(t, fileIO.WriteFile(location, []byte("0123456789")))
+	exists, err := fileIO.Exists(ctx, "db/events/data/file.parquet")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	f, err := fileIO.Open(location)
+	require.NoError(t, err)
+	defer f.Close()
+	info, err := f.Stat()
+	require.NoError(t, err)
+	require.Equal(t, "file.parquet", info.Name())
+	require.EqualValues(t, 10, info.Size())
+	p := make([]byte, 4)
+	n, err := f.ReadAt(p, 3)
+	require.NoError(t, err)
+	require.Equal(t, "3456", string(p[:n]))
+	n, err = f.ReadAt(p, 8)
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, "89", string(p[:n]))
+
+	// the warehouse of the hadoop catalog keeps the container in its root
+	wfs, err := newWarehouseFS(fileIO, "abfss://data@account.dfs.core.windows.net/warehouse")
+	require.NoError(t, err)
+	data, err := wfs.read(ctx, location)
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", string(data))
+
+	require.NoError(t, fileIO.Remove(location))
+	_, err = fileIO.Open(location)
+	require.Error(t, err)
+}
+
+func TestADLSFileIO(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	write := func(props map[string]string) *http.Request {
+		requests = nil
+		fileIO, err := loadFS(ctx, props, "abfss://data@account.dfs.core.windows.net/warehouse")
+		require.NoError(t, err)
+		require.NoError(t, fileIO.(iceio.WriteFileIO).WriteFile("abfss://data@account.dfs.core.windows.net/warehouse/file", []byte("data")))
+		require.NotEmpty(t, requests)
+		require.True(t, strings.HasPrefix(requests[0].URL.Path, "/account/data/warehouse/file"), requests[0].URL.Path)
+		return requests[0]
+	}
+
+	// a SAS token of the account host
+	r := write(map[string]string{
+		adlsConnectionStringPrefix + "account":              srv.URL + "/account",
+		adlsSASTokenPrefix + "account.dfs.core.windows.net": "?sv=2022-11-02&sig=signature",
+	})
+	require.Equal(t, "signature", r.URL.Query().Get("sig"))
+	require.Empty(t, r.Header.Get("Authorization"))
+
+	// a shared key of the account
+	r = write(map[string]string{
+		adlsConnectionStringPrefix + "account.dfs.core.windows.net": srv.URL + "/account",
+		adlsSharedKeyAccountName:                                    "account",
+		adlsSharedKeyAccountKey:                                     azuriteKey,
+	})
+	require.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey account:"), r.Header.Get("Authorization"))
+
+	_, err := loadFS(ctx, nil, "abfss://account.dfs.core.windows.net/warehouse")
+	require.ErrorContains(t, err, "has no container")
+}
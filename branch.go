@@ -0,0 +1,218 @@
+package iceberg
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/table"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+	"github.com/transferia/transferia/pkg/abstract"
+	"github.com/transferia/transferia/pkg/abstract/coordinator"
+)
+
+// expandRefName substitutes {transfer_id} and {date} in branch and tag templates.
+func expandRefName(template, transferID string, now time.Time) string {
+	return strings.NewReplacer(
+		"{transfer_id}", transferID,
+		"{date}", now.UTC().Format("20060102"),
+	).Replace(template)
+}
+
+// refNamesKey is the coordinator key of the references a transfer with {date} templates commits to
+const refNamesKey = "ref_names"
+
+// refNames are the branch and the Nessie reference commits of a transfer go to.
+type refNames struct {
+	Branch    string `json:"branch"`
+	NessieRef string `json:"nessie_ref"`
+}
+
+// resolveRefNames expands Branch and NessieRef of cfg once per snapshot load: {date} templates are
+// expanded by the first sink of the load and kept in the coordinator, so workers and sinks started
+// on the next day still commit to the same references. SinkSnapshot.Commit forgets them at the end of the load.
+func resolveRefNames(cfg *Destination, cp coordinator.Coordinator, transferID string) (*refNames, error) {
+	refs := cfg.refNames(transferID, time.Now())
+	if !hasDateTemplate(cfg) {
+		return refs, nil
+	}
+	state, err := cp.GetTransferState(transferID)
+	if err != nil {
+		return nil, xerrors.Errorf("get transfer state: %w", err)
+	}
+	if v, ok := state[refNamesKey]; ok {
+		var stored refNames
+		if err := decodeState(v.Generic, &stored); err != nil {
+			return nil, xerrors.Errorf("read state %s: %w", refNamesKey, err)
+		}
+		return &stored, nil
+	}
+	if err := cp.SetTransferState(transferID, map[string]*coordinator.TransferStateData{
+		refNamesKey: {Generic: refs},
+	}); err != nil {
+		return nil, xerrors.Errorf("set transfer state: %w", err)
+	}
+	return refs, nil
+}
+
+func hasDateTemplate(cfg *Destination) bool {
+	return strings.Contains(cfg.Branch, "{date}") || strings.Contains(cfg.NessieRef, "{date}")
+}
+
+// tagSnapshot points tag to a snapshot, an existing tag with the same name is moved.
+// Non-positive maxRefAge keeps the tag forever.
+func tagSnapshot(ctx context.Context, cat catalog.Catalog, tbl *table.Table, tag string, snapshotID int64, maxRefAge time.Duration) (*table.Table, error) {
+	meta := tbl.Metadata()
+	var refID *int64
+	for name, ref := range meta.Refs() {
+		if name != tag {
+			continue
+		}
+		if ref.SnapshotRefType != table.TagRef {
+			return nil, xerrors.Errorf("ref %s exists and is not a tag", tag)
+		}
+		refID = &ref.SnapshotID
+	}
+
+	newMeta, newLoc, err := cat.CommitTable(ctx, tbl, []table.Requirement{
+		table.AssertTableUUID(meta.TableUUID()),
+		table.AssertRefSnapshotID(tag, refID),
+	}, []table.Update{
+		table.NewSetSnapshotRefUpdate(tag, snapshotID, table.TagRef, maxRefAge.Milliseconds(), -1, -1),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("commit tag %s: %w", tag, err)
+	}
+	return table.New(tbl.Identifier(), newMeta, newLoc, tbl.FS(), cat), nil
+}
+
+// fastForward moves main to the head of branch, main must be an ancestor of that head.
+func fastForward(ctx context.Context, cat catalog.Catalog, tbl *table.Table, branch string) (*table.Table, error) {
+	meta := tbl.Metadata()
+	head := branchHead(meta, branch)
+	if head == nil {
+		return nil, xerrors.Errorf("branch %s does not exist", branch)
+	}
+
+	var mainID *int64
+	if current := tbl.CurrentSnapshot(); current != nil {
+		if current.SnapshotID == head.SnapshotID {
+			return tbl, nil
+		}
+		if !isAncestor(meta, head, current.SnapshotID) {
+			return nil, xerrors.Errorf("unable to fast-forward %s to %s: branches have diverged", table.MainBranch, branch)
+		}
+		mainID = &current.SnapshotID
+	}
+
+	newMeta, newLoc, err := cat.CommitTable(ctx, tbl, []table.Requirement{
+		table.AssertTableUUID(meta.TableUUID()),
+		table.AssertRefSnapshotID(table.MainBranch, mainID),
+	}, []table.Update{
+		table.NewSetSnapshotRefUpdate(table.MainBranch, head.SnapshotID, table.BranchRef, -1, -1, -1),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("commit %s ref: %w", table.MainBranch, err)
+	}
+	return table.New(tbl.Identifier(), newMeta, newLoc, tbl.FS(), cat), nil
+}
+
+// resetBranch points branch at the current snapshot of main, so a load builds on the published data
+// and not on what a previous load left on the branch. Without a main snapshot the branch is emptied.
+func resetBranch(ctx context.Context, cat catalog.Catalog, tbl *table.Table, branch string, snapshotProps iceberg.Properties) (*table.Table, error) {
+	meta := tbl.Metadata()
+	head := branchHead(meta, branch)
+	if branch == table.MainBranch || head == nil {
+		// a missing branch is forked from main by the first commit
+		return tbl, nil
+	}
+	current := tbl.CurrentSnapshot()
+	if current == nil {
+		return newSnapshotUpdate(cat, tbl, snapshotProps).toBranch(branch).overwriteAll().commit(ctx)
+	}
+	if current.SnapshotID == head.SnapshotID {
+		return tbl, nil
+	}
+
+	newMeta, newLoc, err := cat.CommitTable(ctx, tbl, []table.Requirement{
+		table.AssertTableUUID(meta.TableUUID()),
+		table.AssertRefSnapshotID(branch, &head.SnapshotID),
+	}, []table.Update{
+		table.NewSetSnapshotRefUpdate(branch, current.SnapshotID, table.BranchRef, -1, -1, -1),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("commit %s ref: %w", branch, err)
+	}
+	return table.New(tbl.Identifier(), newMeta, newLoc, tbl.FS(), cat), nil
+}
+
+func isAncestor(meta table.Metadata, snapshot *table.Snapshot, ancestorID int64) bool {
+	for snapshot != nil {
+		if snapshot.SnapshotID == ancestorID {
+			return true
+		}
+		if snapshot.ParentSnapshotID == nil {
+			return false
+		}
+		snapshot = meta.SnapshotByID(*snapshot.ParentSnapshotID)
+	}
+	return false
+}
+
+// snapshotRowCount sums record counts of data files visible in a snapshot.
+func snapshotRowCount(ctx context.Context, tbl *table.Table, snapshotID int64) (uint64, error) {
+	files, err := tbl.Scan(table.WithSnapshotID(snapshotID)).PlanFiles(ctx)
+	if err != nil {
+		return 0, xerrors.Errorf("unable to plan files to read: %w", err)
+	}
+	totalCount := uint64(0)
+	for _, file := range files {
+		totalCount = totalCount + uint64(file.File.Count())
+	}
+	return totalCount, nil
+}
+
+// hasNullKeys reports whether any primary key column has a null in a snapshot.
+// File stats prune most of the files, the rest is scanned up to the first match.
+func hasNullKeys(ctx context.Context, tbl *table.Table, snapshotID int64, schema *abstract.TableSchema) (bool, error) {
+	var predicates []iceberg.BooleanExpression
+	for _, col := range schema.Columns() {
+		if !col.PrimaryKey {
+			continue
+		}
+		if _, ok := tbl.Schema().FindFieldByName(col.ColumnName); !ok {
+			continue
+		}
+		predicates = append(predicates, iceberg.IsNull(iceberg.Reference(col.ColumnName)))
+	}
+	var filter iceberg.BooleanExpression
+	switch len(predicates) {
+	case 0:
+		return false, nil
+	case 1:
+		filter = predicates[0]
+	default:
+		filter = iceberg.NewOr(predicates[0], predicates[1], predicates[2:]...)
+	}
+
+	_, records, err := tbl.Scan(
+		table.WithSnapshotID(snapshotID),
+		table.WithRowFilter(filter),
+		table.WithLimit(1),
+	).ToArrowRecords(ctx)
+	if err != nil {
+		return false, xerrors.Errorf("unable to scan for null keys: %w", err)
+	}
+	for record, err := range records {
+		if err != nil {
+			return false, xerrors.Errorf("unable to read record: %w", err)
+		}
+		if record.NumRows() > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,282 @@
+package iceberg
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+
+	"github.com/transferia/iceberg/logger"
+	"github.com/transferia/transferia/library/go/core/metrics/solomon"
+	"github.com/transferia/transferia/pkg/abstract"
+	"github.com/transferia/transferia/pkg/abstract/coordinator"
+	"github.com/transferia/transferia/pkg/abstract/model"
+)
+
+// usersTable loads public.users written to dst by writeUsers.
+func usersTable(t *testing.T, dst *Destination) (catalog.Catalog, *table.Table) {
+	cat, err := newCatalog(context.Background(), dst.CatalogType, dst.CatalogURI, dst.catalogProperties(dst.refNames("local", time.Now())))
+	require.NoError(t, err)
+	t.Cleanup(func() { closeCatalog(cat) })
+	tbl, err := cat.LoadTable(context.Background(), table.Identifier{"public", "users"}, dst.Properties)
+	require.NoError(t, err)
+	return cat, tbl
+}
+
+// setBranch points branch at a snapshot, creating it if needed.
+func setBranch(t *testing.T, cat catalog.Catalog, tbl *table.Table, branch string, snapshotID int64) *table.Table {
+	meta, loc, err := cat.CommitTable(context.Background(), tbl, nil, []table.Update{
+		table.NewSetSnapshotRefUpdate(branch, snapshotID, table.BranchRef, -1, -1, -1),
+	})
+	require.NoError(t, err)
+	return table.New(tbl.Identifier(), meta, loc, tbl.FS(), cat)
+}
+
+func TestFastForward(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	writeUsers(t, dst, 0, 1, 2)
+	writeUsers(t, dst, 2, 1, 2)
+	cat, tbl := usersTable(t, dst)
+
+	second := tbl.CurrentSnapshot()
+	require.NotNil(t, second.ParentSnapshotID)
+	first := tbl.Metadata().SnapshotByID(*second.ParentSnapshotID)
+	require.True(t, isAncestor(tbl.Metadata(), second, first.SnapshotID))
+	require.True(t, isAncestor(tbl.Metadata(), second, second.SnapshotID))
+	require.False(t, isAncestor(tbl.Metadata(), first, second.SnapshotID))
+	require.False(t, isAncestor(tbl.Metadata(), second, 42))
+
+	_, err := fastForward(ctx, cat, tbl, "missing")
+	require.ErrorContains(t, err, "does not exist")
+
+	// the first commit to a branch forks it from main
+	tbl, err = newSnapshotUpdate(cat, tbl, nil).toBranch("audit").overwriteAll().commit(ctx)
+	require.NoError(t, err)
+	head := branchHead(tbl.Metadata(), "audit")
+	require.Equal(t, second.SnapshotID, *head.ParentSnapshotID)
+	require.Equal(t, second.SnapshotID, tbl.CurrentSnapshot().SnapshotID)
+
+	tbl, err = fastForward(ctx, cat, tbl, "audit")
+	require.NoError(t, err)
+	require.Equal(t, head.SnapshotID, tbl.CurrentSnapshot().SnapshotID)
+	same, err := fastForward(ctx, cat, tbl, "audit")
+	require.NoError(t, err)
+	require.Equal(t, tbl.MetadataLocation(), same.MetadataLocation())
+
+	// a branch main has moved past is not an ancestor of main
+	tbl = setBranch(t, cat, tbl, "stale", first.SnapshotID)
+	_, err = fastForward(ctx, cat, tbl, "stale")
+	require.ErrorContains(t, err, "diverged")
+	require.Equal(t, head.SnapshotID, tbl.CurrentSnapshot().SnapshotID)
+}
+
+func TestResetBranch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("to main", func(t *testing.T) {
+		dst := localDestination(t)
+		writeUsers(t, dst, 0, 1, 2)
+		writeUsers(t, dst, 2, 1, 2)
+		cat, tbl := usersTable(t, dst)
+		current := tbl.CurrentSnapshot()
+
+		tbl = setBranch(t, cat, tbl, "audit", *current.ParentSnapshotID)
+		tbl, err := newSnapshotUpdate(cat, tbl, nil).toBranch("audit").overwriteAll().commit(ctx)
+		require.NoError(t, err)
+
+		tbl, err = resetBranch(ctx, cat, tbl, "audit", nil)
+		require.NoError(t, err)
+		require.Equal(t, current.SnapshotID, branchHead(tbl.Metadata(), "audit").SnapshotID)
+
+		same, err := resetBranch(ctx, cat, tbl, "audit", nil)
+		require.NoError(t, err)
+		require.Equal(t, tbl.MetadataLocation(), same.MetadataLocation())
+		same, err = resetBranch(ctx, cat, tbl, "missing", nil)
+		require.NoError(t, err)
+		require.Equal(t, tbl.MetadataLocation(), same.MetadataLocation())
+	})
+
+	t.Run("without main", func(t *testing.T) {
+		dst := localDestination(t)
+		dst.Branch = "audit"
+		writeUsers(t, dst, 0, 1, 2)
+		cat, tbl := usersTable(t, dst)
+		require.Nil(t, tbl.CurrentSnapshot())
+
+		tbl, err := resetBranch(ctx, cat, tbl, "audit", nil)
+		require.NoError(t, err)
+		rows, err := snapshotRowCount(ctx, tbl, branchHead(tbl.Metadata(), "audit").SnapshotID)
+		require.NoError(t, err)
+		require.Zero(t, rows)
+	})
+}
+
+func TestSinkSnapshotPublish(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	dst.Branch = "audit_{transfer_id}"
+
+	// an unpublished load is left on the branch
+	writeUsers(t, dst, 0, 1, 3)
+	cat, tbl := usersTable(t, dst)
+	require.Nil(t, tbl.CurrentSnapshot())
+
+	// the next load starts from main again, so only its rows are published
+	dst.Publish = PublishConfig{Enabled: true, CheckNonNullKeys: true}
+	writeUsers(t, dst, 10, 1, 3)
+	rows, err := DestinationRowCount(dst, "public", "users")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), rows)
+
+	// main moved past the branch by another writer can not be fast-forwarded
+	_, tbl = usersTable(t, dst)
+	require.Equal(t, branchHead(tbl.Metadata(), "audit_local").SnapshotID, tbl.CurrentSnapshot().SnapshotID)
+	tbl, err = newSnapshotUpdate(cat, tbl, nil).overwriteAll().commit(ctx)
+	require.NoError(t, err)
+
+	sink, err := NewSinkSnapshot(dst, coordinator.NewStatefulFakeClient(), &model.Transfer{ID: "local"}, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer sink.Close()
+	item := abstract.ChangeItem{Kind: abstract.DoneShardedTableLoad, Schema: "public", Table: "users", TableSchema: abstract.NewTableSchema([]abstract.ColSchema{
+		{ColumnName: "id", DataType: "INT64", Required: true, PrimaryKey: true},
+	})}
+	_, err = sink.publish(ctx, tbl, item)
+	require.ErrorContains(t, err, "diverged")
+}
+
+func TestSinkSnapshotDropOnBranch(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	writeUsers(t, dst, 0, 1, 4)
+
+	// the drop cleanup of a branch load replaces the rows of main on the branch only
+	dst.Branch = "audit"
+	cp := coordinator.NewStatefulFakeClient()
+	sink, err := NewSinkSnapshot(dst, cp, &model.Transfer{ID: "local"}, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	require.NoError(t, sink.Push([]abstract.ChangeItem{{Kind: abstract.DropTableKind, Schema: "public", Table: "users"}}))
+	require.NoError(t, sink.Close())
+	writeUsersWith(t, dst, cp, 10, 1, 3)
+
+	_, tbl := usersTable(t, dst)
+	rows, err := snapshotRowCount(ctx, tbl, tbl.CurrentSnapshot().SnapshotID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), rows)
+	rows, err = snapshotRowCount(ctx, tbl, branchHead(tbl.Metadata(), "audit").SnapshotID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), rows)
+}
+
+func TestResolveRefNames(t *testing.T) {
+	cp := coordinator.NewStatefulFakeClient()
+	dst := &Destination{Branch: "audit_{transfer_id}"}
+	refs, err := resolveRefNames(dst, cp, "t1")
+	require.NoError(t, err)
+	require.Equal(t, &refNames{Branch: "audit_t1", NessieRef: ""}, refs)
+	state, err := cp.GetTransferState("t1")
+	require.NoError(t, err)
+	require.NotContains(t, state, refNamesKey)
+
+	// the first sink of a load keeps the expanded names, the others use them whatever the date is
+	dst = &Destination{Branch: "audit_{date}", NessieRef: "load_{transfer_id}_{date}"}
+	refs, err = resolveRefNames(dst, cp, "t1")
+	require.NoError(t, err)
+	require.Equal(t, dst.refNames("t1", time.Now()), refs)
+	require.NoError(t, cp.SetTransferState("t1", map[string]*coordinator.TransferStateData{
+		refNamesKey: {Generic: map[string]any{"branch": "audit_20240101", "nessie_ref": "load_t1_20240101"}},
+	}))
+	refs, err = resolveRefNames(dst, cp, "t1")
+	require.NoError(t, err)
+	require.Equal(t, &refNames{Branch: "audit_20240101", NessieRef: "load_t1_20240101"}, refs)
+
+	require.NoError(t, cp.SetTransferState("t1", map[string]*coordinator.TransferStateData{
+		refNamesKey: {Generic: "audit"},
+	}))
+	_, err = resolveRefNames(dst, cp, "t1")
+	require.Error(t, err)
+}
+
+func TestSinkSnapshotCommitForgetsRefNames(t *testing.T) {
+	dst := localDestination(t)
+	dst.Branch = "audit_{date}"
+	cp := coordinator.NewStatefulFakeClient()
+	sink, err := NewSinkSnapshot(dst, cp, &model.Transfer{ID: "local"}, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer sink.Close()
+	state, err := cp.GetTransferState("local")
+	require.NoError(t, err)
+	require.Contains(t, state, refNamesKey)
+
+	require.NoError(t, sink.Commit())
+	state, err = cp.GetTransferState("local")
+	require.NoError(t, err)
+	require.NotContains(t, state, refNamesKey)
+}
+
+func TestExpandRefName(t *testing.T) {
+	now := time.Date(2025, 3, 7, 23, 30, 0, 0, time.FixedZone("UTC+3", 3*60*60))
+	for _, tc := range []struct {
+		template string
+		expected string
+	}{
+		{template: "", expected: ""},
+		{template: "audit", expected: "audit"},
+		{template: "audit_{transfer_id}", expected: "audit_dtt1"},
+		// the date is taken in UTC
+		{template: "transfer-{transfer_id}-{date}", expected: "transfer-dtt1-20250307"},
+		{template: "{date}_{date}", expected: "20250307_20250307"},
+		{template: "{unknown}", expected: "{unknown}"},
+	} {
+		t.Run(tc.template, func(t *testing.T) {
+			require.Equal(t, tc.expected, expandRefName(tc.template, "dtt1", now))
+		})
+	}
+}
+
+func TestTagSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	writeUsers(t, dst, 0, 1, 2)
+	writeUsers(t, dst, 2, 1, 2)
+	cat, tbl := usersTable(t, dst)
+	second := tbl.CurrentSnapshot()
+	first := *second.ParentSnapshotID
+	tbl = setBranch(t, cat, tbl, "audit", first)
+
+	for _, tc := range []struct {
+		name       string
+		tag        string
+		snapshotID int64
+		retention  time.Duration
+		err        string
+	}{
+		{name: "new tag", tag: "v1", snapshotID: first, retention: time.Hour},
+		{name: "existing tag is moved", tag: "v1", snapshotID: second.SnapshotID},
+		{name: "branch with the name", tag: "audit", snapshotID: second.SnapshotID, err: "is not a tag"},
+		{name: "main", tag: table.MainBranch, snapshotID: first, err: "is not a tag"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tagged, err := tagSnapshot(ctx, cat, tbl, tc.tag, tc.snapshotID, tc.retention)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			tbl = tagged
+			refs := maps.Collect(tbl.Metadata().Refs())
+			require.Contains(t, refs, tc.tag)
+			require.Equal(t, table.TagRef, refs[tc.tag].SnapshotRefType)
+			require.Equal(t, tc.snapshotID, refs[tc.tag].SnapshotID)
+			if tc.retention > 0 {
+				require.Equal(t, tc.retention.Milliseconds(), *refs[tc.tag].MaxRefAgeMs)
+			}
+		})
+	}
+	require.Equal(t, first, branchHead(tbl.Metadata(), "audit").SnapshotID)
+	require.Equal(t, second.SnapshotID, tbl.CurrentSnapshot().SnapshotID)
+}
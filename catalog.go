@@ -0,0 +1,163 @@
+package iceberg
+
+import (
+	"context"
+	"errors"
+	goio "io"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	_ "github.com/apache/iceberg-go/catalog/glue"
+	_ "github.com/apache/iceberg-go/catalog/rest"
+	sqlcat "github.com/apache/iceberg-go/catalog/sql"
+	"github.com/apache/iceberg-go/table"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+// newCatalog builds the catalog of catalogType through the iceberg-go catalog registry.
+//
+// props are passed to the catalog as is, so every catalog reads its own options from them:
+// the REST catalog takes "warehouse", "token", "credential", "scope", "oauth2-server-uri" and "prefix", Glue takes
+// "glue.region", "glue.access-key-id", "glue.secret-access-key", "glue.session-token" and "glue.id".
+// For the SQL catalog uri is a DSN, see sqlCatalogProps, for the Hive one it is the metastore address.
+// The Nessie catalog is REST at the reference of the "nessie.ref" property, see newNessieCatalog.
+// HTTP client options of the REST catalog are read from "rest.http." properties, those of the S3 FileIO
+// from "s3.http." ones, see HTTPConfig.
+func newCatalog(ctx context.Context, catalogType, uri string, props iceberg.Properties) (catalog.Catalog, error) {
+	if !slices.Contains(catalogTypes, catalogType) {
+		return nil, xerrors.Errorf("unknown catalog type %q, expected one of: %s", catalogType, strings.Join(catalogTypes, ", "))
+	}
+	if !slices.Contains(catalog.GetRegisteredCatalogs(), catalogType) {
+		return nil, xerrors.Errorf("%s catalog is not available in this build", catalogType)
+	}
+
+	catalogProps := iceberg.Properties{}
+	maps.Copy(catalogProps, props)
+	catalogProps["type"] = catalogType
+	if uri != "" {
+		catalogProps["uri"] = uri
+	}
+	if catalogType == CatalogTypeSQL {
+		if err := sqlCatalogProps(catalogProps); err != nil {
+			return nil, xerrors.Errorf("unable to init sql catalog: %w", err)
+		}
+	}
+	var cat catalog.Catalog
+	var err error
+	if catalogType == CatalogTypeREST {
+		cat, err = loadRESTCatalog(ctx, catalogProps)
+	} else {
+		cat, err = catalog.Load(ctx, catalogType, catalogProps)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init %s catalog: %w", catalogType, err)
+	}
+	awsConfig, err := s3AWSConfig(ctx, catalogProps)
+	if err != nil {
+		closeCatalog(cat)
+		return nil, xerrors.Errorf("unable to init S3 FileIO: %w", err)
+	}
+	if awsConfig != nil {
+		cat = &fileIOCatalog{Catalog: cat, awsConfig: awsConfig}
+	}
+	return cat, nil
+}
+
+// closeCatalog releases connections of catalogs that keep them, like the hive one.
+func closeCatalog(cat catalog.Catalog) {
+	if closer, ok := cat.(goio.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+// sqlCatalogProps picks the database driver and dialect of the SQL catalog from its DSN:
+// "postgres://" and "postgresql://" DSNs go to Postgres, "sqlite://<path>" and "file:<path>"
+// ones to a SQLite file. Other databases need explicit "sql.driver" and "sql.dialect" properties.
+func sqlCatalogProps(props iceberg.Properties) error {
+	dsn := props["uri"]
+	driver, dialect := "", sqlcat.SupportedDialect("")
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		driver, dialect = "pgx", sqlcat.Postgres
+	case strings.HasPrefix(dsn, "sqlite://"):
+		driver, dialect = "sqlite3", sqlcat.SQLite
+		props["uri"] = strings.TrimPrefix(dsn, "sqlite://")
+	case strings.HasPrefix(dsn, "file:"):
+		driver, dialect = "sqlite3", sqlcat.SQLite
+	}
+	if _, ok := props[sqlcat.DriverKey]; !ok && driver != "" {
+		props[sqlcat.DriverKey] = driver
+	}
+	if _, ok := props[sqlcat.DialectKey]; !ok && dialect != "" {
+		props[sqlcat.DialectKey] = string(dialect)
+	}
+	if props[sqlcat.DriverKey] == "" || props[sqlcat.DialectKey] == "" {
+		return xerrors.Errorf("unable to detect the database of DSN %q, set %q and %q properties", redactDSN(dsn), sqlcat.DriverKey, sqlcat.DialectKey)
+	}
+	return nil
+}
+
+// redactDSN hides the password of a URL-style DSN.
+func redactDSN(dsn string) string {
+	parsed, err := url.Parse(dsn)
+	if err != nil || parsed.User == nil {
+		return dsn
+	}
+	return parsed.Redacted()
+}
+
+// ensureNamespace creates the namespace of the table ident if the catalog reports it missing.
+// Catalogs like SQL refuse to create tables in a missing namespace.
+func ensureNamespace(ctx context.Context, cat catalog.Catalog, ident table.Identifier) error {
+	namespace := catalog.NamespaceFromIdent(ident)
+	if _, err := cat.LoadNamespaceProperties(ctx, namespace); !errors.Is(err, catalog.ErrNoSuchNamespace) {
+		return nil
+	}
+	if err := cat.CreateNamespace(ctx, namespace, nil); err != nil && !errors.Is(err, catalog.ErrNamespaceAlreadyExists) {
+		return xerrors.Errorf("create namespace %v: %w", namespace, err)
+	}
+	return nil
+}
+
+// updateMetadata validates reqs against current metadata stored at location and applies updates to it.
+// The previous location is added to the metadata log. changed is false when updates change nothing.
+func updateMetadata(current table.Metadata, location string, reqs []table.Requirement, updates []table.Update) (updated table.Metadata, changed bool, err error) {
+	for _, req := range reqs {
+		if err := req.Validate(current); err != nil {
+			return nil, false, err
+		}
+	}
+
+	builder, err := table.MetadataBuilderFromBase(current)
+	if err != nil {
+		return nil, false, xerrors.Errorf("unable to init metadata builder: %w", err)
+	}
+	for _, update := range updates {
+		if err := update.Apply(builder); err != nil {
+			return nil, false, err
+		}
+	}
+	if !builder.HasChanges() {
+		return current, false, nil
+	}
+	maxEntries := max(1, current.Properties().GetInt(table.MetadataPreviousVersionsMaxKey, table.MetadataPreviousVersionsMaxDefault))
+	builder.TrimMetadataLogs(maxEntries + 1).AppendMetadataLog(table.MetadataLogEntry{
+		MetadataFile: location,
+		TimestampMs:  current.LastUpdatedMillis(),
+	})
+	if current.LastUpdatedMillis() == builder.LastUpdatedMS() {
+		builder.SetLastUpdatedMS()
+	}
+	updated, err = builder.Build()
+	if err != nil {
+		return nil, false, err
+	}
+	return updated, true, nil
+}
@@ -0,0 +1,172 @@
+package iceberg
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apache/iceberg-go"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+const (
+	CatalogTypeREST   = "rest"
+	CatalogTypeGlue   = "glue"
+	CatalogTypeSQL    = "sql"
+	CatalogTypeHive   = "hive"
+	CatalogTypeHadoop = "hadoop"
+	CatalogTypeNessie = "nessie"
+)
+
+var catalogTypes = []string{CatalogTypeREST, CatalogTypeGlue, CatalogTypeSQL, CatalogTypeHive, CatalogTypeHadoop, CatalogTypeNessie}
+
+// prefixSchemes are the schemes FileIO can write data files to.
+var prefixSchemes = []string{"s3", "s3a", "s3n", "gs", "abfs", "abfss", "wasb", "wasbs", "file", "mem"}
+
+const (
+	defaultNamespace      = "default"
+	defaultCommitInterval = time.Minute
+	minCommitInterval     = time.Second
+	defaultShardSize      = 1 << 30
+)
+
+func validateCatalog(catalogType, uri string) error {
+	if !slices.Contains(catalogTypes, catalogType) {
+		return xerrors.Errorf("unknown catalog type %q, expected one of: %s", catalogType, strings.Join(catalogTypes, ", "))
+	}
+	if catalogType == CatalogTypeSQL && uri == "" {
+		return xerrors.New("catalog URI with the database DSN is required for the sql catalog")
+	}
+	if catalogType == CatalogTypeHive && uri == "" {
+		return xerrors.New("catalog URI with the metastore address is required for the hive catalog")
+	}
+	if catalogType != CatalogTypeREST && catalogType != CatalogTypeNessie {
+		return nil
+	}
+	if uri == "" {
+		return xerrors.Errorf("catalog URI is required for the %s catalog", catalogType)
+	}
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return xerrors.Errorf("invalid catalog URI: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return xerrors.Errorf("catalog URI %q must be an http or https URL", uri)
+	}
+	return nil
+}
+
+func validateTimeTravel(snapshotID int64, asOf time.Time, ref string) error {
+	set := 0
+	for _, ok := range []bool{snapshotID != 0, !asOf.IsZero(), ref != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return xerrors.New("only one of snapshot ID, as-of time and ref can be set")
+	}
+	return nil
+}
+
+func validateNessieRef(catalogType, ref, baseRef string) error {
+	if (ref != "" || baseRef != "") && catalogType != CatalogTypeNessie {
+		return xerrors.Errorf("nessie references are not supported by the %s catalog", catalogType)
+	}
+	if baseRef != "" && ref == "" {
+		return xerrors.New("nessie base ref requires a nessie ref")
+	}
+	return nil
+}
+
+func validateRESTAuth(catalogType string, auth RESTAuthConfig) error {
+	if auth != (RESTAuthConfig{}) && catalogType != CatalogTypeREST && catalogType != CatalogTypeNessie {
+		return xerrors.Errorf("REST authentication is not supported by the %s catalog", catalogType)
+	}
+	return auth.validate()
+}
+
+func validateSigV4(catalogType string, sigV4 SigV4Config) error {
+	if sigV4.Enabled && catalogType != CatalogTypeREST && catalogType != CatalogTypeNessie {
+		return xerrors.Errorf("SigV4 signing is not supported by the %s catalog", catalogType)
+	}
+	return sigV4.validate()
+}
+
+func validateVendedCredentials(catalogType string, enabled bool) error {
+	if enabled && catalogType != CatalogTypeREST && catalogType != CatalogTypeNessie {
+		return xerrors.Errorf("vended credentials are not supported by the %s catalog", catalogType)
+	}
+	return nil
+}
+
+func validateHTTP(catalogType string, catalogHTTP, fileIOHTTP HTTPConfig) error {
+	if catalogHTTP != (HTTPConfig{}) && catalogType != CatalogTypeREST && catalogType != CatalogTypeNessie {
+		return xerrors.Errorf("catalog HTTP options are not supported by the %s catalog", catalogType)
+	}
+	if catalogHTTP.ProxyURI != "" || catalogHTTP.ConnectTimeout != 0 || catalogHTTP.ResponseTimeout != 0 {
+		// the REST catalog of iceberg-go only takes a TLS config of its HTTP client
+		return xerrors.New("catalog HTTP options: proxy and timeouts are only supported by the FileIO")
+	}
+	if err := catalogHTTP.validate(); err != nil {
+		return xerrors.Errorf("catalog HTTP options: %w", err)
+	}
+	if err := fileIOHTTP.validate(); err != nil {
+		return xerrors.Errorf("FileIO HTTP options: %w", err)
+	}
+	return nil
+}
+
+func validatePrefix(prefix string) error {
+	if prefix == "" {
+		return xerrors.New("prefix is required")
+	}
+	parsed, err := url.Parse(prefix)
+	if err != nil {
+		return xerrors.Errorf("invalid prefix: %w", err)
+	}
+	if !slices.Contains(prefixSchemes, parsed.Scheme) {
+		return xerrors.Errorf("prefix %q has unsupported scheme %q, expected one of: %s", prefix, parsed.Scheme, strings.Join(prefixSchemes, ", "))
+	}
+	switch {
+	case parsed.Scheme == "file":
+		if parsed.Host != "" || parsed.Path == "" {
+			return xerrors.Errorf("prefix %q must be an absolute local path, file:///<path>", prefix)
+		}
+	case slices.Contains(azureSchemes, parsed.Scheme):
+		if parsed.User.Username() == "" || parsed.Host == "" {
+			return xerrors.Errorf("prefix %q has no container, expected %s://<container>@<account host>/<path>", prefix, parsed.Scheme)
+		}
+	case parsed.Scheme != "mem" && parsed.Host == "":
+		return xerrors.Errorf("prefix %q has no bucket", prefix)
+	}
+	return nil
+}
+
+// validateCatalogPrefix rejects Azure prefixes for catalogs whose tables get their FileIO from iceberg-go, which
+// can not open Azure locations yet. The hadoop and hive catalogs, and rest or nessie with vended credentials, use loadFS.
+func validateCatalogPrefix(catalogType, prefix string, vended bool) error {
+	parsed, err := url.Parse(prefix)
+	if err != nil || !slices.Contains(azureSchemes, parsed.Scheme) {
+		return nil
+	}
+	switch {
+	case catalogType == CatalogTypeHadoop, catalogType == CatalogTypeHive:
+		return nil
+	case vended && (catalogType == CatalogTypeREST || catalogType == CatalogTypeNessie):
+		return nil
+	default:
+		return xerrors.Errorf("%s prefix is not supported by the %s catalog, use hadoop, hive or vended credentials", parsed.Scheme, catalogType)
+	}
+}
+
+func validateProperties(name string, props iceberg.Properties) error {
+	for k := range props {
+		if k == "" || strings.TrimSpace(k) != k {
+			return xerrors.Errorf("%s: invalid key %q", name, k)
+		}
+	}
+	return nil
+}
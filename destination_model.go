@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/table"
+	"github.com/transferia/transferia/library/go/core/xerrors"
 	"github.com/transferia/transferia/pkg/abstract"
 	"github.com/transferia/transferia/pkg/abstract/model"
 )
@@ -16,17 +18,114 @@ var (
 type Destination struct {
 	Properties       iceberg.Properties
 	SnapshotProps    iceberg.Properties
+	TableProperties  iceberg.Properties // Properties for created tables, e.g. commit.manifest-merge.enabled
 	CatalogType      string
 	CatalogURI       string
 	Schema           string
 	Prefix           string
 	CommitInterval   time.Duration // Interval for committing files in streaming mode
 	DefaultNamespace string
+
+	// RewriteManifestsInterval enables periodic manifest rewrite in streaming mode, zero disables it
+	RewriteManifestsInterval time.Duration
+
+	// Branch is the ref all commits go to, empty means main. {transfer_id} and {date} are substituted
+	Branch  string
+	Publish PublishConfig
+	Tag     TagConfig
+
+	// Cleanup is the policy applied to existing tables before a snapshot load, empty means Drop.
+	// Truncate commits a snapshot deleting all files instead of recreating the table
+	Cleanup model.CleanupType
+	// PurgeOnDrop removes data and metadata files of dropped tables, otherwise they are only unregistered
+	PurgeOnDrop bool
+
+	// WriteMode selects how a snapshot load replaces the data already in the table
+	WriteMode WriteMode
+
+	// StagedLoad writes rows into <name>__tmp_<transfer_id> and swaps it in place of the table
+	// once the table is loaded, the cleanup policy is not applied
+	StagedLoad bool
+
+	Verify VerifyConfig
+
+	// AtomicCommit defers snapshot commits until all tables are loaded and commits them at once,
+	// through the multi-table transaction endpoint if the REST catalog has one
+	AtomicCommit bool
+
+	// NessieRef is the Nessie branch the nessie catalog commits to, empty means the default branch.
+	// {transfer_id} and {date} are substituted
+	NessieRef string
+	// NessieBaseRef is the reference a missing NessieRef branch is created from, empty fails on a missing branch
+	NessieBaseRef string
+
+	Auth  RESTAuthConfig
+	SigV4 SigV4Config
+
+	// CatalogHTTP configures the HTTP client of the rest and nessie catalogs, FileIOHTTP the one of the S3 FileIO
+	CatalogHTTP HTTPConfig
+	FileIOHTTP  HTTPConfig
+
+	// VendedCredentials makes the rest and nessie catalogs vend storage credentials of each table,
+	// they are used for reading and writing its files instead of the "s3." ones and refreshed before they expire
+	VendedCredentials bool
+}
+
+// WriteMode of the snapshot sink.
+type WriteMode string
+
+const (
+	// WriteModeAppend drops the table on cleanup and appends loaded files to it
+	WriteModeAppend = WriteMode("append")
+	// WriteModeOverwrite keeps the table and replaces all its files in the final commit
+	WriteModeOverwrite = WriteMode("overwrite")
+	// WriteModeDynamicOverwrite keeps the table and replaces files of partitions present in loaded data
+	WriteModeDynamicOverwrite = WriteMode("dynamic_overwrite")
+)
+
+// TagConfig controls tagging of the snapshot produced by each snapshot load of a table.
+type TagConfig struct {
+	Name      string        // Tag name template, e.g. transfer-{transfer_id}-{date}; empty disables tagging
+	Retention time.Duration // Max age of the tag, zero keeps it forever
+}
+
+// VerifyConfig controls checks of the snapshot committed by a snapshot load of a table.
+type VerifyConfig struct {
+	Enabled               bool // Compare added-records of the snapshot with the number of pushed rows
+	CheckSourceExactCount bool // Also compare with source ExactTableRowsCount
+	FailOnMismatch        bool // Fail the transfer, otherwise only log a warning and increment sink.iceberg.rows_mismatch
+}
+
+// PublishConfig controls fast-forwarding main to Branch once a snapshot load of a table is done.
+type PublishConfig struct {
+	Enabled           bool
+	CheckRowCount     bool    // Compare branch row count with source EtaRow
+	RowCountTolerance float64 // Allowed relative difference for CheckRowCount, EtaRow may be an estimate
+	CheckNonNullKeys  bool    // Require primary key columns to have no nulls
+}
+
+// refNames returns Branch and NessieRef of a transfer with templates expanded as of now.
+// Sinks take them from resolveRefNames, so all of them commit to the same references.
+func (i *Destination) refNames(transferID string, now time.Time) *refNames {
+	branch := table.MainBranch
+	if i.Branch != "" {
+		branch = expandRefName(i.Branch, transferID, now)
+	}
+	return &refNames{Branch: branch, NessieRef: expandRefName(i.NessieRef, transferID, now)}
+}
+
+// catalogProperties returns Properties with the Nessie references of a transfer and the REST and FileIO options set.
+func (i *Destination) catalogProperties(refs *refNames) iceberg.Properties {
+	props := vendedCredentialsProps(i.SigV4.props(i.Auth.props(nessieProps(i.Properties, refs.NessieRef, i.NessieBaseRef))), i.VendedCredentials)
+	return i.FileIOHTTP.props(i.CatalogHTTP.props(props, restHTTPPrefix), s3HTTPPrefix)
 }
 
 // CleanupMode implements model.Destination.
 func (i *Destination) CleanupMode() model.CleanupType {
-	return model.Drop
+	if i.Cleanup == "" {
+		return model.Drop
+	}
+	return i.Cleanup
 }
 
 // GetProviderType implements model.Destination.
@@ -40,9 +139,99 @@ func (i *Destination) IsDestination() {
 
 // Validate implements model.Destination.
 func (i *Destination) Validate() error {
+	if err := validateCatalog(i.CatalogType, i.CatalogURI); err != nil {
+		return err
+	}
+	if err := validateNessieRef(i.CatalogType, i.NessieRef, i.NessieBaseRef); err != nil {
+		return err
+	}
+	if err := validateRESTAuth(i.CatalogType, i.Auth); err != nil {
+		return err
+	}
+	if err := validateSigV4(i.CatalogType, i.SigV4); err != nil {
+		return err
+	}
+	if err := validateHTTP(i.CatalogType, i.CatalogHTTP, i.FileIOHTTP); err != nil {
+		return err
+	}
+	if err := validateVendedCredentials(i.CatalogType, i.VendedCredentials); err != nil {
+		return err
+	}
+	if err := validatePrefix(i.Prefix); err != nil {
+		return err
+	}
+	if err := validateCatalogPrefix(i.CatalogType, i.Prefix, i.VendedCredentials); err != nil {
+		return err
+	}
+	if i.CommitInterval != 0 && i.CommitInterval < minCommitInterval {
+		return xerrors.Errorf("commit interval %v is shorter than %v", i.CommitInterval, minCommitInterval)
+	}
+	if i.RewriteManifestsInterval < 0 {
+		return xerrors.Errorf("negative rewrite manifests interval %v", i.RewriteManifestsInterval)
+	}
+	for name, props := range map[string]iceberg.Properties{
+		"properties":          i.Properties,
+		"snapshot properties": i.SnapshotProps,
+		"table properties":    i.TableProperties,
+	} {
+		if err := validateProperties(name, props); err != nil {
+			return err
+		}
+	}
+	switch i.WriteMode {
+	case "", WriteModeAppend, WriteModeOverwrite, WriteModeDynamicOverwrite:
+	default:
+		return xerrors.Errorf("unknown write mode %q", i.WriteMode)
+	}
+	if i.Cleanup != "" {
+		if err := i.Cleanup.IsValid(); err != nil {
+			return xerrors.Errorf("invalid cleanup policy: %w", err)
+		}
+	}
+	if i.Publish.Enabled && i.Branch == "" {
+		return xerrors.New("publish requires a branch")
+	}
+	if i.Publish.RowCountTolerance < 0 || i.Publish.RowCountTolerance > 1 {
+		return xerrors.Errorf("row count tolerance %v is out of [0, 1]", i.Publish.RowCountTolerance)
+	}
+	if i.Tag.Retention < 0 {
+		return xerrors.Errorf("negative tag retention %v", i.Tag.Retention)
+	}
+	if i.StagedLoad && i.AtomicCommit {
+		return xerrors.New("staged load can not be combined with atomic commit")
+	}
+	if i.StagedLoad && i.CatalogType == CatalogTypeHadoop {
+		return xerrors.New("staged load needs table renames, which the hadoop catalog does not support")
+	}
 	return nil
 }
 
 // WithDefaults implements model.Destination.
 func (i *Destination) WithDefaults() {
+	if i.DefaultNamespace == "" {
+		i.DefaultNamespace = i.Schema
+	}
+	if i.DefaultNamespace == "" {
+		i.DefaultNamespace = defaultNamespace
+	}
+	if i.CommitInterval == 0 {
+		i.CommitInterval = defaultCommitInterval
+	}
+	if i.WriteMode == "" {
+		i.WriteMode = WriteModeAppend
+	}
+	if i.Cleanup == "" {
+		i.Cleanup = model.Drop
+	}
+	// data files are written under Prefix, so is the metadata of tables the catalog creates.
+	// REST and Glue catalogs read warehouse as a catalog name or ID, so it is left to the user
+	switch i.CatalogType {
+	case CatalogTypeHadoop, CatalogTypeSQL, CatalogTypeHive:
+		if _, ok := i.Properties["warehouse"]; !ok && i.Prefix != "" {
+			if i.Properties == nil {
+				i.Properties = iceberg.Properties{}
+			}
+			i.Properties["warehouse"] = i.Prefix
+		}
+	}
 }
@@ -0,0 +1,167 @@
+package iceberg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/stretchr/testify/require"
+	"github.com/transferia/transferia/pkg/abstract/model"
+)
+
+func TestDestinationValidate(t *testing.T) {
+	valid := func() *Destination {
+		return &Destination{
+			CatalogType: CatalogTypeREST,
+			CatalogURI:  "http://localhost:8181",
+			Prefix:      "s3://warehouse",
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(dst *Destination)
+		err    string
+	}{
+		{name: "valid", modify: func(dst *Destination) {}},
+		{name: "glue without uri", modify: func(dst *Destination) { dst.CatalogType, dst.CatalogURI = CatalogTypeGlue, "" }},
+		{name: "unknown catalog type", modify: func(dst *Destination) { dst.CatalogType = "Rest" }, err: `unknown catalog type "Rest"`},
+		{name: "rest without uri", modify: func(dst *Destination) { dst.CatalogURI = "" }, err: "catalog URI is required"},
+		{name: "rest with non http uri", modify: func(dst *Destination) { dst.CatalogURI = "localhost:8181" }, err: "must be an http or https URL"},
+		{name: "no prefix", modify: func(dst *Destination) { dst.Prefix = "" }, err: "prefix is required"},
+		{name: "prefix without scheme", modify: func(dst *Destination) { dst.Prefix = "warehouse/data" }, err: "unsupported scheme"},
+		{name: "prefix with unknown scheme", modify: func(dst *Destination) { dst.Prefix = "hdfs://nn/warehouse" }, err: "unsupported scheme"},
+		{name: "prefix without bucket", modify: func(dst *Destination) { dst.Prefix = "s3:///data" }, err: "has no bucket"},
+		{name: "local prefix", modify: func(dst *Destination) { dst.Prefix = "file:///tmp/warehouse" }},
+		{name: "relative local prefix", modify: func(dst *Destination) { dst.Prefix = "file://tmp/warehouse" }, err: "absolute local path"},
+		{name: "gcs prefix", modify: func(dst *Destination) { dst.Prefix = "gs://bucket/warehouse" }},
+		{name: "adls prefix", modify: func(dst *Destination) {
+			dst.CatalogType, dst.CatalogURI, dst.Prefix = CatalogTypeHive, "thrift://localhost:9083", "abfss://data@account.dfs.core.windows.net/warehouse"
+		}},
+		{name: "adls prefix of hadoop", modify: func(dst *Destination) {
+			dst.CatalogType, dst.CatalogURI, dst.Prefix = CatalogTypeHadoop, "", "wasbs://data@account.blob.core.windows.net/warehouse"
+		}},
+		{name: "adls prefix of vended rest", modify: func(dst *Destination) {
+			dst.Prefix, dst.VendedCredentials = "abfss://data@account.dfs.core.windows.net/warehouse", true
+		}},
+		{name: "adls prefix of rest", modify: func(dst *Destination) { dst.Prefix = "abfss://data@account.dfs.core.windows.net/warehouse" }, err: "not supported by the rest catalog"},
+		{name: "adls prefix of sql", modify: func(dst *Destination) {
+			dst.CatalogType, dst.CatalogURI, dst.Prefix = CatalogTypeSQL, "file:///tmp/catalog.db", "abfs://data@account.dfs.core.windows.net/warehouse"
+		}, err: "not supported by the sql catalog"},
+		{name: "adls prefix of glue", modify: func(dst *Destination) {
+			dst.CatalogType, dst.CatalogURI, dst.Prefix = CatalogTypeGlue, "", "abfss://data@account.dfs.core.windows.net/warehouse"
+		}, err: "not supported by the glue catalog"},
+		{name: "adls prefix without container", modify: func(dst *Destination) { dst.Prefix = "abfss://account.dfs.core.windows.net/warehouse" }, err: "has no container"},
+		{name: "short commit interval", modify: func(dst *Destination) { dst.CommitInterval = time.Millisecond }, err: "commit interval"},
+		{name: "negative rewrite interval", modify: func(dst *Destination) { dst.RewriteManifestsInterval = -time.Second }, err: "rewrite manifests interval"},
+		{name: "blank property key", modify: func(dst *Destination) { dst.TableProperties = iceberg.Properties{" format-version": "2"} }, err: "table properties: invalid key"},
+		{name: "unknown write mode", modify: func(dst *Destination) { dst.WriteMode = "upsert" }, err: "unknown write mode"},
+		{name: "unknown cleanup", modify: func(dst *Destination) { dst.Cleanup = "Purge" }, err: "invalid cleanup policy"},
+		{name: "publish without branch", modify: func(dst *Destination) { dst.Publish.Enabled = true }, err: "publish requires a branch"},
+		{name: "tolerance out of range", modify: func(dst *Destination) { dst.Publish.RowCountTolerance = 2 }, err: "out of [0, 1]"},
+		{name: "negative tag retention", modify: func(dst *Destination) { dst.Tag.Retention = -time.Hour }, err: "negative tag retention"},
+		{name: "hadoop", modify: func(dst *Destination) { dst.CatalogType, dst.CatalogURI = CatalogTypeHadoop, "" }},
+		{name: "staged hadoop", modify: func(dst *Destination) { dst.CatalogType, dst.StagedLoad = CatalogTypeHadoop, true }, err: "does not support"},
+		{name: "nessie branch", modify: func(dst *Destination) {
+			dst.CatalogType, dst.NessieRef, dst.NessieBaseRef = CatalogTypeNessie, "load_{transfer_id}", "main"
+		}},
+		{name: "nessie base without ref", modify: func(dst *Destination) { dst.CatalogType, dst.NessieBaseRef = CatalogTypeNessie, "main" }, err: "requires a nessie ref"},
+		{name: "nessie ref of rest", modify: func(dst *Destination) { dst.NessieRef = "dev" }, err: "not supported by the rest catalog"},
+		{name: "bad oauth2 server uri", modify: func(dst *Destination) { dst.Auth = RESTAuthConfig{Credential: "secret", ServerURI: "idp/token"} }, err: "must be an http or https URL"},
+		{name: "sigv4 options without sigv4", modify: func(dst *Destination) { dst.SigV4 = SigV4Config{Region: "us-east-1"} }, err: "SigV4 is not enabled"},
+		{name: "staged atomic", modify: func(dst *Destination) { dst.StagedLoad, dst.AtomicCommit = true, true }, err: "can not be combined"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := valid()
+			tc.modify(dst)
+			err := dst.Validate()
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestDestinationWithDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		dst      *Destination
+		expected *Destination
+	}{
+		{
+			name: "empty",
+			dst:  &Destination{},
+			expected: &Destination{
+				DefaultNamespace: defaultNamespace,
+				CommitInterval:   defaultCommitInterval,
+				WriteMode:        WriteModeAppend,
+				Cleanup:          model.Drop,
+			},
+		},
+		{
+			name: "namespace from schema and warehouse from prefix",
+			dst:  &Destination{CatalogType: CatalogTypeSQL, Schema: "raw", Prefix: "s3://bucket/raw"},
+			expected: &Destination{
+				CatalogType:      CatalogTypeSQL,
+				Properties:       iceberg.Properties{"warehouse": "s3://bucket/raw"},
+				Schema:           "raw",
+				Prefix:           "s3://bucket/raw",
+				DefaultNamespace: "raw",
+				CommitInterval:   defaultCommitInterval,
+				WriteMode:        WriteModeAppend,
+				Cleanup:          model.Drop,
+			},
+		},
+		{
+			name: "rest warehouse is not derived",
+			dst:  &Destination{CatalogType: CatalogTypeREST, Prefix: "s3://bucket/raw"},
+			expected: &Destination{
+				CatalogType:      CatalogTypeREST,
+				Prefix:           "s3://bucket/raw",
+				DefaultNamespace: defaultNamespace,
+				CommitInterval:   defaultCommitInterval,
+				WriteMode:        WriteModeAppend,
+				Cleanup:          model.Drop,
+			},
+		},
+		{
+			name: "glue warehouse is not derived",
+			dst:  &Destination{CatalogType: CatalogTypeGlue, Prefix: "s3://bucket/raw"},
+			expected: &Destination{
+				CatalogType:      CatalogTypeGlue,
+				Prefix:           "s3://bucket/raw",
+				DefaultNamespace: defaultNamespace,
+				CommitInterval:   defaultCommitInterval,
+				WriteMode:        WriteModeAppend,
+				Cleanup:          model.Drop,
+			},
+		},
+		{
+			name: "explicit values are kept",
+			dst: &Destination{
+				Properties:       iceberg.Properties{"warehouse": "lake"},
+				Prefix:           "s3://bucket/raw",
+				DefaultNamespace: "events",
+				CommitInterval:   time.Second,
+				WriteMode:        WriteModeOverwrite,
+				Cleanup:          model.DisabledCleanup,
+			},
+			expected: &Destination{
+				Properties:       iceberg.Properties{"warehouse": "lake"},
+				Prefix:           "s3://bucket/raw",
+				DefaultNamespace: "events",
+				CommitInterval:   time.Second,
+				WriteMode:        WriteModeOverwrite,
+				Cleanup:          model.DisabledCleanup,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.dst.WithDefaults()
+			require.Equal(t, tc.expected, tc.dst)
+		})
+	}
+}
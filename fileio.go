@@ -0,0 +1,119 @@
+package iceberg
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	iceio "github.com/apache/iceberg-go/io"
+	"github.com/apache/iceberg-go/table"
+	"github.com/apache/iceberg-go/utils"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+var (
+	_ catalog.Catalog = (*fileIOCatalog)(nil)
+	_ purger          = (*fileIOCatalog)(nil)
+)
+
+// s3AWSConfig is the AWS config of the S3 FileIO with the "s3.http." options, nil without them.
+// Credentials, region and proxy are read from the "s3." properties as iceberg-go does.
+func s3AWSConfig(ctx context.Context, props iceberg.Properties) (*aws.Config, error) {
+	cfg, err := httpConfigFromProps(props, s3HTTPPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == (HTTPConfig{}) {
+		return nil, nil
+	}
+	if cfg.ProxyURI == "" {
+		cfg.ProxyURI = props[iceio.S3ProxyURI]
+		if cfg.ProxyURI != "" {
+			if parsed, err := url.Parse(cfg.ProxyURI); err != nil || parsed.Host == "" {
+				return nil, xerrors.Errorf("invalid s3 proxy URI %q", cfg.ProxyURI)
+			}
+		}
+	}
+	awsConfig, err := iceio.ParseAWSConfig(ctx, props)
+	if err != nil {
+		return nil, xerrors.Errorf("load AWS config: %w", err)
+	}
+	transport, err := cfg.transport()
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		awsConfig.HTTPClient = &http.Client{Transport: transport}
+	}
+	if cfg.MaxAttempts != 0 || cfg.MaxBackoff != 0 {
+		awsConfig.Retryer = func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) {
+				if cfg.MaxAttempts != 0 {
+					o.MaxAttempts = cfg.MaxAttempts
+				}
+				if cfg.MaxBackoff != 0 {
+					o.MaxBackoff = cfg.MaxBackoff
+					o.Backoff = retry.NewExponentialJitterBackoff(cfg.MaxBackoff)
+				}
+			})
+		}
+	}
+	return awsConfig, nil
+}
+
+// fileIOCatalog opens the S3 FileIO of tables with awsConfig. iceberg-go builds the FileIO of a table
+// when the catalog loads, creates or commits it and takes a custom AWS config only from the context.
+type fileIOCatalog struct {
+	catalog.Catalog
+	awsConfig *aws.Config
+}
+
+func (c *fileIOCatalog) withConfig(ctx context.Context) context.Context {
+	return utils.WithAwsConfig(ctx, c.awsConfig)
+}
+
+// wrap makes commits of tbl go through the catalog, so the FileIO of committed metadata is built with awsConfig too.
+func (c *fileIOCatalog) wrap(tbl *table.Table, err error) (*table.Table, error) {
+	if err != nil {
+		return nil, err
+	}
+	return table.New(tbl.Identifier(), tbl.Metadata(), tbl.MetadataLocation(), tbl.FS(), c), nil
+}
+
+func (c *fileIOCatalog) CreateTable(ctx context.Context, ident table.Identifier, schema *iceberg.Schema, opts ...catalog.CreateTableOpt) (*table.Table, error) {
+	return c.wrap(c.Catalog.CreateTable(c.withConfig(ctx), ident, schema, opts...))
+}
+
+func (c *fileIOCatalog) CommitTable(ctx context.Context, tbl *table.Table, reqs []table.Requirement, updates []table.Update) (table.Metadata, string, error) {
+	return c.Catalog.CommitTable(c.withConfig(ctx), tbl, reqs, updates)
+}
+
+func (c *fileIOCatalog) LoadTable(ctx context.Context, ident table.Identifier, props iceberg.Properties) (*table.Table, error) {
+	return c.wrap(c.Catalog.LoadTable(c.withConfig(ctx), ident, props))
+}
+
+func (c *fileIOCatalog) RenameTable(ctx context.Context, from, to table.Identifier) (*table.Table, error) {
+	return c.wrap(c.Catalog.RenameTable(c.withConfig(ctx), from, to))
+}
+
+// PurgeTable purges through the catalog if it can, otherwise the files are removed here as purgeTable does.
+func (c *fileIOCatalog) PurgeTable(ctx context.Context, ident table.Identifier) error {
+	if p, ok := c.Catalog.(purger); ok {
+		return p.PurgeTable(c.withConfig(ctx), ident)
+	}
+	tbl, err := c.LoadTable(ctx, ident, nil)
+	if err != nil {
+		return err
+	}
+	return purgeTable(ctx, c.Catalog, tbl)
+}
+
+func (c *fileIOCatalog) Close() error {
+	closeCatalog(c.Catalog)
+	return nil
+}
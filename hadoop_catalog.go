@@ -0,0 +1,565 @@
+package iceberg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	goio "io"
+	"io/fs"
+	"iter"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	iceio "github.com/apache/iceberg-go/io"
+	"github.com/apache/iceberg-go/table"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+const hadoopVersionHintFile = "version-hint.text"
+
+var (
+	_ catalog.Catalog = (*hadoopCatalog)(nil)
+
+	hadoopMetadataFileRe = regexp.MustCompile(`^v(\d+)\.metadata\.json$`)
+
+	errHadoopCommitConflict = xerrors.New("metadata version is already committed by another writer")
+)
+
+func init() {
+	catalog.Register(CatalogTypeHadoop, catalog.RegistrarFunc(func(ctx context.Context, _ string, props iceberg.Properties) (catalog.Catalog, error) {
+		return newHadoopCatalog(ctx, props.Get("uri", ""), props)
+	}))
+}
+
+// hadoopCatalog keeps tables in directories under the warehouse, as the Hadoop catalog of Iceberg does.
+//
+// Table a.b is the directory <warehouse>/a/b, its metadata versions are <warehouse>/a/b/metadata/vN.metadata.json
+// and version-hint.text next to them holds the current N. Namespaces are directories that are not tables.
+// A commit writes version N+1 only if it does not exist yet, on local disk this is an atomic link of a temporary
+// file, so concurrent writers can not overwrite each other. Object storage has no such primitive, only a single
+// writer per table is safe there.
+type hadoopCatalog struct {
+	warehouse string
+	fileIO    iceio.IO
+	fs        warehouseFS
+}
+
+// newHadoopCatalog opens the catalog at warehouse, "warehouse" property is used when it is empty.
+func newHadoopCatalog(ctx context.Context, warehouse string, props iceberg.Properties) (*hadoopCatalog, error) {
+	if warehouse == "" {
+		warehouse = props.Get("warehouse", "")
+	}
+	if warehouse == "" {
+		return nil, xerrors.New("warehouse location is required for the hadoop catalog")
+	}
+	warehouse = strings.TrimSuffix(warehouse, "/")
+
+	fileIO, err := loadFS(ctx, props, warehouse)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init warehouse IO: %w", err)
+	}
+	wfs, err := newWarehouseFS(fileIO, warehouse)
+	if err != nil {
+		return nil, err
+	}
+	return &hadoopCatalog{warehouse: warehouse, fileIO: fileIO, fs: wfs}, nil
+}
+
+// newWarehouseFS wraps fileIO of the local disk or object storage, location is any path in it.
+func newWarehouseFS(fileIO iceio.IO, location string) (warehouseFS, error) {
+	switch fsys := fileIO.(type) {
+	case iceio.LocalFS:
+		return localWarehouse{}, nil
+	case objectBucket:
+		parsed, err := url.Parse(location)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid warehouse location: %w", err)
+		}
+		root := url.URL{Scheme: parsed.Scheme, User: parsed.User, Host: parsed.Host}
+		return &blobWarehouse{bucket: fsys, root: root.String() + "/"}, nil
+	default:
+		return nil, xerrors.Errorf("%T can not be used to write table metadata", fileIO)
+	}
+}
+
+func (c *hadoopCatalog) CatalogType() catalog.Type {
+	return catalog.Type(CatalogTypeHadoop)
+}
+
+func (c *hadoopCatalog) CreateTable(ctx context.Context, ident table.Identifier, schema *iceberg.Schema, opts ...catalog.CreateTableOpt) (*table.Table, error) {
+	dir := c.path(ident)
+	version, err := c.currentVersion(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	if version > 0 {
+		return nil, xerrors.Errorf("%w: %v", catalog.ErrTableAlreadyExists, ident)
+	}
+
+	var meta table.Metadata
+	if len(opts) == 0 {
+		meta, err = table.NewMetadata(schema, iceberg.UnpartitionedSpec, table.UnsortedSortOrder, dir, nil)
+	} else {
+		cfg := createTableConfig(opts[0])
+		for _, opt := range opts {
+			opt(cfg)
+		}
+		if cfg.Location != "" && strings.TrimSuffix(cfg.Location, "/") != dir {
+			return nil, xerrors.Errorf("hadoop catalog keeps table %v at %s, custom location %s is not supported", ident, dir, cfg.Location)
+		}
+		meta, err = table.NewMetadata(schema, cfg.PartitionSpec, cfg.SortOrder, dir, cfg.Properties)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("unable to build table metadata: %w", err)
+	}
+	if _, err := c.writeVersion(ctx, dir, 1, meta); err != nil {
+		if errors.Is(err, errHadoopCommitConflict) {
+			// another writer created the table since the version check
+			return nil, xerrors.Errorf("%w: %v", catalog.ErrTableAlreadyExists, ident)
+		}
+		return nil, err
+	}
+	return c.LoadTable(ctx, ident, nil)
+}
+
+// createTableConfig allocates the config catalog.CreateTableOpt functions fill, its type is internal to iceberg-go.
+func createTableConfig[T any](func(*T)) *T {
+	return new(T)
+}
+
+func (c *hadoopCatalog) CommitTable(ctx context.Context, tbl *table.Table, reqs []table.Requirement, updates []table.Update) (table.Metadata, string, error) {
+	dir := c.path(tbl.Identifier())
+	version, err := c.currentVersion(ctx, dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if version == 0 {
+		return nil, "", xerrors.Errorf("%w: %v", catalog.ErrNoSuchTable, tbl.Identifier())
+	}
+	location := c.metadataLocation(dir, version)
+	data, err := c.fs.read(ctx, location)
+	if err != nil {
+		return nil, "", xerrors.Errorf("read metadata: %w", err)
+	}
+	current, err := table.ParseMetadataBytes(data)
+	if err != nil {
+		return nil, "", xerrors.Errorf("parse metadata %s: %w", location, err)
+	}
+	updated, changed, err := updateMetadata(current, location, reqs, updates)
+	if err != nil || !changed {
+		return updated, location, err
+	}
+
+	location, err = c.writeVersion(ctx, dir, version+1, updated)
+	if err != nil {
+		return nil, "", err
+	}
+	return updated, location, nil
+}
+
+func (c *hadoopCatalog) ListTables(ctx context.Context, namespace table.Identifier) iter.Seq2[table.Identifier, error] {
+	return func(yield func(table.Identifier, error) bool) {
+		_, dirs, err := c.fs.list(ctx, c.path(namespace))
+		if err != nil {
+			yield(nil, xerrors.Errorf("list namespace %v: %w", namespace, err))
+			return
+		}
+		for _, name := range dirs {
+			ident := append(append(table.Identifier{}, namespace...), name)
+			version, err := c.currentVersion(ctx, c.path(ident))
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if version > 0 && !yield(ident, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c *hadoopCatalog) LoadTable(ctx context.Context, ident table.Identifier, _ iceberg.Properties) (*table.Table, error) {
+	dir := c.path(ident)
+	version, err := c.currentVersion(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, xerrors.Errorf("%w: %v", catalog.ErrNoSuchTable, ident)
+	}
+	return table.NewFromLocation(ident, c.metadataLocation(dir, version), c.fileIO, c)
+}
+
+// DropTable removes the metadata of the table, data files are kept because other tables may reference them.
+func (c *hadoopCatalog) DropTable(ctx context.Context, ident table.Identifier) error {
+	dir := c.path(ident)
+	version, err := c.currentVersion(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		return xerrors.Errorf("%w: %v", catalog.ErrNoSuchTable, ident)
+	}
+	if err := c.fs.remove(ctx, dir+"/metadata"); err != nil {
+		return xerrors.Errorf("remove metadata of %v: %w", ident, err)
+	}
+	// an empty table directory would keep its namespace from being dropped
+	files, dirs, err := c.fs.list(ctx, dir)
+	if err != nil {
+		return xerrors.Errorf("list table directory: %w", err)
+	}
+	if len(files) == 0 && len(dirs) == 0 {
+		return c.fs.remove(ctx, dir)
+	}
+	return nil
+}
+
+// RenameTable is not supported: the location of a table is its path, and the metadata references files under it.
+func (c *hadoopCatalog) RenameTable(_ context.Context, from, _ table.Identifier) (*table.Table, error) {
+	return nil, xerrors.Errorf("hadoop catalog can not rename table %v", from)
+}
+
+func (c *hadoopCatalog) ListNamespaces(ctx context.Context, parent table.Identifier) ([]table.Identifier, error) {
+	_, dirs, err := c.fs.list(ctx, c.path(parent))
+	if err != nil {
+		return nil, xerrors.Errorf("list namespace %v: %w", parent, err)
+	}
+	var namespaces []table.Identifier
+	for _, name := range dirs {
+		namespace := append(append(table.Identifier{}, parent...), name)
+		version, err := c.currentVersion(ctx, c.path(namespace))
+		if err != nil {
+			return nil, err
+		}
+		if version == 0 {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces, nil
+}
+
+// CreateNamespace creates the directory of namespace. On object storage directories exist only
+// while they contain files, so a namespace shows up once a table is created in it.
+func (c *hadoopCatalog) CreateNamespace(ctx context.Context, namespace table.Identifier, props iceberg.Properties) error {
+	if len(props) > 0 {
+		return xerrors.New("hadoop catalog does not support namespace properties")
+	}
+	exists, err := c.fs.exists(ctx, c.path(namespace))
+	if err != nil {
+		return err
+	}
+	if exists {
+		return xerrors.Errorf("%w: %v", catalog.ErrNamespaceAlreadyExists, namespace)
+	}
+	return c.fs.mkdir(ctx, c.path(namespace))
+}
+
+func (c *hadoopCatalog) DropNamespace(ctx context.Context, namespace table.Identifier) error {
+	dir := c.path(namespace)
+	exists, err := c.fs.exists(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return xerrors.Errorf("%w: %v", catalog.ErrNoSuchNamespace, namespace)
+	}
+	files, dirs, err := c.fs.list(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 || len(dirs) > 0 {
+		return xerrors.Errorf("%w: %v", catalog.ErrNamespaceNotEmpty, namespace)
+	}
+	return c.fs.remove(ctx, dir)
+}
+
+func (c *hadoopCatalog) LoadNamespaceProperties(ctx context.Context, namespace table.Identifier) (iceberg.Properties, error) {
+	dir := c.path(namespace)
+	exists, err := c.fs.exists(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, xerrors.Errorf("%w: %v", catalog.ErrNoSuchNamespace, namespace)
+	}
+	return iceberg.Properties{"location": dir}, nil
+}
+
+func (c *hadoopCatalog) UpdateNamespaceProperties(context.Context, table.Identifier, []string, iceberg.Properties) (catalog.PropertiesUpdateSummary, error) {
+	return catalog.PropertiesUpdateSummary{}, xerrors.New("hadoop catalog does not support namespace properties")
+}
+
+func (c *hadoopCatalog) path(ident table.Identifier) string {
+	if len(ident) == 0 {
+		return c.warehouse
+	}
+	return c.warehouse + "/" + strings.Join(ident, "/")
+}
+
+func (c *hadoopCatalog) metadataLocation(dir string, version int) string {
+	return fmt.Sprintf("%s/metadata/v%d.metadata.json", dir, version)
+}
+
+// currentVersion returns the latest metadata version of the table at dir, 0 if it is not a table.
+// The version hint is written after the metadata file, so versions past the hint are checked too.
+func (c *hadoopCatalog) currentVersion(ctx context.Context, dir string) (int, error) {
+	hint, err := c.fs.read(ctx, dir+"/metadata/"+hadoopVersionHintFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, xerrors.Errorf("read version hint: %w", err)
+	}
+	if version, parseErr := strconv.Atoi(strings.TrimSpace(string(hint))); err == nil && parseErr == nil && version > 0 {
+		for {
+			exists, err := c.fs.exists(ctx, c.metadataLocation(dir, version+1))
+			if err != nil {
+				return 0, err
+			}
+			if !exists {
+				return version, nil
+			}
+			version++
+		}
+	}
+
+	files, _, err := c.fs.list(ctx, dir+"/metadata")
+	if err != nil {
+		return 0, xerrors.Errorf("list metadata: %w", err)
+	}
+	version := 0
+	for _, name := range files {
+		if m := hadoopMetadataFileRe.FindStringSubmatch(name); m != nil {
+			if v, err := strconv.Atoi(m[1]); err == nil && v > version {
+				version = v
+			}
+		}
+	}
+	return version, nil
+}
+
+// writeVersion writes metadata as version of the table at dir and points the version hint to it.
+func (c *hadoopCatalog) writeVersion(ctx context.Context, dir string, version int, meta table.Metadata) (string, error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return "", xerrors.Errorf("marshal metadata: %w", err)
+	}
+	location := c.metadataLocation(dir, version)
+	if err := c.fs.create(ctx, location, data); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return "", xerrors.Errorf("commit v%d of %s: %w", version, dir, errHadoopCommitConflict)
+		}
+		return "", xerrors.Errorf("write metadata: %w", err)
+	}
+	if err := c.fs.replace(ctx, dir+"/metadata/"+hadoopVersionHintFile, []byte(strconv.Itoa(version))); err != nil {
+		return "", xerrors.Errorf("write version hint: %w", err)
+	}
+	return location, nil
+}
+
+// warehouseFS is the storage of the hadoop catalog, paths are full locations under the warehouse.
+type warehouseFS interface {
+	read(ctx context.Context, path string) ([]byte, error)
+	// create writes a new file, it fails with fs.ErrExist if the file exists.
+	create(ctx context.Context, path string, data []byte) error
+	replace(ctx context.Context, path string, data []byte) error
+	exists(ctx context.Context, path string) (bool, error)
+	// list returns names of files and directories right under dir.
+	list(ctx context.Context, dir string) (files, dirs []string, err error)
+	mkdir(ctx context.Context, dir string) error
+	remove(ctx context.Context, path string) error
+}
+
+type localWarehouse struct{}
+
+func (localWarehouse) osPath(p string) string {
+	return strings.TrimPrefix(p, "file://")
+}
+
+func (w localWarehouse) read(_ context.Context, p string) ([]byte, error) {
+	return os.ReadFile(w.osPath(p))
+}
+
+// create writes data to a temporary file and links it to p, the link fails if p exists.
+func (w localWarehouse) create(_ context.Context, p string, data []byte) error {
+	tmp, err := w.writeTemp(w.osPath(p), data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return os.Link(tmp, w.osPath(p))
+}
+
+// replace writes data to a temporary file and renames it to p, so readers see either old or new content.
+func (w localWarehouse) replace(_ context.Context, p string, data []byte) error {
+	tmp, err := w.writeTemp(w.osPath(p), data)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, w.osPath(p)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (localWarehouse) writeTemp(p string, data []byte) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+"-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func (w localWarehouse) exists(_ context.Context, p string) (bool, error) {
+	_, err := os.Stat(w.osPath(p))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (w localWarehouse) list(_ context.Context, dir string) ([]string, []string, error) {
+	entries, err := os.ReadDir(w.osPath(dir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var files, dirs []string
+	for _, entry := range entries {
+		switch {
+		case strings.HasPrefix(entry.Name(), "."):
+		case entry.IsDir():
+			dirs = append(dirs, entry.Name())
+		default:
+			files = append(files, entry.Name())
+		}
+	}
+	return files, dirs, nil
+}
+
+func (w localWarehouse) mkdir(_ context.Context, dir string) error {
+	return os.MkdirAll(w.osPath(dir), 0o755)
+}
+
+func (w localWarehouse) remove(_ context.Context, p string) error {
+	return os.RemoveAll(w.osPath(p))
+}
+
+// objectBucket is implemented by the object storage FileIO of iceberg-go, which embeds *blob.Bucket.
+type objectBucket interface {
+	ReadAll(ctx context.Context, key string) ([]byte, error)
+	WriteAll(ctx context.Context, key string, p []byte, opts *blob.WriterOptions) error
+	Exists(ctx context.Context, key string) (bool, error)
+	List(opts *blob.ListOptions) *blob.ListIterator
+	Delete(ctx context.Context, key string) error
+}
+
+type blobWarehouse struct {
+	bucket objectBucket
+	root   string
+}
+
+func (w *blobWarehouse) key(p string) string {
+	return strings.TrimPrefix(p, w.root)
+}
+
+func (w *blobWarehouse) read(ctx context.Context, p string) ([]byte, error) {
+	data, err := w.bucket.ReadAll(ctx, w.key(p))
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, xerrors.Errorf("%s: %w", p, fs.ErrNotExist)
+	}
+	return data, err
+}
+
+// create checks that p is missing before writing it, which is not atomic.
+func (w *blobWarehouse) create(ctx context.Context, p string, data []byte) error {
+	exists, err := w.bucket.Exists(ctx, w.key(p))
+	if err != nil {
+		return err
+	}
+	if exists {
+		return xerrors.Errorf("%s: %w", p, fs.ErrExist)
+	}
+	return w.bucket.WriteAll(ctx, w.key(p), data, nil)
+}
+
+func (w *blobWarehouse) replace(ctx context.Context, p string, data []byte) error {
+	return w.bucket.WriteAll(ctx, w.key(p), data, nil)
+}
+
+func (w *blobWarehouse) exists(ctx context.Context, p string) (bool, error) {
+	exists, err := w.bucket.Exists(ctx, w.key(p))
+	if err != nil || exists {
+		return exists, err
+	}
+	_, err = w.bucket.List(&blob.ListOptions{Prefix: w.key(p) + "/"}).Next(ctx)
+	if errors.Is(err, goio.EOF) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (w *blobWarehouse) list(ctx context.Context, dir string) ([]string, []string, error) {
+	var files, dirs []string
+	it := w.bucket.List(&blob.ListOptions{Prefix: w.key(dir) + "/", Delimiter: "/"})
+	for {
+		obj, err := it.Next(ctx)
+		if errors.Is(err, goio.EOF) {
+			return files, dirs, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		name := path.Base(strings.TrimSuffix(obj.Key, "/"))
+		switch {
+		case strings.HasPrefix(name, "."):
+		case obj.IsDir:
+			dirs = append(dirs, name)
+		default:
+			files = append(files, name)
+		}
+	}
+}
+
+func (w *blobWarehouse) mkdir(context.Context, string) error {
+	return nil
+}
+
+func (w *blobWarehouse) remove(ctx context.Context, p string) error {
+	it := w.bucket.List(&blob.ListOptions{Prefix: w.key(p) + "/"})
+	for {
+		obj, err := it.Next(ctx)
+		if errors.Is(err, goio.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.bucket.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package iceberg
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob/memblob"
+)
+
+func TestHadoopCatalog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cat, err := newCatalog(ctx, CatalogTypeHadoop, "file://"+dir, nil)
+	require.NoError(t, err)
+
+	ident := table.Identifier{"db", "events"}
+	require.NoError(t, ensureNamespace(ctx, cat, ident))
+	require.ErrorIs(t, cat.CreateNamespace(ctx, table.Identifier{"db"}, nil), catalog.ErrNamespaceAlreadyExists)
+
+	schema := iceberg.NewSchema(0, iceberg.NestedField{ID: 1, Name: "id", Type: iceberg.PrimitiveTypes.Int64, Required: true})
+	tbl, err := cat.CreateTable(ctx, ident, schema, catalog.WithProperties(iceberg.Properties{"owner": "etl"}))
+	require.NoError(t, err)
+	require.Equal(t, "file://"+dir+"/db/events", tbl.Location())
+	require.Equal(t, "etl", tbl.Properties()["owner"])
+	_, err = cat.CreateTable(ctx, ident, schema)
+	require.ErrorIs(t, err, catalog.ErrTableAlreadyExists)
+
+	meta, location, err := cat.CommitTable(ctx, tbl,
+		[]table.Requirement{table.AssertTableUUID(tbl.Metadata().TableUUID())},
+		[]table.Update{table.NewSetPropertiesUpdate(iceberg.Properties{"k": "v"})})
+	require.NoError(t, err)
+	require.Equal(t, "file://"+dir+"/db/events/metadata/v2.metadata.json", location)
+	require.Equal(t, "v", meta.Properties()["k"])
+	require.Len(t, slices.Collect(meta.PreviousFiles()), 1)
+	hint, err := os.ReadFile(filepath.Join(dir, "db/events/metadata", hadoopVersionHintFile))
+	require.NoError(t, err)
+	require.Equal(t, "2", string(hint))
+
+	_, _, err = cat.CommitTable(ctx, tbl, []table.Requirement{table.AssertCurrentSchemaID(5)}, nil)
+	require.Error(t, err)
+
+	// a writer that failed between the metadata file and the version hint
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db/events/metadata", hadoopVersionHintFile), []byte("1"), 0o644))
+	tbl, err = cat.LoadTable(ctx, ident, nil)
+	require.NoError(t, err)
+	require.Equal(t, location, tbl.MetadataLocation())
+
+	var tables []table.Identifier
+	for ident, err := range cat.ListTables(ctx, table.Identifier{"db"}) {
+		require.NoError(t, err)
+		tables = append(tables, ident)
+	}
+	require.Equal(t, []table.Identifier{ident}, tables)
+	namespaces, err := cat.ListNamespaces(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []table.Identifier{{"db"}}, namespaces)
+
+	_, err = cat.RenameTable(ctx, ident, table.Identifier{"db", "renamed"})
+	require.Error(t, err)
+	require.ErrorIs(t, cat.DropNamespace(ctx, table.Identifier{"db"}), catalog.ErrNamespaceNotEmpty)
+	require.NoError(t, cat.DropTable(ctx, ident))
+	_, err = cat.LoadTable(ctx, ident, nil)
+	require.ErrorIs(t, err, catalog.ErrNoSuchTable)
+	require.NoError(t, cat.DropNamespace(ctx, table.Identifier{"db"}))
+	_, err = cat.LoadNamespaceProperties(ctx, table.Identifier{"db"})
+	require.ErrorIs(t, err, catalog.ErrNoSuchNamespace)
+}
+
+func TestWarehouseFS(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, wfs := range map[string]warehouseFS{
+		"local": localWarehouse{},
+		"blob":  &blobWarehouse{bucket: memblob.OpenBucket(nil), root: "mem://bucket/"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			root := "file://" + filepath.Join(dir, name)
+			if name == "blob" {
+				root = "mem://bucket/wh"
+			}
+
+			require.NoError(t, wfs.create(ctx, root+"/t/metadata/v1.metadata.json", []byte("{}")))
+			require.ErrorIs(t, wfs.create(ctx, root+"/t/metadata/v1.metadata.json", []byte("{}")), fs.ErrExist)
+			require.NoError(t, wfs.replace(ctx, root+"/t/metadata/"+hadoopVersionHintFile, []byte("1")))
+			require.NoError(t, wfs.replace(ctx, root+"/t/metadata/"+hadoopVersionHintFile, []byte("2")))
+			data, err := wfs.read(ctx, root+"/t/metadata/"+hadoopVersionHintFile)
+			require.NoError(t, err)
+			require.Equal(t, "2", string(data))
+			_, err = wfs.read(ctx, root+"/t/metadata/v2.metadata.json")
+			require.ErrorIs(t, err, fs.ErrNotExist)
+
+			exists, err := wfs.exists(ctx, root+"/t")
+			require.NoError(t, err)
+			require.True(t, exists)
+			files, dirs, err := wfs.list(ctx, root+"/t/metadata")
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{"v1.metadata.json", hadoopVersionHintFile}, files)
+			require.Empty(t, dirs)
+			_, dirs, err = wfs.list(ctx, root)
+			require.NoError(t, err)
+			require.Equal(t, []string{"t"}, dirs)
+
+			require.NoError(t, wfs.remove(ctx, root+"/t"))
+			exists, err = wfs.exists(ctx, root+"/t")
+			require.NoError(t, err)
+			require.False(t, exists)
+		})
+	}
+}
+
+// racingWarehouse creates a file right before each create, as a concurrent writer would.
+type racingWarehouse struct {
+	warehouseFS
+}
+
+func (w racingWarehouse) create(ctx context.Context, p string, data []byte) error {
+	if err := w.warehouseFS.create(ctx, p, data); err != nil {
+		return err
+	}
+	return w.warehouseFS.create(ctx, p, data)
+}
+
+func TestHadoopCatalogCreateTableRace(t *testing.T) {
+	ctx := context.Background()
+	cat, err := newHadoopCatalog(ctx, "file://"+t.TempDir(), nil)
+	require.NoError(t, err)
+	cat.fs = racingWarehouse{warehouseFS: cat.fs}
+
+	schema := iceberg.NewSchema(0, iceberg.NestedField{ID: 1, Name: "id", Type: iceberg.PrimitiveTypes.Int64, Required: true})
+	_, err = cat.CreateTable(ctx, table.Identifier{"db", "events"}, schema)
+	require.ErrorIs(t, err, catalog.ErrTableAlreadyExists)
+}
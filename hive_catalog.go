@@ -0,0 +1,599 @@
+package iceberg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"os"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/table"
+	"github.com/google/uuid"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+const (
+	hiveLockTimeoutKey     = "hive.lock-timeout"
+	hiveDefaultLockTimeout = 3 * time.Minute
+	hiveClientTimeout      = time.Minute
+
+	hiveTableTypeParam        = "table_type"
+	hiveMetadataLocationParam = "metadata_location"
+	hivePreviousLocationParam = "previous_metadata_location"
+	hiveIcebergTableType      = "ICEBERG"
+)
+
+var (
+	_ catalog.Catalog = (*hiveCatalog)(nil)
+
+	errHiveCommitConflict = xerrors.New("table metadata was changed by another writer")
+)
+
+func init() {
+	catalog.Register(CatalogTypeHive, catalog.RegistrarFunc(func(ctx context.Context, _ string, props iceberg.Properties) (catalog.Catalog, error) {
+		return newHiveCatalog(ctx, props.Get("uri", ""), props)
+	}))
+}
+
+// hiveCatalog keeps tables in a Hive Metastore, as the Hive catalog of Iceberg does.
+//
+// A table is an external HMS table with table_type=ICEBERG, its metadata_location parameter points to the current
+// metadata file. A commit takes an exclusive HMS lock on the table, writes the next metadata file and swaps the
+// pointer with alter_table, so concurrent writers, including other Iceberg engines, never lose each other's commits.
+// Namespaces are HMS databases, there is a single level of them.
+type hiveCatalog struct {
+	client      *hmsClient
+	props       iceberg.Properties
+	warehouse   string
+	lockTimeout time.Duration
+}
+
+// newHiveCatalog connects to the metastore at uri, "thrift://host:port" or "host:port".
+// Tables created in databases without a location go under the "warehouse" property.
+func newHiveCatalog(_ context.Context, uri string, props iceberg.Properties) (*hiveCatalog, error) {
+	address := strings.TrimPrefix(uri, "thrift://")
+	if address == "" {
+		return nil, xerrors.New("metastore URI is required for the hive catalog")
+	}
+	lockTimeout := hiveDefaultLockTimeout
+	if v, ok := props[hiveLockTimeoutKey]; ok {
+		var err error
+		if lockTimeout, err = time.ParseDuration(v); err != nil {
+			return nil, xerrors.Errorf("invalid %s: %w", hiveLockTimeoutKey, err)
+		}
+	}
+	client, err := newHMSClient(address, hiveClientTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &hiveCatalog{
+		client:      client,
+		props:       props,
+		warehouse:   strings.TrimSuffix(props.Get("warehouse", ""), "/"),
+		lockTimeout: lockTimeout,
+	}, nil
+}
+
+func (c *hiveCatalog) Close() error {
+	return c.client.Close()
+}
+
+func (c *hiveCatalog) CatalogType() catalog.Type {
+	return catalog.Hive
+}
+
+func (c *hiveCatalog) CreateTable(ctx context.Context, ident table.Identifier, schema *iceberg.Schema, opts ...catalog.CreateTableOpt) (*table.Table, error) {
+	dbName, tableName, err := hiveTableName(ident)
+	if err != nil {
+		return nil, err
+	}
+	db, err := c.client.getDatabase(ctx, dbName)
+	if err != nil {
+		return nil, hiveNamespaceError(err, ident[:1])
+	}
+
+	var (
+		location = c.tableLocation(db, tableName)
+		meta     table.Metadata
+	)
+	if len(opts) == 0 {
+		meta, err = table.NewMetadata(schema, iceberg.UnpartitionedSpec, table.UnsortedSortOrder, location, nil)
+	} else {
+		cfg := createTableConfig(opts[0])
+		for _, opt := range opts {
+			opt(cfg)
+		}
+		if cfg.Location != "" {
+			location = strings.TrimSuffix(cfg.Location, "/")
+		}
+		meta, err = table.NewMetadata(schema, cfg.PartitionSpec, cfg.SortOrder, location, cfg.Properties)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("unable to build table metadata: %w", err)
+	}
+	metadataLocation, err := c.writeMetadata(ctx, location, 0, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	now := int32(time.Now().Unix())
+	err = c.client.createTable(ctx, &hmsTable{
+		TableName:  tableName,
+		DBName:     dbName,
+		Owner:      hiveUser(),
+		CreateTime: now,
+		Sd: &hmsStorageDescriptor{
+			Cols:         hiveColumns(schema),
+			Location:     location,
+			InputFormat:  "org.apache.iceberg.mr.hive.HiveIcebergInputFormat",
+			OutputFormat: "org.apache.iceberg.mr.hive.HiveIcebergOutputFormat",
+			SerdeInfo:    &hmsSerDeInfo{SerializationLib: "org.apache.iceberg.mr.hive.HiveIcebergSerDe", Parameters: map[string]string{}},
+			BucketCols:   []string{},
+			Parameters:   map[string]string{},
+		},
+		PartitionKeys: []hmsFieldSchema{},
+		Parameters: map[string]string{
+			"EXTERNAL":                "TRUE",
+			hiveTableTypeParam:        hiveIcebergTableType,
+			hiveMetadataLocationParam: metadataLocation,
+		},
+		TableType: "EXTERNAL_TABLE",
+	})
+	switch {
+	case errors.Is(err, errHMSAlreadyExists):
+		return nil, xerrors.Errorf("%w: %v", catalog.ErrTableAlreadyExists, ident)
+	case errors.Is(err, errHMSNoSuchObject):
+		return nil, xerrors.Errorf("%w: %v", catalog.ErrNoSuchNamespace, ident[:1])
+	case err != nil:
+		return nil, err
+	}
+	return c.LoadTable(ctx, ident, nil)
+}
+
+// CommitTable applies updates under an exclusive lock of the table, reqs are checked against
+// the metadata the metastore points to once the lock is held.
+func (c *hiveCatalog) CommitTable(ctx context.Context, tbl *table.Table, reqs []table.Requirement, updates []table.Update) (table.Metadata, string, error) {
+	dbName, tableName, err := hiveTableName(tbl.Identifier())
+	if err != nil {
+		return nil, "", err
+	}
+	lockID, err := c.lock(ctx, dbName, tableName)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		// a failed unlock is released by the metastore once the lock times out
+		_ = c.client.unlock(context.Background(), lockID)
+	}()
+
+	hmsTbl, err := c.getIcebergTable(ctx, tbl.Identifier())
+	if err != nil {
+		return nil, "", err
+	}
+	base := hmsTbl.Parameters[hiveMetadataLocationParam]
+	current, err := c.readMetadata(ctx, base)
+	if err != nil {
+		return nil, "", err
+	}
+	updated, changed, err := updateMetadata(current, base, reqs, updates)
+	if err != nil || !changed {
+		return updated, base, err
+	}
+	location, err := c.writeMetadata(ctx, updated.Location(), hiveMetadataVersion(base)+1, updated)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the lock is held, but an engine that commits without locks may still have moved the pointer
+	latest, err := c.client.getTable(ctx, dbName, tableName)
+	if err != nil {
+		return nil, "", err
+	}
+	if latest.Parameters[hiveMetadataLocationParam] != base {
+		return nil, "", xerrors.Errorf("commit %v: %w", tbl.Identifier(), errHiveCommitConflict)
+	}
+	hmsTbl.Parameters[hiveMetadataLocationParam] = location
+	hmsTbl.Parameters[hivePreviousLocationParam] = base
+	if hmsTbl.Sd != nil {
+		hmsTbl.Sd.Cols = hiveColumns(updated.CurrentSchema())
+	}
+	if err := c.client.alterTable(ctx, dbName, tableName, hmsTbl); err != nil {
+		return nil, "", xerrors.Errorf("swap metadata location of %v: %w", tbl.Identifier(), err)
+	}
+	return updated, location, nil
+}
+
+// lock takes an exclusive lock of the table, waiting for other holders up to the lock timeout.
+func (c *hiveCatalog) lock(ctx context.Context, dbName, tableName string) (int64, error) {
+	hostname, _ := os.Hostname()
+	resp, err := c.client.lock(ctx, &hmsLockRequest{
+		Components: []hmsLockComponent{{Type: hmsLockTypeExclusive, Level: hmsLockLevelTable, DBName: dbName, TableName: tableName}},
+		User:       hiveUser(),
+		Hostname:   hostname,
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("lock %s.%s: %w", dbName, tableName, err)
+	}
+	deadline := time.Now().Add(c.lockTimeout)
+	wait := 50 * time.Millisecond
+	for resp.State == hmsLockWaiting {
+		if time.Now().After(deadline) {
+			_ = c.client.unlock(ctx, resp.LockID)
+			return 0, xerrors.Errorf("lock %s.%s: not acquired in %v", dbName, tableName, c.lockTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			_ = c.client.unlock(context.Background(), resp.LockID)
+			return 0, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, 5*time.Second)
+		if resp, err = c.client.checkLock(ctx, resp.LockID); err != nil {
+			return 0, xerrors.Errorf("check lock of %s.%s: %w", dbName, tableName, err)
+		}
+	}
+	if resp.State != hmsLockAcquired {
+		return 0, xerrors.Errorf("lock %s.%s: lock state %d", dbName, tableName, resp.State)
+	}
+	return resp.LockID, nil
+}
+
+func (c *hiveCatalog) ListTables(ctx context.Context, namespace table.Identifier) iter.Seq2[table.Identifier, error] {
+	return func(yield func(table.Identifier, error) bool) {
+		if len(namespace) != 1 {
+			yield(nil, xerrors.Errorf("%w: %v", catalog.ErrNoSuchNamespace, namespace))
+			return
+		}
+		names, err := c.client.getAllTables(ctx, namespace[0])
+		if err != nil {
+			yield(nil, xerrors.Errorf("list tables of %v: %w", namespace, err))
+			return
+		}
+		for _, name := range names {
+			tbl, err := c.client.getTable(ctx, namespace[0], name)
+			if errors.Is(err, errHMSNoSuchObject) {
+				continue
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if isHiveIcebergTable(tbl) && !yield(table.Identifier{namespace[0], name}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c *hiveCatalog) LoadTable(ctx context.Context, ident table.Identifier, props iceberg.Properties) (*table.Table, error) {
+	hmsTbl, err := c.getIcebergTable(ctx, ident)
+	if err != nil {
+		return nil, err
+	}
+	location := hmsTbl.Parameters[hiveMetadataLocationParam]
+	ioProps := iceberg.Properties{}
+	maps.Copy(ioProps, c.props)
+	maps.Copy(ioProps, props)
+	fileIO, err := loadFS(ctx, ioProps, location)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init IO of %v: %w", ident, err)
+	}
+	return table.NewFromLocation(ident, location, fileIO, c)
+}
+
+// DropTable removes the table from the metastore, its files are kept.
+func (c *hiveCatalog) DropTable(ctx context.Context, ident table.Identifier) error {
+	if _, err := c.getIcebergTable(ctx, ident); err != nil {
+		return err
+	}
+	if err := c.client.dropTable(ctx, ident[0], ident[1]); err != nil {
+		if errors.Is(err, errHMSNoSuchObject) {
+			return xerrors.Errorf("%w: %v", catalog.ErrNoSuchTable, ident)
+		}
+		return err
+	}
+	return nil
+}
+
+// RenameTable changes the name of the table in the metastore, its location stays the same.
+func (c *hiveCatalog) RenameTable(ctx context.Context, from, to table.Identifier) (*table.Table, error) {
+	hmsTbl, err := c.getIcebergTable(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	toDB, toName, err := hiveTableName(to)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.client.getDatabase(ctx, toDB); err != nil {
+		return nil, hiveNamespaceError(err, to[:1])
+	}
+	if _, err := c.client.getTable(ctx, toDB, toName); err == nil {
+		return nil, xerrors.Errorf("%w: %v", catalog.ErrTableAlreadyExists, to)
+	} else if !errors.Is(err, errHMSNoSuchObject) {
+		return nil, err
+	}
+	hmsTbl.DBName, hmsTbl.TableName = toDB, toName
+	if err := c.client.alterTable(ctx, from[0], from[1], hmsTbl); err != nil {
+		return nil, xerrors.Errorf("rename %v to %v: %w", from, to, err)
+	}
+	return c.LoadTable(ctx, to, nil)
+}
+
+func (c *hiveCatalog) ListNamespaces(ctx context.Context, parent table.Identifier) ([]table.Identifier, error) {
+	if len(parent) > 0 {
+		return nil, nil
+	}
+	names, err := c.client.getAllDatabases(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("list databases: %w", err)
+	}
+	namespaces := make([]table.Identifier, 0, len(names))
+	for _, name := range names {
+		namespaces = append(namespaces, table.Identifier{name})
+	}
+	return namespaces, nil
+}
+
+// CreateNamespace creates a database, "location" and "comment" properties become its location and description.
+func (c *hiveCatalog) CreateNamespace(ctx context.Context, namespace table.Identifier, props iceberg.Properties) error {
+	if len(namespace) != 1 {
+		return xerrors.Errorf("hive catalog supports a single level of namespaces, got %v", namespace)
+	}
+	db := &hmsDatabase{Name: namespace[0], Parameters: map[string]string{}}
+	for k, v := range props {
+		switch k {
+		case "location":
+			db.LocationURI = v
+		case "comment":
+			db.Description = v
+		default:
+			db.Parameters[k] = v
+		}
+	}
+	if db.LocationURI == "" && c.warehouse != "" {
+		db.LocationURI = c.warehouse + "/" + namespace[0] + ".db"
+	}
+	if err := c.client.createDatabase(ctx, db); err != nil {
+		if errors.Is(err, errHMSAlreadyExists) {
+			return xerrors.Errorf("%w: %v", catalog.ErrNamespaceAlreadyExists, namespace)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *hiveCatalog) DropNamespace(ctx context.Context, namespace table.Identifier) error {
+	if len(namespace) != 1 {
+		return xerrors.Errorf("%w: %v", catalog.ErrNoSuchNamespace, namespace)
+	}
+	err := c.client.dropDatabase(ctx, namespace[0])
+	switch {
+	case errors.Is(err, errHMSNoSuchObject):
+		return xerrors.Errorf("%w: %v", catalog.ErrNoSuchNamespace, namespace)
+	case errors.Is(err, errHMSInvalidOperation):
+		return xerrors.Errorf("%w: %v", catalog.ErrNamespaceNotEmpty, namespace)
+	}
+	return err
+}
+
+func (c *hiveCatalog) LoadNamespaceProperties(ctx context.Context, namespace table.Identifier) (iceberg.Properties, error) {
+	if len(namespace) != 1 {
+		return nil, xerrors.Errorf("%w: %v", catalog.ErrNoSuchNamespace, namespace)
+	}
+	db, err := c.client.getDatabase(ctx, namespace[0])
+	if err != nil {
+		return nil, hiveNamespaceError(err, namespace)
+	}
+	props := iceberg.Properties{}
+	maps.Copy(props, db.Parameters)
+	if db.LocationURI != "" {
+		props["location"] = db.LocationURI
+	}
+	if db.Description != "" {
+		props["comment"] = db.Description
+	}
+	return props, nil
+}
+
+func (c *hiveCatalog) UpdateNamespaceProperties(ctx context.Context, namespace table.Identifier, removals []string, updates iceberg.Properties) (catalog.PropertiesUpdateSummary, error) {
+	var summary catalog.PropertiesUpdateSummary
+	if len(namespace) != 1 {
+		return summary, xerrors.Errorf("%w: %v", catalog.ErrNoSuchNamespace, namespace)
+	}
+	db, err := c.client.getDatabase(ctx, namespace[0])
+	if err != nil {
+		return summary, hiveNamespaceError(err, namespace)
+	}
+	if db.Parameters == nil {
+		db.Parameters = map[string]string{}
+	}
+	for _, k := range removals {
+		switch _, ok := db.Parameters[k]; {
+		case k == "comment" && db.Description != "":
+			db.Description = ""
+		case ok:
+			delete(db.Parameters, k)
+		default:
+			summary.Missing = append(summary.Missing, k)
+			continue
+		}
+		summary.Removed = append(summary.Removed, k)
+	}
+	for k, v := range updates {
+		switch k {
+		case "location":
+			db.LocationURI = v
+		case "comment":
+			db.Description = v
+		default:
+			db.Parameters[k] = v
+		}
+		summary.Updated = append(summary.Updated, k)
+	}
+	if err := c.client.alterDatabase(ctx, namespace[0], db); err != nil {
+		return catalog.PropertiesUpdateSummary{}, hiveNamespaceError(err, namespace)
+	}
+	return summary, nil
+}
+
+func (c *hiveCatalog) getIcebergTable(ctx context.Context, ident table.Identifier) (*hmsTable, error) {
+	dbName, tableName, err := hiveTableName(ident)
+	if err != nil {
+		return nil, err
+	}
+	tbl, err := c.client.getTable(ctx, dbName, tableName)
+	if errors.Is(err, errHMSNoSuchObject) {
+		return nil, xerrors.Errorf("%w: %v", catalog.ErrNoSuchTable, ident)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isHiveIcebergTable(tbl) {
+		return nil, xerrors.Errorf("%v is not an iceberg table", ident)
+	}
+	if tbl.Parameters[hiveMetadataLocationParam] == "" {
+		return nil, xerrors.Errorf("%v has no %s", ident, hiveMetadataLocationParam)
+	}
+	return tbl, nil
+}
+
+func (c *hiveCatalog) tableLocation(db *hmsDatabase, tableName string) string {
+	if db.LocationURI != "" {
+		return strings.TrimSuffix(db.LocationURI, "/") + "/" + tableName
+	}
+	return c.warehouse + "/" + db.Name + ".db/" + tableName
+}
+
+func (c *hiveCatalog) readMetadata(ctx context.Context, location string) (table.Metadata, error) {
+	wfs, err := c.warehouseFS(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	data, err := wfs.read(ctx, location)
+	if err != nil {
+		return nil, xerrors.Errorf("read metadata: %w", err)
+	}
+	meta, err := table.ParseMetadataBytes(data)
+	if err != nil {
+		return nil, xerrors.Errorf("parse metadata %s: %w", location, err)
+	}
+	return meta, nil
+}
+
+// writeMetadata writes meta as <table location>/metadata/<version>-<uuid>.metadata.json, the name Iceberg uses.
+func (c *hiveCatalog) writeMetadata(ctx context.Context, tableLocation string, version int, meta table.Metadata) (string, error) {
+	location := fmt.Sprintf("%s/metadata/%05d-%s.metadata.json", strings.TrimSuffix(tableLocation, "/"), version, uuid.NewString())
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return "", xerrors.Errorf("marshal metadata: %w", err)
+	}
+	wfs, err := c.warehouseFS(ctx, location)
+	if err != nil {
+		return "", err
+	}
+	if err := wfs.create(ctx, location, data); err != nil {
+		return "", xerrors.Errorf("write metadata: %w", err)
+	}
+	return location, nil
+}
+
+func (c *hiveCatalog) warehouseFS(ctx context.Context, location string) (warehouseFS, error) {
+	fileIO, err := loadFS(ctx, c.props, location)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init IO of %s: %w", location, err)
+	}
+	return newWarehouseFS(fileIO, location)
+}
+
+func hiveTableName(ident table.Identifier) (string, string, error) {
+	if len(ident) != 2 {
+		return "", "", xerrors.Errorf("hive catalog tables are identified as <database>.<table>, got %v", ident)
+	}
+	return ident[0], ident[1], nil
+}
+
+func hiveNamespaceError(err error, namespace table.Identifier) error {
+	if errors.Is(err, errHMSNoSuchObject) {
+		return xerrors.Errorf("%w: %v", catalog.ErrNoSuchNamespace, namespace)
+	}
+	return err
+}
+
+func isHiveIcebergTable(tbl *hmsTable) bool {
+	return strings.EqualFold(tbl.Parameters[hiveTableTypeParam], hiveIcebergTableType)
+}
+
+// hiveMetadataVersion parses the version of a metadata file written by writeMetadata, -1 for other names.
+func hiveMetadataVersion(location string) int {
+	prefix, _, ok := strings.Cut(path.Base(location), "-")
+	if !ok {
+		return -1
+	}
+	version, err := strconv.Atoi(prefix)
+	if err != nil {
+		return -1
+	}
+	return version
+}
+
+// hiveColumns describes schema for engines that read the columns of the table from the metastore.
+func hiveColumns(schema *iceberg.Schema) []hmsFieldSchema {
+	cols := make([]hmsFieldSchema, 0, len(schema.Fields()))
+	for _, field := range schema.Fields() {
+		cols = append(cols, hmsFieldSchema{Name: field.Name, Type: hiveType(field.Type), Comment: field.Doc})
+	}
+	return cols
+}
+
+func hiveType(typ iceberg.Type) string {
+	switch t := typ.(type) {
+	case iceberg.BooleanType:
+		return "boolean"
+	case iceberg.Int32Type:
+		return "int"
+	case iceberg.Int64Type:
+		return "bigint"
+	case iceberg.Float32Type:
+		return "float"
+	case iceberg.Float64Type:
+		return "double"
+	case iceberg.DateType:
+		return "date"
+	case iceberg.TimestampType, iceberg.TimestampTzType:
+		return "timestamp"
+	case iceberg.DecimalType:
+		return fmt.Sprintf("decimal(%d,%d)", t.Precision(), t.Scale())
+	case iceberg.BinaryType, iceberg.FixedType:
+		return "binary"
+	case *iceberg.ListType:
+		return "array<" + hiveType(t.Element) + ">"
+	case *iceberg.MapType:
+		return "map<" + hiveType(t.KeyType) + "," + hiveType(t.ValueType) + ">"
+	case *iceberg.StructType:
+		fields := make([]string, 0, len(t.FieldList))
+		for _, f := range t.FieldList {
+			fields = append(fields, f.Name+":"+hiveType(f.Type))
+		}
+		return "struct<" + strings.Join(fields, ",") + ">"
+	default:
+		return "string"
+	}
+}
+
+func hiveUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "transferia"
+}
@@ -0,0 +1,339 @@
+package iceberg
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/table"
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMetastore serves the metastore methods used by hiveCatalog from memory.
+type fakeMetastore struct {
+	mu       sync.Mutex
+	dbs      map[string]*hmsDatabase
+	tables   map[string]*hmsTable
+	locks    map[int64]string
+	nextLock int64
+}
+
+func startFakeMetastore(t *testing.T) (*fakeMetastore, string) {
+	ms := &fakeMetastore{dbs: map[string]*hmsDatabase{}, tables: map[string]*hmsTable{}, locks: map[int64]string{}}
+	sock, err := thrift.NewTServerSocket("127.0.0.1:0")
+	require.NoError(t, err)
+	server := thrift.NewTSimpleServer4(ms, sock, thrift.NewTBufferedTransportFactory(1<<16), thrift.NewTBinaryProtocolFactoryConf(nil))
+	require.NoError(t, server.Listen())
+	go func() { _ = server.AcceptLoop() }()
+	t.Cleanup(func() { _ = server.Stop() })
+	return ms, "thrift://" + sock.Addr().String()
+}
+
+func (m *fakeMetastore) ProcessorMap() map[string]thrift.TProcessorFunction { return nil }
+
+func (m *fakeMetastore) AddToProcessorMap(string, thrift.TProcessorFunction) {}
+
+func (m *fakeMetastore) Process(ctx context.Context, in, out thrift.TProtocol) (bool, thrift.TException) {
+	method, _, seq, err := in.ReadMessageBegin(ctx)
+	if err != nil {
+		return false, thrift.WrapTException(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch method {
+	case "get_database":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsGetDatabaseArgs) (r hmsResult[*hmsDatabase]) {
+			if r.Success = m.dbs[args.Name]; r.Success == nil {
+				r.E1 = &hmsException{Message: args.Name}
+			}
+			return r
+		})
+	case "get_all_databases":
+		err = serveFake(ctx, in, out, method, seq, func(*hmsGetAllDatabasesArgs) (r hmsResult[[]string]) {
+			r.Success = slices.Sorted(maps.Keys(m.dbs))
+			return r
+		})
+	case "create_database":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsCreateDatabaseArgs) (r hmsResult[struct{}]) {
+			if m.dbs[args.Database.Name] != nil {
+				r.E1 = &hmsException{Message: args.Database.Name}
+			} else {
+				m.dbs[args.Database.Name] = args.Database
+			}
+			return r
+		})
+	case "drop_database":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsDropDatabaseArgs) (r hmsResult[struct{}]) {
+			if m.dbs[args.Name] == nil {
+				r.E1 = &hmsException{Message: args.Name}
+				return r
+			}
+			for key := range m.tables {
+				if strings.HasPrefix(key, args.Name+".") {
+					r.E2 = &hmsException{Message: "database is not empty"}
+					return r
+				}
+			}
+			delete(m.dbs, args.Name)
+			return r
+		})
+	case "alter_database":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsAlterDatabaseArgs) (r hmsResult[struct{}]) {
+			m.dbs[args.Name] = args.Database
+			return r
+		})
+	case "get_all_tables":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsGetAllTablesArgs) (r hmsResult[[]string]) {
+			r.Success = []string{}
+			for key, tbl := range m.tables {
+				if strings.HasPrefix(key, args.DBName+".") {
+					r.Success = append(r.Success, tbl.TableName)
+				}
+			}
+			slices.Sort(r.Success)
+			return r
+		})
+	case "get_table":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsGetTableArgs) (r hmsResult[*hmsTable]) {
+			if r.Success = m.tables[args.DBName+"."+args.TableName]; r.Success == nil {
+				r.E2 = &hmsException{Message: args.TableName}
+			}
+			return r
+		})
+	case "create_table":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsCreateTableArgs) (r hmsResult[struct{}]) {
+			key := args.Table.DBName + "." + args.Table.TableName
+			switch {
+			case m.dbs[args.Table.DBName] == nil:
+				r.E4 = &hmsException{Message: args.Table.DBName}
+			case m.tables[key] != nil:
+				r.E1 = &hmsException{Message: key}
+			default:
+				m.tables[key] = args.Table
+			}
+			return r
+		})
+	case "drop_table":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsDropTableArgs) (r hmsResult[struct{}]) {
+			key := args.DBName + "." + args.Name
+			if m.tables[key] == nil {
+				r.E1 = &hmsException{Message: key}
+			}
+			delete(m.tables, key)
+			return r
+		})
+	case "alter_table":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsAlterTableArgs) (r hmsResult[struct{}]) {
+			key := args.DBName + "." + args.TableName
+			if m.tables[key] == nil {
+				r.E1 = &hmsException{Message: key}
+				return r
+			}
+			delete(m.tables, key)
+			m.tables[args.Table.DBName+"."+args.Table.TableName] = args.Table
+			return r
+		})
+	case "lock":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsLockArgs) (r hmsResult[*hmsLockResponse]) {
+			m.nextLock++
+			key := args.Request.Components[0].DBName + "." + args.Request.Components[0].TableName
+			r.Success = &hmsLockResponse{LockID: m.nextLock, State: m.tryLock(m.nextLock, key)}
+			return r
+		})
+	case "check_lock":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsLockIDArgs) (r hmsResult[*hmsLockResponse]) {
+			key := m.locks[args.Request.LockID]
+			r.Success = &hmsLockResponse{LockID: args.Request.LockID, State: m.tryLock(args.Request.LockID, strings.TrimPrefix(key, "?"))}
+			return r
+		})
+	case "unlock":
+		err = serveFake(ctx, in, out, method, seq, func(args *hmsLockIDArgs) (r hmsResult[struct{}]) {
+			delete(m.locks, args.Request.LockID)
+			return r
+		})
+	default:
+		return false, thrift.NewTApplicationException(thrift.UNKNOWN_METHOD, method)
+	}
+	if err != nil {
+		return false, thrift.WrapTException(err)
+	}
+	return true, nil
+}
+
+// tryLock acquires key for id unless another lock holds it, waiting locks are kept as "?<key>".
+func (m *fakeMetastore) tryLock(id int64, key string) int32 {
+	for other, held := range m.locks {
+		if other != id && held == key {
+			m.locks[id] = "?" + key
+			return hmsLockWaiting
+		}
+	}
+	m.locks[id] = key
+	return hmsLockAcquired
+}
+
+func serveFake[A any, R any](ctx context.Context, in, out thrift.TProtocol, method string, seq int32, handle func(*A) hmsResult[R]) error {
+	var args A
+	if err := (thriftStruct{&args}).Read(ctx, in); err != nil {
+		return err
+	}
+	if err := in.ReadMessageEnd(ctx); err != nil {
+		return err
+	}
+	result := handle(&args)
+	if err := out.WriteMessageBegin(ctx, method, thrift.REPLY, seq); err != nil {
+		return err
+	}
+	if err := (thriftStruct{&result}).Write(ctx, out); err != nil {
+		return err
+	}
+	if err := out.WriteMessageEnd(ctx); err != nil {
+		return err
+	}
+	return out.Flush(ctx)
+}
+
+func TestHiveCatalog(t *testing.T) {
+	ctx := context.Background()
+	ms, uri := startFakeMetastore(t)
+	dir := t.TempDir()
+	cat, err := newCatalog(ctx, CatalogTypeHive, uri, iceberg.Properties{"warehouse": "file://" + dir, hiveLockTimeoutKey: "200ms"})
+	require.NoError(t, err)
+	t.Cleanup(func() { closeCatalog(cat) })
+
+	ident := table.Identifier{"db", "events"}
+	schema := iceberg.NewSchema(0, iceberg.NestedField{ID: 1, Name: "id", Type: iceberg.PrimitiveTypes.Int64, Required: true})
+	_, err = cat.CreateTable(ctx, ident, schema)
+	require.ErrorIs(t, err, catalog.ErrNoSuchNamespace)
+	require.NoError(t, cat.CreateNamespace(ctx, table.Identifier{"db"}, iceberg.Properties{"comment": "events", "owner": "etl"}))
+	require.ErrorIs(t, cat.CreateNamespace(ctx, table.Identifier{"db"}, nil), catalog.ErrNamespaceAlreadyExists)
+	props, err := cat.LoadNamespaceProperties(ctx, table.Identifier{"db"})
+	require.NoError(t, err)
+	require.Equal(t, iceberg.Properties{"comment": "events", "owner": "etl", "location": "file://" + dir + "/db.db"}, props)
+
+	tbl, err := cat.CreateTable(ctx, ident, schema)
+	require.NoError(t, err)
+	require.Equal(t, "file://"+dir+"/db.db/events", tbl.Location())
+	require.True(t, strings.HasPrefix(tbl.MetadataLocation(), "file://"+dir+"/db.db/events/metadata/00000-"))
+	_, err = cat.CreateTable(ctx, ident, schema)
+	require.ErrorIs(t, err, catalog.ErrTableAlreadyExists)
+	hmsTbl := ms.tables["db.events"]
+	require.Equal(t, "ICEBERG", hmsTbl.Parameters["table_type"])
+	require.Equal(t, []hmsFieldSchema{{Name: "id", Type: "bigint"}}, hmsTbl.Sd.Cols)
+
+	meta, location, err := cat.CommitTable(ctx, tbl,
+		[]table.Requirement{table.AssertTableUUID(tbl.Metadata().TableUUID())},
+		[]table.Update{table.NewSetPropertiesUpdate(iceberg.Properties{"k": "v"})})
+	require.NoError(t, err)
+	require.Equal(t, "v", meta.Properties()["k"])
+	require.True(t, strings.HasPrefix(location, "file://"+dir+"/db.db/events/metadata/00001-"))
+	require.Equal(t, location, ms.tables["db.events"].Parameters["metadata_location"])
+	require.Equal(t, tbl.MetadataLocation(), ms.tables["db.events"].Parameters["previous_metadata_location"])
+	require.Empty(t, ms.locks)
+
+	_, _, err = cat.CommitTable(ctx, tbl, []table.Requirement{table.AssertCurrentSchemaID(5)}, nil)
+	require.Error(t, err)
+	require.Equal(t, location, ms.tables["db.events"].Parameters["metadata_location"])
+
+	ms.tables["db.view"] = &hmsTable{DBName: "db", TableName: "view", TableType: "VIRTUAL_VIEW"}
+	var tables []table.Identifier
+	for ident, err := range cat.ListTables(ctx, table.Identifier{"db"}) {
+		require.NoError(t, err)
+		tables = append(tables, ident)
+	}
+	require.Equal(t, []table.Identifier{ident}, tables)
+	_, err = cat.LoadTable(ctx, table.Identifier{"db", "view"}, nil)
+	require.Error(t, err)
+	delete(ms.tables, "db.view")
+	namespaces, err := cat.ListNamespaces(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []table.Identifier{{"db"}}, namespaces)
+
+	renamed := table.Identifier{"db", "renamed"}
+	tbl, err = cat.RenameTable(ctx, ident, renamed)
+	require.NoError(t, err)
+	require.Equal(t, location, tbl.MetadataLocation())
+	_, err = cat.LoadTable(ctx, ident, nil)
+	require.ErrorIs(t, err, catalog.ErrNoSuchTable)
+
+	require.ErrorIs(t, cat.DropNamespace(ctx, table.Identifier{"db"}), catalog.ErrNamespaceNotEmpty)
+	require.NoError(t, cat.DropTable(ctx, renamed))
+	require.ErrorIs(t, cat.DropTable(ctx, renamed), catalog.ErrNoSuchTable)
+	require.NoError(t, cat.DropNamespace(ctx, table.Identifier{"db"}))
+	_, err = cat.LoadNamespaceProperties(ctx, table.Identifier{"db"})
+	require.ErrorIs(t, err, catalog.ErrNoSuchNamespace)
+}
+
+func TestHiveCatalogLock(t *testing.T) {
+	ctx := context.Background()
+	ms, uri := startFakeMetastore(t)
+	dir := t.TempDir()
+	cat, err := newCatalog(ctx, CatalogTypeHive, uri, iceberg.Properties{"warehouse": "file://" + dir, hiveLockTimeoutKey: "300ms"})
+	require.NoError(t, err)
+	t.Cleanup(func() { closeCatalog(cat) })
+	ident := table.Identifier{"db", "events"}
+	require.NoError(t, ensureNamespace(ctx, cat, ident))
+	tbl, err := cat.CreateTable(ctx, ident, iceberg.NewSchema(0, iceberg.NestedField{ID: 1, Name: "id", Type: iceberg.PrimitiveTypes.Int64}))
+	require.NoError(t, err)
+
+	// another engine holds the lock
+	other, err := newHMSClient(strings.TrimPrefix(uri, "thrift://"), time.Second)
+	require.NoError(t, err)
+	defer other.Close()
+	held, err := other.lock(ctx, &hmsLockRequest{Components: []hmsLockComponent{{Type: hmsLockTypeExclusive, Level: hmsLockLevelTable, DBName: "db", TableName: "events"}}})
+	require.NoError(t, err)
+	require.Equal(t, int32(hmsLockAcquired), held.State)
+
+	update := []table.Update{table.NewSetPropertiesUpdate(iceberg.Properties{"k": "v"})}
+	_, _, err = cat.CommitTable(ctx, tbl, nil, update)
+	require.ErrorContains(t, err, "not acquired")
+	require.Equal(t, tbl.MetadataLocation(), ms.tables["db.events"].Parameters["metadata_location"])
+
+	done := make(chan error)
+	go func() {
+		_, _, err := cat.CommitTable(ctx, tbl, nil, update)
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, other.unlock(ctx, held.LockID))
+	require.NoError(t, <-done)
+	require.NotEqual(t, tbl.MetadataLocation(), ms.tables["db.events"].Parameters["metadata_location"])
+}
+
+func TestHMSClientReconnect(t *testing.T) {
+	ctx := context.Background()
+	ms, uri := startFakeMetastore(t)
+	client, err := newHMSClient(strings.TrimPrefix(uri, "thrift://"), time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.createDatabase(ctx, &hmsDatabase{Name: "db"}))
+
+	// a read on a broken connection is sent again on a new one
+	require.NoError(t, client.transport.Close())
+	db, err := client.getDatabase(ctx, "db")
+	require.NoError(t, err)
+	require.Equal(t, "db", db.Name)
+
+	// a write is not retried, it may have been applied, but the next call works
+	require.NoError(t, client.transport.Close())
+	require.Error(t, client.createDatabase(ctx, &hmsDatabase{Name: "other"}))
+	require.NotContains(t, ms.dbs, "other")
+	_, err = client.getDatabase(ctx, "other")
+	require.ErrorIs(t, err, errHMSNoSuchObject)
+}
+
+func TestSinkSnapshotHive(t *testing.T) {
+	_, uri := startFakeMetastore(t)
+	dst, err := LocalDestinationRecipe()
+	require.NoError(t, err)
+	dst.CatalogType, dst.CatalogURI = CatalogTypeHive, uri
+	testSinkSnapshotLocal(t, dst)
+}
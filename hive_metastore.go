@@ -0,0 +1,540 @@
+package iceberg
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+// Subset of the Hive Metastore Thrift API used by the hive catalog, field IDs follow hive_metastore.thrift.
+
+type hmsFieldSchema struct {
+	Name    string `thrift:"1"`
+	Type    string `thrift:"2"`
+	Comment string `thrift:"3"`
+}
+
+type hmsSerDeInfo struct {
+	Name             string            `thrift:"1"`
+	SerializationLib string            `thrift:"2"`
+	Parameters       map[string]string `thrift:"3"`
+}
+
+type hmsStorageDescriptor struct {
+	Cols         []hmsFieldSchema  `thrift:"1"`
+	Location     string            `thrift:"2"`
+	InputFormat  string            `thrift:"3"`
+	OutputFormat string            `thrift:"4"`
+	Compressed   bool              `thrift:"5"`
+	NumBuckets   int32             `thrift:"6"`
+	SerdeInfo    *hmsSerDeInfo     `thrift:"7"`
+	BucketCols   []string          `thrift:"8"`
+	Parameters   map[string]string `thrift:"10"`
+}
+
+type hmsTable struct {
+	TableName        string                `thrift:"1"`
+	DBName           string                `thrift:"2"`
+	Owner            string                `thrift:"3"`
+	CreateTime       int32                 `thrift:"4"`
+	LastAccessTime   int32                 `thrift:"5"`
+	Retention        int32                 `thrift:"6"`
+	Sd               *hmsStorageDescriptor `thrift:"7"`
+	PartitionKeys    []hmsFieldSchema      `thrift:"8"`
+	Parameters       map[string]string     `thrift:"9"`
+	ViewOriginalText string                `thrift:"10"`
+	ViewExpandedText string                `thrift:"11"`
+	TableType        string                `thrift:"12"`
+}
+
+type hmsDatabase struct {
+	Name        string            `thrift:"1"`
+	Description string            `thrift:"2"`
+	LocationURI string            `thrift:"3"`
+	Parameters  map[string]string `thrift:"4"`
+}
+
+const (
+	hmsLockTypeExclusive = 3
+	hmsLockLevelTable    = 2
+
+	hmsLockAcquired    = 1
+	hmsLockWaiting     = 2
+	hmsLockAbort       = 3
+	hmsLockNotAcquired = 4
+)
+
+type hmsLockComponent struct {
+	Type      int32  `thrift:"1"`
+	Level     int32  `thrift:"2"`
+	DBName    string `thrift:"3"`
+	TableName string `thrift:"4,optional"`
+}
+
+type hmsLockRequest struct {
+	Components []hmsLockComponent `thrift:"1"`
+	User       string             `thrift:"3"`
+	Hostname   string             `thrift:"4"`
+}
+
+type hmsLockResponse struct {
+	LockID int64 `thrift:"1"`
+	State  int32 `thrift:"2"`
+}
+
+type hmsLockID struct {
+	LockID int64 `thrift:"1"`
+}
+
+// hmsException is any exception of the metastore, they all have the message as field 1.
+type hmsException struct {
+	Message string `thrift:"1"`
+}
+
+type (
+	hmsGetDatabaseArgs struct {
+		Name string `thrift:"1"`
+	}
+	hmsGetAllDatabasesArgs struct{}
+	hmsCreateDatabaseArgs  struct {
+		Database *hmsDatabase `thrift:"1"`
+	}
+	hmsDropDatabaseArgs struct {
+		Name       string `thrift:"1"`
+		DeleteData bool   `thrift:"2"`
+		Cascade    bool   `thrift:"3"`
+	}
+	hmsAlterDatabaseArgs struct {
+		Name     string       `thrift:"1"`
+		Database *hmsDatabase `thrift:"2"`
+	}
+	hmsGetAllTablesArgs struct {
+		DBName string `thrift:"1"`
+	}
+	hmsGetTableArgs struct {
+		DBName    string `thrift:"1"`
+		TableName string `thrift:"2"`
+	}
+	hmsCreateTableArgs struct {
+		Table *hmsTable `thrift:"1"`
+	}
+	hmsDropTableArgs struct {
+		DBName     string `thrift:"1"`
+		Name       string `thrift:"2"`
+		DeleteData bool   `thrift:"3"`
+	}
+	hmsAlterTableArgs struct {
+		DBName    string    `thrift:"1"`
+		TableName string    `thrift:"2"`
+		Table     *hmsTable `thrift:"3"`
+	}
+	hmsLockArgs struct {
+		Request *hmsLockRequest `thrift:"1"`
+	}
+	hmsLockIDArgs struct {
+		Request *hmsLockID `thrift:"1"`
+	}
+)
+
+// hmsResult is the reply of a method, Success is field 0 and declared exceptions follow it.
+type hmsResult[T any] struct {
+	Success T             `thrift:"0,optional"`
+	E1      *hmsException `thrift:"1"`
+	E2      *hmsException `thrift:"2"`
+	E3      *hmsException `thrift:"3"`
+	E4      *hmsException `thrift:"4"`
+}
+
+func (r *hmsResult[T]) exception() (int, *hmsException) {
+	for i, e := range []*hmsException{r.E1, r.E2, r.E3, r.E4} {
+		if e != nil {
+			return i + 1, e
+		}
+	}
+	return 0, nil
+}
+
+var (
+	errHMSNoSuchObject     = xerrors.New("no such object")
+	errHMSAlreadyExists    = xerrors.New("already exists")
+	errHMSInvalidOperation = xerrors.New("invalid operation")
+)
+
+// hmsIdempotent are the methods safe to send again when the connection broke during a call.
+var hmsIdempotent = map[string]bool{
+	"get_database":      true,
+	"get_all_databases": true,
+	"get_all_tables":    true,
+	"get_table":         true,
+	"check_lock":        true,
+}
+
+// hmsClient calls a metastore over a buffered socket with the binary protocol, one call at a time.
+// A connection broken by a transport or protocol error is opened again, idempotent calls are retried on it once.
+type hmsClient struct {
+	mu        sync.Mutex
+	address   string
+	conf      *thrift.TConfiguration
+	transport thrift.TTransport
+	client    *thrift.TStandardClient
+}
+
+func newHMSClient(address string, timeout time.Duration) (*hmsClient, error) {
+	c := &hmsClient{address: address, conf: &thrift.TConfiguration{ConnectTimeout: timeout, SocketTimeout: timeout}}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *hmsClient) connect() error {
+	transport := thrift.NewTBufferedTransport(thrift.NewTSocketConf(c.address, c.conf), 1<<16)
+	if err := transport.Open(); err != nil {
+		return xerrors.Errorf("unable to connect to metastore %s: %w", c.address, err)
+	}
+	protocol := thrift.NewTBinaryProtocolConf(transport, c.conf)
+	c.transport, c.client = transport, thrift.NewTStandardClient(protocol, protocol)
+	return nil
+}
+
+// reconnect replaces the connection a failed call may have left mid-message.
+func (c *hmsClient) reconnect() error {
+	_ = c.transport.Close()
+	return c.connect()
+}
+
+func (c *hmsClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.transport.Close()
+}
+
+// call invokes method, exceptions[i] is the error the exception in field i+1 of the result wraps.
+func call[T any](ctx context.Context, c *hmsClient, method string, args any, exceptions ...error) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var result hmsResult[T]
+	_, err := c.client.Call(ctx, method, thriftStruct{args}, thriftStruct{&result})
+	if brokenConnection(err) {
+		if reconnectErr := c.reconnect(); reconnectErr != nil {
+			return result.Success, xerrors.Errorf("metastore %s: %w, reconnect: %v", method, err, reconnectErr)
+		}
+		if hmsIdempotent[method] && ctx.Err() == nil {
+			result = hmsResult[T]{}
+			_, err = c.client.Call(ctx, method, thriftStruct{args}, thriftStruct{&result})
+		}
+	}
+	if err != nil {
+		return result.Success, xerrors.Errorf("metastore %s: %w", method, err)
+	}
+	if id, e := result.exception(); e != nil {
+		if id <= len(exceptions) && exceptions[id-1] != nil {
+			return result.Success, xerrors.Errorf("metastore %s: %s: %w", method, e.Message, exceptions[id-1])
+		}
+		return result.Success, xerrors.Errorf("metastore %s: %s", method, e.Message)
+	}
+	return result.Success, nil
+}
+
+// brokenConnection reports whether err leaves the connection unusable, unlike errors the metastore responded with.
+func brokenConnection(err error) bool {
+	var appErr thrift.TApplicationException
+	return err != nil && !errors.As(err, &appErr)
+}
+
+func (c *hmsClient) getDatabase(ctx context.Context, name string) (*hmsDatabase, error) {
+	return call[*hmsDatabase](ctx, c, "get_database", &hmsGetDatabaseArgs{Name: name}, errHMSNoSuchObject)
+}
+
+func (c *hmsClient) getAllDatabases(ctx context.Context) ([]string, error) {
+	return call[[]string](ctx, c, "get_all_databases", &hmsGetAllDatabasesArgs{})
+}
+
+func (c *hmsClient) createDatabase(ctx context.Context, db *hmsDatabase) error {
+	_, err := call[struct{}](ctx, c, "create_database", &hmsCreateDatabaseArgs{Database: db}, errHMSAlreadyExists)
+	return err
+}
+
+func (c *hmsClient) dropDatabase(ctx context.Context, name string) error {
+	_, err := call[struct{}](ctx, c, "drop_database", &hmsDropDatabaseArgs{Name: name}, errHMSNoSuchObject, errHMSInvalidOperation)
+	return err
+}
+
+func (c *hmsClient) alterDatabase(ctx context.Context, name string, db *hmsDatabase) error {
+	_, err := call[struct{}](ctx, c, "alter_database", &hmsAlterDatabaseArgs{Name: name, Database: db}, nil, errHMSNoSuchObject)
+	return err
+}
+
+func (c *hmsClient) getAllTables(ctx context.Context, dbName string) ([]string, error) {
+	return call[[]string](ctx, c, "get_all_tables", &hmsGetAllTablesArgs{DBName: dbName})
+}
+
+func (c *hmsClient) getTable(ctx context.Context, dbName, tableName string) (*hmsTable, error) {
+	return call[*hmsTable](ctx, c, "get_table", &hmsGetTableArgs{DBName: dbName, TableName: tableName}, nil, errHMSNoSuchObject)
+}
+
+func (c *hmsClient) createTable(ctx context.Context, tbl *hmsTable) error {
+	_, err := call[struct{}](ctx, c, "create_table", &hmsCreateTableArgs{Table: tbl}, errHMSAlreadyExists, nil, nil, errHMSNoSuchObject)
+	return err
+}
+
+func (c *hmsClient) dropTable(ctx context.Context, dbName, tableName string) error {
+	_, err := call[struct{}](ctx, c, "drop_table", &hmsDropTableArgs{DBName: dbName, Name: tableName}, errHMSNoSuchObject)
+	return err
+}
+
+func (c *hmsClient) alterTable(ctx context.Context, dbName, tableName string, tbl *hmsTable) error {
+	_, err := call[struct{}](ctx, c, "alter_table", &hmsAlterTableArgs{DBName: dbName, TableName: tableName, Table: tbl}, errHMSInvalidOperation)
+	return err
+}
+
+func (c *hmsClient) lock(ctx context.Context, req *hmsLockRequest) (*hmsLockResponse, error) {
+	return call[*hmsLockResponse](ctx, c, "lock", &hmsLockArgs{Request: req})
+}
+
+func (c *hmsClient) checkLock(ctx context.Context, lockID int64) (*hmsLockResponse, error) {
+	return call[*hmsLockResponse](ctx, c, "check_lock", &hmsLockIDArgs{Request: &hmsLockID{LockID: lockID}})
+}
+
+func (c *hmsClient) unlock(ctx context.Context, lockID int64) error {
+	_, err := call[struct{}](ctx, c, "unlock", &hmsLockIDArgs{Request: &hmsLockID{LockID: lockID}})
+	return err
+}
+
+// thriftStruct encodes a pointer to a Go struct whose fields have `thrift:"<id>[,optional]"` tags.
+// Nil pointers, slices and maps are not written, neither are zero optional fields. Unknown fields are skipped on read.
+type thriftStruct struct {
+	v any
+}
+
+func (s thriftStruct) Write(ctx context.Context, p thrift.TProtocol) error {
+	return writeThriftStruct(ctx, p, reflect.ValueOf(s.v).Elem())
+}
+
+func (s thriftStruct) Read(ctx context.Context, p thrift.TProtocol) error {
+	return readThriftStruct(ctx, p, reflect.ValueOf(s.v).Elem())
+}
+
+type thriftField struct {
+	index    int
+	id       int16
+	optional bool
+}
+
+func thriftFields(t reflect.Type) []thriftField {
+	var fields []thriftField
+	for i := range t.NumField() {
+		tag, ok := t.Field(i).Tag.Lookup("thrift")
+		if !ok {
+			continue
+		}
+		idTag, opt, _ := strings.Cut(tag, ",")
+		id, err := strconv.ParseInt(idTag, 10, 16)
+		if err != nil {
+			panic("invalid thrift tag of " + t.String() + "." + t.Field(i).Name)
+		}
+		fields = append(fields, thriftField{index: i, id: int16(id), optional: opt == "optional"})
+	}
+	return fields
+}
+
+func thriftType(t reflect.Type) thrift.TType {
+	switch t.Kind() {
+	case reflect.String:
+		return thrift.STRING
+	case reflect.Bool:
+		return thrift.BOOL
+	case reflect.Int16:
+		return thrift.I16
+	case reflect.Int32:
+		return thrift.I32
+	case reflect.Int64:
+		return thrift.I64
+	case reflect.Slice:
+		return thrift.LIST
+	case reflect.Map:
+		return thrift.MAP
+	case reflect.Struct, reflect.Pointer:
+		return thrift.STRUCT
+	default:
+		panic("unsupported thrift type " + t.String())
+	}
+}
+
+func writeThriftStruct(ctx context.Context, p thrift.TProtocol, v reflect.Value) error {
+	if err := p.WriteStructBegin(ctx, v.Type().Name()); err != nil {
+		return err
+	}
+	for _, f := range thriftFields(v.Type()) {
+		fv := v.Field(f.index)
+		switch {
+		case fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Slice || fv.Kind() == reflect.Map:
+			if fv.IsNil() {
+				continue
+			}
+		case f.optional && fv.IsZero():
+			continue
+		}
+		name := v.Type().Field(f.index).Name
+		if err := p.WriteFieldBegin(ctx, name, thriftType(fv.Type()), f.id); err != nil {
+			return err
+		}
+		if err := writeThriftValue(ctx, p, fv); err != nil {
+			return xerrors.Errorf("%s.%s: %w", v.Type().Name(), name, err)
+		}
+		if err := p.WriteFieldEnd(ctx); err != nil {
+			return err
+		}
+	}
+	if err := p.WriteFieldStop(ctx); err != nil {
+		return err
+	}
+	return p.WriteStructEnd(ctx)
+}
+
+func writeThriftValue(ctx context.Context, p thrift.TProtocol, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		return p.WriteString(ctx, v.String())
+	case reflect.Bool:
+		return p.WriteBool(ctx, v.Bool())
+	case reflect.Int16:
+		return p.WriteI16(ctx, int16(v.Int()))
+	case reflect.Int32:
+		return p.WriteI32(ctx, int32(v.Int()))
+	case reflect.Int64:
+		return p.WriteI64(ctx, v.Int())
+	case reflect.Slice:
+		if err := p.WriteListBegin(ctx, thriftType(v.Type().Elem()), v.Len()); err != nil {
+			return err
+		}
+		for i := range v.Len() {
+			if err := writeThriftValue(ctx, p, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return p.WriteListEnd(ctx)
+	case reflect.Map:
+		if err := p.WriteMapBegin(ctx, thriftType(v.Type().Key()), thriftType(v.Type().Elem()), v.Len()); err != nil {
+			return err
+		}
+		for it := v.MapRange(); it.Next(); {
+			if err := writeThriftValue(ctx, p, it.Key()); err != nil {
+				return err
+			}
+			if err := writeThriftValue(ctx, p, it.Value()); err != nil {
+				return err
+			}
+		}
+		return p.WriteMapEnd(ctx)
+	case reflect.Pointer:
+		return writeThriftStruct(ctx, p, v.Elem())
+	default:
+		return writeThriftStruct(ctx, p, v)
+	}
+}
+
+func readThriftStruct(ctx context.Context, p thrift.TProtocol, v reflect.Value) error {
+	if _, err := p.ReadStructBegin(ctx); err != nil {
+		return err
+	}
+	fields := map[int16]int{}
+	for _, f := range thriftFields(v.Type()) {
+		fields[f.id] = f.index
+	}
+	for {
+		_, typeID, id, err := p.ReadFieldBegin(ctx)
+		if err != nil {
+			return err
+		}
+		if typeID == thrift.STOP {
+			break
+		}
+		if index, ok := fields[id]; ok && thriftType(v.Field(index).Type()) == typeID {
+			if err := readThriftValue(ctx, p, v.Field(index)); err != nil {
+				return xerrors.Errorf("%s.%s: %w", v.Type().Name(), v.Type().Field(index).Name, err)
+			}
+		} else if err := p.Skip(ctx, typeID); err != nil {
+			return err
+		}
+		if err := p.ReadFieldEnd(ctx); err != nil {
+			return err
+		}
+	}
+	return p.ReadStructEnd(ctx)
+}
+
+func readThriftValue(ctx context.Context, p thrift.TProtocol, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := p.ReadString(ctx)
+		v.SetString(s)
+		return err
+	case reflect.Bool:
+		b, err := p.ReadBool(ctx)
+		v.SetBool(b)
+		return err
+	case reflect.Int16:
+		i, err := p.ReadI16(ctx)
+		v.SetInt(int64(i))
+		return err
+	case reflect.Int32:
+		i, err := p.ReadI32(ctx)
+		v.SetInt(int64(i))
+		return err
+	case reflect.Int64:
+		i, err := p.ReadI64(ctx)
+		v.SetInt(i)
+		return err
+	case reflect.Slice:
+		_, size, err := p.ReadListBegin(ctx)
+		if err != nil {
+			return err
+		}
+		list := reflect.MakeSlice(v.Type(), size, size)
+		for i := range size {
+			if err := readThriftValue(ctx, p, list.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(list)
+		return p.ReadListEnd(ctx)
+	case reflect.Map:
+		_, _, size, err := p.ReadMapBegin(ctx)
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), size)
+		for range size {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := readThriftValue(ctx, p, key); err != nil {
+				return err
+			}
+			val := reflect.New(v.Type().Elem()).Elem()
+			if err := readThriftValue(ctx, p, val); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, val)
+		}
+		v.Set(m)
+		return p.ReadMapEnd(ctx)
+	case reflect.Pointer:
+		ptr := reflect.New(v.Type().Elem())
+		if err := readThriftStruct(ctx, p, ptr.Elem()); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	default:
+		return readThriftStruct(ctx, p, v)
+	}
+}
@@ -0,0 +1,288 @@
+package iceberg
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/transferia/transferia/pkg/abstract/model"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+// Prefixes of the HTTP client properties of the catalog and of the S3 FileIO.
+const (
+	restHTTPPrefix = "rest.http."
+	s3HTTPPrefix   = "s3.http."
+)
+
+// Keys of the HTTP client properties after their prefix.
+const (
+	httpCACertificatesKey    = "ca-certificates"
+	httpClientCertificateKey = "client-certificate"
+	httpClientKeyKey         = "client-key"
+	httpProxyURIKey          = "proxy-uri"
+	httpConnectTimeoutKey    = "connect-timeout"
+	httpResponseTimeoutKey   = "response-timeout"
+	httpMaxAttemptsKey       = "max-attempts"
+	httpMaxBackoffKey        = "max-backoff"
+
+	defaultHTTPMaxBackoff = 10 * time.Second
+)
+
+// HTTPConfig configures the HTTP client of the catalog or of the S3 FileIO
+// instead of the process-wide defaults. The catalog takes TLS and retry options only.
+type HTTPConfig struct {
+	CACertificates    string             // PEM bundle of CAs trusted in addition to the system ones
+	ClientCertificate string             // PEM certificate presented for mutual TLS
+	ClientKey         model.SecretString // PEM private key of ClientCertificate
+	ProxyURI          string             // Proxy of all requests, HTTP_PROXY and HTTPS_PROXY of the environment when empty
+	ConnectTimeout    time.Duration      // Limit of establishing a connection, 30s when zero
+	ResponseTimeout   time.Duration      // Limit of waiting for response headers once a request is sent, none when zero
+	// MaxAttempts of a request failing with a connection error, 429 or 5xx, zero keeps the default:
+	// a single attempt for the catalog and the AWS SDK retries for S3
+	MaxAttempts int
+	MaxBackoff  time.Duration // Upper bound of the wait between attempts, 10s when zero
+}
+
+// props adds the HTTP client options to catalog properties under prefix.
+func (c HTTPConfig) props(props iceberg.Properties, prefix string) iceberg.Properties {
+	if c == (HTTPConfig{}) {
+		return props
+	}
+	result := iceberg.Properties{}
+	maps.Copy(result, props)
+	for key, value := range map[string]string{
+		httpCACertificatesKey:    c.CACertificates,
+		httpClientCertificateKey: c.ClientCertificate,
+		httpClientKeyKey:         string(c.ClientKey),
+		httpProxyURIKey:          c.ProxyURI,
+	} {
+		if value != "" {
+			result[prefix+key] = value
+		}
+	}
+	for key, value := range map[string]time.Duration{
+		httpConnectTimeoutKey:  c.ConnectTimeout,
+		httpResponseTimeoutKey: c.ResponseTimeout,
+		httpMaxBackoffKey:      c.MaxBackoff,
+	} {
+		if value != 0 {
+			result[prefix+key] = value.String()
+		}
+	}
+	if c.MaxAttempts != 0 {
+		result[prefix+httpMaxAttemptsKey] = strconv.Itoa(c.MaxAttempts)
+	}
+	return result
+}
+
+// httpConfigFromProps reads the HTTP client options under prefix.
+func httpConfigFromProps(props iceberg.Properties, prefix string) (HTTPConfig, error) {
+	c := HTTPConfig{
+		CACertificates:    props[prefix+httpCACertificatesKey],
+		ClientCertificate: props[prefix+httpClientCertificateKey],
+		ClientKey:         model.SecretString(props[prefix+httpClientKeyKey]),
+		ProxyURI:          props[prefix+httpProxyURIKey],
+	}
+	for key, value := range map[string]*time.Duration{
+		httpConnectTimeoutKey:  &c.ConnectTimeout,
+		httpResponseTimeoutKey: &c.ResponseTimeout,
+		httpMaxBackoffKey:      &c.MaxBackoff,
+	} {
+		if raw, ok := props[prefix+key]; ok {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil {
+				return HTTPConfig{}, xerrors.Errorf("parse %s%s: %w", prefix, key, err)
+			}
+			*value = parsed
+		}
+	}
+	if raw, ok := props[prefix+httpMaxAttemptsKey]; ok {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil {
+			return HTTPConfig{}, xerrors.Errorf("parse %s%s: %w", prefix, httpMaxAttemptsKey, err)
+		}
+		c.MaxAttempts = attempts
+	}
+	return c, c.validate()
+}
+
+func (c HTTPConfig) validate() error {
+	if _, err := c.tlsConfig(); err != nil {
+		return err
+	}
+	if c.ProxyURI != "" {
+		if parsed, err := url.Parse(c.ProxyURI); err != nil || parsed.Host == "" {
+			return xerrors.Errorf("invalid proxy URI %q", c.ProxyURI)
+		}
+	}
+	if c.ConnectTimeout < 0 || c.ResponseTimeout < 0 || c.MaxBackoff < 0 {
+		return xerrors.New("HTTP timeouts and backoff can not be negative")
+	}
+	if c.MaxAttempts < 0 {
+		return xerrors.Errorf("max attempts %d can not be negative", c.MaxAttempts)
+	}
+	return nil
+}
+
+func (c HTTPConfig) tlsConfig() (*tls.Config, error) {
+	if c.CACertificates == "" && c.ClientCertificate == "" && c.ClientKey == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CACertificates != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(c.CACertificates)) {
+			return nil, xerrors.New("CA certificates contain no PEM certificate")
+		}
+		cfg.RootCAs = pool
+	}
+	if c.ClientCertificate != "" || c.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(c.ClientCertificate), []byte(c.ClientKey))
+		if err != nil {
+			return nil, xerrors.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// transport is the transport of the options without retries, nil when the default transport fits.
+func (c HTTPConfig) transport() (*http.Transport, error) {
+	if c.CACertificates == "" && c.ClientCertificate == "" && c.ClientKey == "" && c.ProxyURI == "" &&
+		c.ConnectTimeout == 0 && c.ResponseTimeout == 0 {
+		return nil, nil
+	}
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if c.ProxyURI != "" {
+		proxy, err := url.Parse(c.ProxyURI)
+		if err != nil {
+			return nil, xerrors.Errorf("parse proxy URI: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if c.ConnectTimeout != 0 {
+		transport.DialContext = (&net.Dialer{Timeout: c.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = c.ConnectTimeout
+	}
+	transport.ResponseHeaderTimeout = c.ResponseTimeout
+	return transport, nil
+}
+
+func (c HTTPConfig) maxBackoff() time.Duration {
+	if c.MaxBackoff == 0 {
+		return defaultHTTPMaxBackoff
+	}
+	return c.MaxBackoff
+}
+
+func (c HTTPConfig) backoff() backoff.BackOff {
+	return newHTTPBackoff(c.maxBackoff())
+}
+
+func newHTTPBackoff(maxBackoff time.Duration) backoff.BackOff {
+	intervals := backoff.NewExponentialBackOff()
+	intervals.InitialInterval = 100 * time.Millisecond
+	intervals.MaxInterval = maxBackoff
+	intervals.MaxElapsedTime = 0
+	return intervals
+}
+
+// retryTransport retries requests that were not processed: connection failures, 429 and 503 responses.
+// Requests with idempotent methods are also retried after any network error and 502 or 504 responses.
+type retryTransport struct {
+	base        http.RoundTripper
+	maxAttempts int
+	maxBackoff  time.Duration
+}
+
+// withRetries wraps base with the retries of the options, base is returned as is for a single attempt.
+func (c HTTPConfig) withRetries(base http.RoundTripper) http.RoundTripper {
+	if c.MaxAttempts <= 1 {
+		return base
+	}
+	return &retryTransport{base: base, maxAttempts: c.MaxAttempts, maxBackoff: c.maxBackoff()}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, xerrors.Errorf("read request body: %w", err)
+		}
+		req = req.Clone(req.Context())
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		req.Body, _ = req.GetBody()
+	}
+
+	intervals := newHTTPBackoff(t.maxBackoff)
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, xerrors.Errorf("rewind request body: %w", err)
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+		rsp, err := t.base.RoundTrip(attemptReq)
+		if attempt >= t.maxAttempts || !retryable(req, rsp, err) {
+			return rsp, err
+		}
+		wait := intervals.NextBackOff()
+		if rsp != nil {
+			if seconds, err := strconv.Atoi(rsp.Header.Get("Retry-After")); err == nil {
+				wait = min(time.Duration(seconds)*time.Second, t.maxBackoff)
+			}
+			_, _ = io.Copy(io.Discard, rsp.Body)
+			_ = rsp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func retryable(req *http.Request, rsp *http.Response, err error) bool {
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead ||
+		req.Method == http.MethodPut || req.Method == http.MethodDelete
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false
+		}
+		var opErr *net.OpError
+		return idempotent || (errors.As(err, &opErr) && opErr.Op == "dial")
+	}
+	switch rsp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package iceberg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	iceio "github.com/apache/iceberg-go/io"
+	"github.com/apache/iceberg-go/utils"
+	"github.com/stretchr/testify/require"
+	"github.com/transferia/transferia/pkg/abstract/model"
+)
+
+// clientCertificate is a self-signed client certificate and its key in PEM.
+func clientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "transfer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return cert,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// mtlsServer serves handler over TLS and accepts only clients presenting clientCert.
+func mtlsServer(t *testing.T, handler http.Handler, clientCert *x509.Certificate) (*httptest.Server, string) {
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+}
+
+func TestCatalogHTTP(t *testing.T) {
+	ctx := context.Background()
+	cert, certPEM, keyPEM := clientCertificate(t)
+
+	t.Run("mutual TLS", func(t *testing.T) {
+		srv, caPEM := mtlsServer(t, &fakeOAuthCatalog{revoked: map[string]bool{}}, cert)
+		src := &Source{CatalogType: CatalogTypeREST, CatalogURI: srv.URL, Auth: RESTAuthConfig{Credential: "client:secret", ServerURI: srv.URL + "/auth/token"}}
+		_, err := newCatalog(ctx, src.CatalogType, src.CatalogURI, src.catalogProperties())
+		require.ErrorContains(t, err, "certificate")
+
+		src.CatalogHTTP = HTTPConfig{CACertificates: caPEM, ClientCertificate: certPEM, ClientKey: model.SecretString(keyPEM)}
+		require.NoError(t, src.Validate())
+		cat, err := newCatalog(ctx, src.CatalogType, src.CatalogURI, src.catalogProperties())
+		require.NoError(t, err)
+		defer closeCatalog(cat)
+		namespaces, err := cat.ListNamespaces(ctx, nil)
+		require.NoError(t, err)
+		require.Equal(t, "t1", namespaces[0][0])
+
+		txs, err := newRESTTransactions(ctx, src.CatalogURI, src.catalogProperties())
+		require.NoError(t, err)
+		require.NotNil(t, txs)
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		var calls atomic.Int32
+		catalog := &fakeOAuthCatalog{revoked: map[string]bool{}}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/namespaces" && calls.Add(1) < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			catalog.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		src := &Source{CatalogType: CatalogTypeREST, CatalogURI: srv.URL, Auth: RESTAuthConfig{Token: "static"}, CatalogHTTP: HTTPConfig{MaxAttempts: 3, MaxBackoff: 10 * time.Millisecond}}
+		cat, err := newCatalog(ctx, src.CatalogType, src.CatalogURI, src.catalogProperties())
+		require.NoError(t, err)
+		defer closeCatalog(cat)
+		namespaces, err := cat.ListNamespaces(ctx, nil)
+		require.NoError(t, err)
+		require.Equal(t, "static", namespaces[0][0])
+		require.EqualValues(t, 3, calls.Load())
+	})
+
+	t.Run("options of other catalogs", func(t *testing.T) {
+		src := &Source{CatalogType: CatalogTypeSQL, CatalogURI: "sqlite:///tmp/catalog.db", CatalogHTTP: HTTPConfig{ProxyURI: "http://proxy:3128"}}
+		require.ErrorContains(t, src.Validate(), "not supported by the sql catalog")
+		src = &Source{CatalogType: CatalogTypeSQL, CatalogURI: "sqlite:///tmp/catalog.db", FileIOHTTP: HTTPConfig{CACertificates: "not a certificate"}}
+		require.ErrorContains(t, src.Validate(), "contain no PEM certificate")
+	})
+}
+
+func TestFileIOHTTP(t *testing.T) {
+	ctx := context.Background()
+	cert, certPEM, keyPEM := clientCertificate(t)
+	var objects atomic.Int32
+	srv, caPEM := mtlsServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if r.Method == http.MethodPut {
+			objects.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}), cert)
+
+	s3Props := iceberg.Properties{
+		iceio.S3EndpointURL:     srv.URL,
+		iceio.S3Region:          "us-east-1",
+		iceio.S3AccessKeyID:     "key",
+		iceio.S3SecretAccessKey: "secret",
+	}
+	props := HTTPConfig{CACertificates: caPEM, ClientCertificate: certPEM, ClientKey: model.SecretString(keyPEM), MaxAttempts: 2}.props(s3Props, s3HTTPPrefix)
+	awsConfig, err := s3AWSConfig(ctx, props)
+	require.NoError(t, err)
+	require.Equal(t, 2, awsConfig.Retryer().MaxAttempts())
+
+	fileIO, err := iceio.LoadFS(utils.WithAwsConfig(ctx, awsConfig), props, "s3://bucket/warehouse")
+	require.NoError(t, err)
+	require.NoError(t, fileIO.(iceio.WriteFileIO).WriteFile("s3://bucket/warehouse/file", []byte("data")))
+	require.EqualValues(t, 1, objects.Load())
+
+	// without the TLS options the certificate of the server is not trusted
+	awsConfig, err = s3AWSConfig(ctx, HTTPConfig{MaxAttempts: 1}.props(s3Props, s3HTTPPrefix))
+	require.NoError(t, err)
+	fileIO, err = iceio.LoadFS(utils.WithAwsConfig(ctx, awsConfig), s3Props, "s3://bucket/warehouse")
+	require.NoError(t, err)
+	require.Error(t, fileIO.(iceio.WriteFileIO).WriteFile("s3://bucket/warehouse/file", []byte("data")))
+
+	awsConfig, err = s3AWSConfig(ctx, iceberg.Properties{})
+	require.NoError(t, err)
+	require.Nil(t, awsConfig)
+}
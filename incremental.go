@@ -0,0 +1,139 @@
+package iceberg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/table"
+	"github.com/transferia/transferia/library/go/core/xerrors"
+	"github.com/transferia/transferia/pkg/abstract"
+	"go.ytsaurus.tech/library/go/core/log"
+)
+
+var _ abstract.IncrementalStorage = (*Storage)(nil)
+
+// tableIncrement is the data of a table appended after snapshot after up to snapshot upTo.
+// The loader keeps `"__iceberg_snapshot_id" > <id>` of the last snapshot read as the transfer state
+// and reads `(> <last>) AND NOT (> <current>)` next time. > and <= follow the lineage of the snapshots,
+// not the order of IDs.
+type tableIncrement struct {
+	after *int64 // nil reads the whole table as of upTo, 0 all data appended up to it
+	upTo  *int64 // nil is the snapshot the source reads
+}
+
+func incrementWhere(after int64) abstract.WhereStatement {
+	return abstract.WhereStatement(fmt.Sprintf(`"%s" > %d`, snapshotIDColumn, after))
+}
+
+// GetIncrementalState returns the cursors of the next increment: the current snapshots of the tables.
+func (s *Storage) GetIncrementalState(ctx context.Context, incremental []abstract.IncrementalTable) ([]abstract.TableDescription, error) {
+	var res []abstract.TableDescription
+	for _, tbl := range incremental {
+		if tbl.CursorField != "" && tbl.CursorField != snapshotIDColumn {
+			return nil, abstract.NewFatalError(xerrors.Errorf("cursor field of %s must be %s, Iceberg tables are read by snapshots", tbl.TableID().Fqtn(), snapshotIDColumn))
+		}
+		ident := table.Identifier{tbl.Namespace, tbl.Name}
+		itable, err := s.cat.LoadTable(ctx, ident, s.props)
+		if err != nil {
+			return nil, xerrors.Errorf("unable to load table: %v: %w", ident, err)
+		}
+		snapshot, err := s.snapshot(itable)
+		if err != nil {
+			return nil, xerrors.Errorf("unable to read %v: %w", ident, err)
+		}
+		var current int64
+		if snapshot != nil {
+			current = snapshot.SnapshotID
+		}
+		res = append(res, abstract.TableDescription{
+			Name:   tbl.Name,
+			Schema: tbl.Namespace,
+			Filter: incrementWhere(current),
+			EtaRow: 0,
+			Offset: 0,
+		})
+	}
+	return res, nil
+}
+
+// SetInitialState makes the first load of tables with an initial state, the ID of a snapshot, read the data appended after it.
+func (s *Storage) SetInitialState(tables []abstract.TableDescription, incremental []abstract.IncrementalTable) {
+	for i, tdesc := range tables {
+		if tdesc.Filter != "" || tdesc.Offset != 0 {
+			// tdesc already contains predicate
+			continue
+		}
+		for _, tbl := range incremental {
+			if tbl.InitialState == "" || tdesc.ID() != tbl.TableID() {
+				continue
+			}
+			after, err := strconv.ParseInt(tbl.InitialState, 10, 64)
+			if err != nil {
+				s.logger.Warn("initial state of the table is not a snapshot ID, the table is read as a whole",
+					log.String("table", tdesc.Fqtn()), log.String("initial_state", tbl.InitialState))
+				continue
+			}
+			tables[i].Filter = incrementWhere(after)
+		}
+	}
+}
+
+// appendedFiles are the data files added by the append snapshots after snapshot after up to head, oldest first.
+// Other snapshots in between are skipped: replaces only compact the data already read,
+// overwrites and deletes change it, which an append-only increment does not carry.
+func (s *Storage) appendedFiles(itable *table.Table, head *table.Snapshot, after int64) ([]*tableShard, error) {
+	meta := itable.Metadata()
+	var lineage []*table.Snapshot
+	snapshot := head
+	for snapshot != nil && snapshot.SnapshotID != after {
+		lineage = append(lineage, snapshot)
+		if snapshot.ParentSnapshotID == nil {
+			snapshot = nil
+			break
+		}
+		parentID := *snapshot.ParentSnapshotID
+		if snapshot = meta.SnapshotByID(parentID); snapshot == nil {
+			return nil, xerrors.Errorf("snapshot %d is expired, the increment can not be read", parentID)
+		}
+	}
+	if snapshot == nil && after != 0 {
+		return nil, xerrors.Errorf("snapshot %d is not an ancestor of the snapshot read", after)
+	}
+
+	var shards []*tableShard
+	for _, snapshot := range slices.Backward(lineage) {
+		if snapshot.Summary == nil || snapshot.Summary.Operation != table.OpAppend {
+			if snapshot.Summary != nil && snapshot.Summary.Operation != table.OpReplace {
+				s.logger.Warn("snapshot of the increment is not an append, its changes are skipped",
+					log.Int64("snapshot", snapshot.SnapshotID), log.String("operation", string(snapshot.Summary.Operation)))
+			}
+			continue
+		}
+		manifests, err := snapshot.Manifests(itable.FS())
+		if err != nil {
+			return nil, xerrors.Errorf("unable to read manifest list of snapshot %d: %w", snapshot.SnapshotID, err)
+		}
+		shard := &tableShard{snapshotID: snapshot.SnapshotID}
+		for _, m := range manifests {
+			if m.ManifestContent() != iceberg.ManifestContentData || m.SnapshotID() != snapshot.SnapshotID {
+				continue
+			}
+			entries, err := m.FetchEntries(itable.FS(), true)
+			if err != nil {
+				return nil, xerrors.Errorf("unable to read manifest %s: %w", m.FilePath(), err)
+			}
+			for _, entry := range entries {
+				if entry.Status() == iceberg.EntryStatusADDED && entry.SnapshotID() == snapshot.SnapshotID {
+					shard.files = append(shard.files, entry.DataFile().FilePath())
+				}
+			}
+		}
+		if len(shard.files) > 0 {
+			shards = append(shards, shard)
+		}
+	}
+	return shards, nil
+}
@@ -0,0 +1,82 @@
+package iceberg
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+	"github.com/transferia/iceberg/logger"
+	"github.com/transferia/transferia/library/go/core/metrics/solomon"
+	"github.com/transferia/transferia/pkg/abstract"
+)
+
+func TestStorageIncremental(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	writeUsers(t, dst, 0, 1, 3)
+	storage, err := NewStorage(localSource(dst), logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer storage.Close()
+	incremental := []abstract.IncrementalTable{{Namespace: "public", Name: "users"}}
+	currentSnapshot := func() int64 {
+		itable, err := storage.cat.LoadTable(ctx, table.Identifier{"public", "users"}, nil)
+		require.NoError(t, err)
+		return itable.CurrentSnapshot().SnapshotID
+	}
+	// load runs as the snapshot loader does: the cursor read before the load bounds it and is kept for the next one
+	load := func(state abstract.WhereStatement) ([]string, abstract.WhereStatement) {
+		next, err := storage.GetIncrementalState(ctx, incremental)
+		require.NoError(t, err)
+		require.Len(t, next, 1)
+		desc := abstract.TableDescription{Schema: "public", Name: "users", Filter: state}
+		if state == "" {
+			tables := []abstract.TableDescription{desc}
+			storage.SetInitialState(tables, incremental)
+			desc = tables[0]
+		}
+		desc.Filter = abstract.FiltersIntersection(desc.Filter, abstract.NotStatement(next[0].Filter))
+		parts, err := storage.ShardTable(ctx, desc)
+		require.NoError(t, err)
+		require.Equal(t, []abstract.TableDescription{desc}, parts)
+		var ids []string
+		for _, row := range loadRows(t, storage, desc) {
+			ids = append(ids, fmt.Sprint(row.ColumnValues[0]))
+		}
+		return ids, next[0].Filter
+	}
+
+	// the first load reads the whole table
+	ids, state := load("")
+	require.Equal(t, []string{"0", "1", "2"}, ids)
+	first := currentSnapshot()
+	require.Equal(t, incrementWhere(first), state)
+
+	writeUsers(t, dst, 3, 2, 2)
+	ids, state = load(state)
+	require.ElementsMatch(t, []string{"3", "4", "5", "6"}, ids)
+	second := currentSnapshot()
+	require.Equal(t, incrementWhere(second), state)
+
+	ids, _ = load(state)
+	require.Empty(t, ids)
+
+	// the initial state is the snapshot the first increment starts after
+	incremental[0].CursorField = snapshotIDColumn
+	incremental[0].InitialState = strconv.FormatInt(first, 10)
+	writeUsers(t, dst, 7, 1, 1)
+	ids, _ = load("")
+	require.ElementsMatch(t, []string{"3", "4", "5", "6", "7"}, ids)
+	rows := loadRows(t, storage, abstract.TableDescription{Schema: "public", Name: "users", Filter: abstract.FiltersIntersection(incrementWhere(second), "id > 1")})
+	require.Len(t, rows, 1)
+	require.EqualValues(t, uint32(currentSnapshot()), rows[0].ID)
+
+	err = storage.LoadTable(ctx, abstract.TableDescription{Schema: "public", Name: "users", Filter: incrementWhere(1)}, func([]abstract.ChangeItem) error { return nil })
+	require.ErrorContains(t, err, "snapshot 1 is not an ancestor")
+
+	incremental[0].CursorField = "id"
+	_, err = storage.GetIncrementalState(ctx, incremental)
+	require.ErrorContains(t, err, "cursor field of")
+}
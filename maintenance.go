@@ -0,0 +1,211 @@
+package iceberg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/table"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+// RewriteManifests rewrites data manifests of the head of branch, main when empty, so that entries
+// are clustered by partition and each manifest is close to commit.manifest.target-size-bytes.
+// It commits a replace snapshot to the branch, table data stays untouched.
+func RewriteManifests(ctx context.Context, cat catalog.Catalog, tbl *table.Table, branch string, snapshotProps iceberg.Properties) (*table.Table, error) {
+	u := newSnapshotUpdate(cat, tbl, snapshotProps).toBranch(branch)
+	current := branchHead(tbl.Metadata(), u.branch)
+	if current == nil {
+		return tbl, nil
+	}
+	fileIO, err := u.writeIO()
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := current.Manifests(tbl.FS())
+	if err != nil {
+		return nil, xerrors.Errorf("read manifests of snapshot %d: %w", current.SnapshotID, err)
+	}
+
+	var (
+		kept    []iceberg.ManifestFile
+		specIDs []int32
+		groups  = map[int32][]iceberg.ManifestFile{}
+	)
+	for _, m := range manifests {
+		if m.ManifestContent() != iceberg.ManifestContentData {
+			kept = append(kept, m)
+			continue
+		}
+		if _, ok := groups[m.PartitionSpecID()]; !ok {
+			specIDs = append(specIDs, m.PartitionSpecID())
+		}
+		groups[m.PartitionSpecID()] = append(groups[m.PartitionSpecID()], m)
+	}
+
+	targetSize := int64(tbl.Properties().GetInt(table.ManifestTargetSizeBytesKey, table.ManifestTargetSizeBytesDefault))
+	snapshotID := newSnapshotID(tbl.Metadata())
+	var (
+		created   []iceberg.ManifestFile
+		replaced  int
+		processed int
+	)
+	for _, specID := range specIDs {
+		group := groups[specID]
+		if len(group) < 2 {
+			kept = append(kept, group...)
+			continue
+		}
+		spec, err := specByID(tbl.Metadata(), int(specID))
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			entries []iceberg.ManifestEntry
+			size    int64
+		)
+		for _, m := range group {
+			manifestEntries, err := m.FetchEntries(tbl.FS(), true)
+			if err != nil {
+				return nil, xerrors.Errorf("read manifest %s: %w", m.FilePath(), err)
+			}
+			entries = append(entries, manifestEntries...)
+			size += m.Length()
+		}
+		replaced += len(group)
+		processed += len(entries)
+		if len(entries) == 0 {
+			continue
+		}
+
+		slices.SortStableFunc(entries, func(a, b iceberg.ManifestEntry) int {
+			return strings.Compare(partitionKey(spec, a.DataFile()), partitionKey(spec, b.DataFile()))
+		})
+
+		// entry size is estimated from the manifests being replaced
+		perManifest := len(entries)
+		if size > targetSize {
+			perManifest = int(int64(len(entries)) * targetSize / size)
+			perManifest = max(perManifest, 1)
+		}
+		for chunk := range slices.Chunk(entries, perManifest) {
+			m, err := u.writeManifest(fileIO, snapshotID, int(specID), chunk, func(w *iceberg.ManifestWriter, entry iceberg.ManifestEntry) error {
+				return w.Existing(entry)
+			})
+			if err != nil {
+				return nil, err
+			}
+			created = append(created, m)
+		}
+	}
+	if replaced == 0 {
+		return tbl, nil
+	}
+
+	summary := iceberg.Properties{}
+	for k, v := range snapshotProps {
+		summary[k] = v
+	}
+	summary[summaryManifestsCreated] = strconv.Itoa(len(created))
+	summary[summaryManifestsKept] = strconv.Itoa(len(kept))
+	summary[summaryManifestsReplaced] = strconv.Itoa(replaced)
+	summary[summaryEntriesProcessed] = strconv.Itoa(processed)
+	updateSummaryTotals(summary, current)
+
+	change, err := u.stageSnapshot(fileIO, &table.Snapshot{
+		SnapshotID:     snapshotID,
+		SequenceNumber: nextSequenceNumber(tbl.Metadata()),
+		Summary:        &table.Summary{Operation: table.OpReplace, Properties: summary},
+	}, current, append(created, kept...))
+	if err != nil {
+		return nil, err
+	}
+	return change.commit(ctx, cat)
+}
+
+// partitionKey renders partition values in spec order, it is used for sorting and matching partitions.
+func partitionKey(spec iceberg.PartitionSpec, df iceberg.DataFile) string {
+	values := df.Partition()
+	parts := make([]string, 0, spec.NumFields())
+	for i := range spec.NumFields() {
+		field := spec.Field(i)
+		parts = append(parts, fmt.Sprintf("%v", values[field.Name]))
+	}
+	return strings.Join(parts, "/")
+}
+
+// purger is implemented by catalogs able to drop a table together with its files.
+type purger interface {
+	PurgeTable(ctx context.Context, identifier table.Identifier) error
+}
+
+// purgeTable drops the table and removes all its data and metadata files. Catalogs
+// with their own purge do it server side, for the rest files reachable from the
+// table metadata are removed here once the table is dropped.
+func purgeTable(ctx context.Context, cat catalog.Catalog, tbl *table.Table) error {
+	if p, ok := cat.(purger); ok {
+		if err := p.PurgeTable(ctx, tbl.Identifier()); err != nil {
+			return xerrors.Errorf("purge table: %w", err)
+		}
+		return nil
+	}
+
+	files, err := reachableFiles(tbl)
+	if err != nil {
+		return xerrors.Errorf("list table files: %w", err)
+	}
+	if err := cat.DropTable(ctx, tbl.Identifier()); err != nil {
+		return xerrors.Errorf("drop table: %w", err)
+	}
+	for _, file := range files {
+		if err := tbl.FS().Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return xerrors.Errorf("remove %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// reachableFiles lists data, manifest and metadata files of every snapshot of the table.
+func reachableFiles(tbl *table.Table) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	add := func(path string) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	for _, snapshot := range tbl.Metadata().Snapshots() {
+		manifests, err := snapshot.Manifests(tbl.FS())
+		if err != nil {
+			return nil, xerrors.Errorf("read manifests of snapshot %d: %w", snapshot.SnapshotID, err)
+		}
+		for _, m := range manifests {
+			if seen[m.FilePath()] {
+				continue
+			}
+			entries, err := m.FetchEntries(tbl.FS(), false)
+			if err != nil {
+				return nil, xerrors.Errorf("read manifest %s: %w", m.FilePath(), err)
+			}
+			for _, entry := range entries {
+				add(entry.DataFile().FilePath())
+			}
+			add(m.FilePath())
+		}
+		add(snapshot.ManifestList)
+	}
+	for entry := range tbl.Metadata().PreviousFiles() {
+		add(entry.MetadataFile)
+	}
+	add(tbl.MetadataLocation())
+	return files, nil
+}
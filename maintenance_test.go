@@ -0,0 +1,35 @@
+package iceberg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteManifestsOnBranch(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	writeUsers(t, dst, 0, 1, 2)
+	writeUsers(t, dst, 2, 1, 2)
+	cat, tbl := usersTable(t, dst)
+	head := tbl.CurrentSnapshot()
+	tbl = setBranch(t, cat, tbl, "audit", head.SnapshotID)
+	tbl, err := newSnapshotUpdate(cat, tbl, nil).overwriteAll().commit(ctx)
+	require.NoError(t, err)
+	main := tbl.CurrentSnapshot()
+
+	tbl, err = RewriteManifests(ctx, cat, tbl, "audit", nil)
+	require.NoError(t, err)
+	require.Equal(t, main.SnapshotID, tbl.CurrentSnapshot().SnapshotID, "main is left alone")
+	rewritten := branchHead(tbl.Metadata(), "audit")
+	require.Equal(t, table.OpReplace, rewritten.Summary.Operation)
+	require.Equal(t, head.SnapshotID, *rewritten.ParentSnapshotID)
+	manifests, err := rewritten.Manifests(tbl.FS())
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	rows, err := snapshotRowCount(ctx, tbl, rewritten.SnapshotID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), rows)
+}
@@ -0,0 +1,203 @@
+package iceberg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+const (
+	// nessieRefKey is the branch, tag or <name>@<hash> the nessie catalog works on, the default branch when empty
+	nessieRefKey = "nessie.ref"
+	// nessieBaseRefKey is the reference a missing nessieRefKey branch is created from, a missing one is an error when empty
+	nessieBaseRefKey = "nessie.base-ref"
+	// nessieAPIURIKey is the Nessie API v2 endpoint, by default /api/v2 next to the /iceberg endpoint of the catalog URI
+	nessieAPIURIKey = "nessie.api-uri"
+)
+
+var errNessieNoSuchRef = xerrors.New("nessie reference does not exist")
+
+func init() {
+	catalog.Register(CatalogTypeNessie, catalog.RegistrarFunc(func(ctx context.Context, _ string, props iceberg.Properties) (catalog.Catalog, error) {
+		return newNessieCatalog(ctx, props)
+	}))
+}
+
+// newNessieCatalog opens the Iceberg REST API of Nessie at the reference in nessieRefKey, so tables are read
+// from and committed to that reference. Nessie serves the API of a reference under /iceberg/<ref>.
+func newNessieCatalog(ctx context.Context, props iceberg.Properties) (catalog.Catalog, error) {
+	uri := props.Get("uri", "")
+	transport, err := restTransport(ctx, props)
+	if err != nil {
+		return nil, err
+	}
+	if ref := props.Get(nessieRefKey, ""); ref != "" {
+		api, err := newNessieAPI(uri, props, transport)
+		if err != nil {
+			return nil, err
+		}
+		if err := api.ensureRef(ctx, ref, props.Get(nessieBaseRefKey, "")); err != nil {
+			return nil, err
+		}
+	}
+
+	restProps := iceberg.Properties{}
+	maps.Copy(restProps, props)
+	for _, key := range []string{nessieRefKey, nessieBaseRefKey, nessieAPIURIKey} {
+		delete(restProps, key)
+	}
+	restProps["type"] = CatalogTypeREST
+	restProps["uri"] = nessieRefURI(uri, props.Get(nessieRefKey, ""))
+	return loadRESTCatalog(ctx, restProps)
+}
+
+// nessieRefURI is the Iceberg REST endpoint of ref under the Nessie catalog uri.
+func nessieRefURI(uri, ref string) string {
+	if ref == "" {
+		return uri
+	}
+	return strings.TrimSuffix(uri, "/") + "/" + url.PathEscape(ref)
+}
+
+// nessieProps adds the reference of a source or destination to the catalog properties.
+func nessieProps(props iceberg.Properties, ref, baseRef string) iceberg.Properties {
+	if ref == "" && baseRef == "" {
+		return props
+	}
+	result := iceberg.Properties{}
+	maps.Copy(result, props)
+	if ref != "" {
+		result[nessieRefKey] = ref
+	}
+	if baseRef != "" {
+		result[nessieBaseRefKey] = baseRef
+	}
+	return result
+}
+
+// restCatalogURI is the REST endpoint of the catalog, with the reference for Nessie.
+func restCatalogURI(catalogType, uri string, props iceberg.Properties) string {
+	if catalogType == CatalogTypeNessie {
+		return nessieRefURI(uri, props[nessieRefKey])
+	}
+	return uri
+}
+
+type nessieReference struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// nessieAPI handles references through the Nessie API v2.
+type nessieAPI struct {
+	baseURI *url.URL
+	client  *http.Client
+	tokens  *restTokenSource
+}
+
+func newNessieAPI(catalogURI string, props iceberg.Properties, transport http.RoundTripper) (*nessieAPI, error) {
+	apiURI := props.Get(nessieAPIURIKey, "")
+	if apiURI == "" {
+		parsed, err := url.Parse(catalogURI)
+		if err != nil {
+			return nil, xerrors.Errorf("parse catalog uri: %w", err)
+		}
+		parsed.Path = strings.TrimSuffix(strings.TrimSuffix(parsed.Path, "/"), "/iceberg") + "/api/v2"
+		apiURI = parsed.String()
+	}
+	base, err := url.Parse(apiURI)
+	if err != nil {
+		return nil, xerrors.Errorf("parse nessie api uri: %w", err)
+	}
+	tokens, err := newRESTTokenSource(catalogURI, props)
+	if err != nil {
+		return nil, err
+	}
+	return &nessieAPI{baseURI: base, client: &http.Client{Transport: transport}, tokens: tokens}, nil
+}
+
+// ensureRef checks that ref exists. A missing branch is created from the head of baseRef if it is set.
+func (a *nessieAPI) ensureRef(ctx context.Context, ref, baseRef string) error {
+	_, err := a.getReference(ctx, ref)
+	if !xerrors.Is(err, errNessieNoSuchRef) || baseRef == "" {
+		return err
+	}
+	base, err := a.getReference(ctx, baseRef)
+	if err != nil {
+		return xerrors.Errorf("base of branch %s: %w", ref, err)
+	}
+	if err := a.createBranch(ctx, ref, base); err != nil {
+		return xerrors.Errorf("create branch %s from %s: %w", ref, baseRef, err)
+	}
+	return nil
+}
+
+func (a *nessieAPI) getReference(ctx context.Context, ref string) (*nessieReference, error) {
+	var rsp struct {
+		Reference nessieReference `json:"reference"`
+	}
+	status, err := a.do(ctx, http.MethodGet, a.baseURI.JoinPath("trees", ref), nil, &rsp)
+	if status == http.StatusNotFound {
+		return nil, xerrors.Errorf("%s: %w", ref, errNessieNoSuchRef)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("get reference %s: %w", ref, err)
+	}
+	return &rsp.Reference, nil
+}
+
+// createBranch creates branch name at the head of from, a branch created concurrently by another worker is fine.
+func (a *nessieAPI) createBranch(ctx context.Context, name string, from *nessieReference) error {
+	route := a.baseURI.JoinPath("trees")
+	route.RawQuery = url.Values{"name": {name}, "type": {"BRANCH"}}.Encode()
+	status, err := a.do(ctx, http.MethodPost, route, from, nil)
+	if status == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+func (a *nessieAPI) do(ctx context.Context, method string, route *url.URL, body, result any) (int, error) {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return 0, xerrors.Errorf("encode request: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, route.String(), &reqBody)
+	if err != nil {
+		return 0, xerrors.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token, err := a.tokens.get(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rsp, err := a.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return rsp.StatusCode, restError(rsp)
+	}
+	if result != nil {
+		if err := json.NewDecoder(rsp.Body).Decode(result); err != nil {
+			return rsp.StatusCode, xerrors.Errorf("decode response: %w", err)
+		}
+	}
+	return rsp.StatusCode, nil
+}
@@ -0,0 +1,110 @@
+package iceberg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNessie serves the reference API of Nessie and records the Iceberg REST paths it is called with.
+type fakeNessie struct {
+	mu    sync.Mutex
+	refs  map[string]nessieReference
+	paths []string
+}
+
+func (n *fakeNessie) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v2/trees/"):
+		ref, ok := n.refs[strings.TrimPrefix(r.URL.Path, "/api/v2/trees/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"reference": ref})
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2/trees":
+		var from nessieReference
+		if err := json.NewDecoder(r.Body).Decode(&from); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		if _, ok := n.refs[name]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		n.refs[name] = nessieReference{Type: r.URL.Query().Get("type"), Name: name, Hash: from.Hash}
+		_ = json.NewEncoder(w).Encode(map[string]any{"reference": n.refs[name]})
+	case strings.HasSuffix(r.URL.Path, "/v1/config"):
+		n.paths = append(n.paths, r.URL.Path)
+		_, _ = w.Write([]byte(`{"defaults":{},"overrides":{}}`))
+	case strings.HasSuffix(r.URL.Path, "/v1/namespaces"):
+		n.paths = append(n.paths, r.URL.Path)
+		_, _ = w.Write([]byte(`{"namespaces":[["db"]]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestNessieCatalog(t *testing.T) {
+	ctx := context.Background()
+	nessie := &fakeNessie{refs: map[string]nessieReference{
+		"main":      {Type: "BRANCH", Name: "main", Hash: "abc"},
+		"release-1": {Type: "TAG", Name: "release-1", Hash: "def"},
+	}}
+	srv := httptest.NewServer(nessie)
+	defer srv.Close()
+	uri := srv.URL + "/iceberg"
+
+	t.Run("destination branch is created from base", func(t *testing.T) {
+		dst := &Destination{CatalogType: CatalogTypeNessie, CatalogURI: uri, NessieRef: "load_{transfer_id}", NessieBaseRef: "main"}
+		props := dst.catalogProperties(dst.refNames("t1", time.Now()))
+		cat, err := newCatalog(ctx, CatalogTypeNessie, uri, props)
+		require.NoError(t, err)
+		require.Equal(t, catalog.REST, cat.CatalogType())
+		require.Equal(t, nessieReference{Type: "BRANCH", Name: "load_t1", Hash: "abc"}, nessie.refs["load_t1"])
+
+		namespaces, err := cat.ListNamespaces(ctx, nil)
+		require.NoError(t, err)
+		require.Equal(t, []table.Identifier{{"db"}}, namespaces)
+		require.Contains(t, nessie.paths, "/iceberg/load_t1/v1/namespaces")
+		require.Equal(t, uri+"/load_t1", restCatalogURI(CatalogTypeNessie, uri, props))
+
+		// another worker opens the catalog once the branch exists
+		_, err = newCatalog(ctx, CatalogTypeNessie, uri, props)
+		require.NoError(t, err)
+	})
+
+	t.Run("source reads a tag", func(t *testing.T) {
+		src := &Source{CatalogType: CatalogTypeNessie, CatalogURI: uri, NessieRef: "release-1"}
+		_, err := newCatalog(ctx, CatalogTypeNessie, uri, nessieProps(src.Properties, src.NessieRef, ""))
+		require.NoError(t, err)
+		require.Contains(t, nessie.paths, "/iceberg/release-1/v1/config")
+	})
+
+	t.Run("missing ref", func(t *testing.T) {
+		_, err := newCatalog(ctx, CatalogTypeNessie, uri, iceberg.Properties{nessieRefKey: "missing"})
+		require.ErrorIs(t, err, errNessieNoSuchRef)
+		_, err = newCatalog(ctx, CatalogTypeNessie, uri, iceberg.Properties{nessieRefKey: "dev", nessieBaseRefKey: "missing"})
+		require.ErrorIs(t, err, errNessieNoSuchRef)
+		require.NotContains(t, nessie.refs, "dev")
+	})
+
+	t.Run("default branch", func(t *testing.T) {
+		_, err := newCatalog(ctx, CatalogTypeNessie, uri, nil)
+		require.NoError(t, err)
+		require.Contains(t, nessie.paths, "/iceberg/v1/config")
+	})
+}
@@ -0,0 +1,59 @@
+package iceberg
+
+import (
+	"slices"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+	"github.com/transferia/transferia/pkg/abstract"
+	"github.com/transferia/transferia/pkg/abstract/model"
+	"github.com/transferia/transferia/pkg/transformer/registry/filter"
+	"github.com/transferia/transferia/pkg/util"
+	"go.ytsaurus.tech/library/go/core/log"
+)
+
+// columnFilters are the filter_columns transformers the transfer starts with, the storage reads only the columns they keep.
+// A filter after another transformer is left out, that one may need the columns or change the table it applies to.
+func columnFilters(transfer *model.Transfer, logger log.Logger) ([]*filter.FilterColumnsTransformer, error) {
+	if transfer == nil {
+		return nil, nil
+	}
+	var filters []*filter.FilterColumnsTransformer
+	for _, cfg := range transfer.TransformationConfigs() {
+		if cfg.Type() != filter.FilterColumnsTransformerType {
+			break
+		}
+		var columnsCfg filter.FilterColumnsConfig
+		if err := util.MapFromJSON(cfg.Config(), &columnsCfg); err != nil {
+			return nil, xerrors.Errorf("unable to parse %s transformer: %w", cfg.Type(), err)
+		}
+		f, err := filter.NewFilterColumnsTransformer(columnsCfg, logger)
+		if err != nil {
+			return nil, xerrors.Errorf("unable to init %s transformer: %w", cfg.Type(), err)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// projection is the columns of the table the column filters keep, nil when all of them are read.
+// Filters apply one after another, skipping the ones unsuitable for the table as the transformers do.
+// Required columns, like the ones a row filter checks, are read anyway.
+func (s *Storage) projection(tid abstract.TableID, schema *abstract.TableSchema, required []string) []abstract.ColSchema {
+	columns := schema.Columns()
+	for _, f := range s.columnFilters {
+		if !f.Suitable(tid, abstract.NewTableSchema(columns)) {
+			continue
+		}
+		var kept []abstract.ColSchema
+		for _, col := range columns {
+			if f.Columns.Match(col.ColumnName) || slices.Contains(required, col.ColumnName) {
+				kept = append(kept, col)
+			}
+		}
+		columns = kept
+	}
+	if len(columns) == len(schema.Columns()) || len(columns) == 0 {
+		return nil
+	}
+	return columns
+}
@@ -56,7 +56,7 @@ func (p *Provider) Sink(config middlewares.Config) (abstract.Sinker, error) {
 	if !p.transfer.SnapshotOnly() {
 		return nil, xerrors.Errorf("only snapshot and streaming supported")
 	}
-	return NewSinkSnapshot(dst, p.cp, p.transfer)
+	return NewSinkSnapshot(dst, p.cp, p.transfer, p.logger, p.registry)
 }
 
 func (p Provider) Type() abstract.ProviderType {
@@ -69,7 +69,18 @@ func (p Provider) Storage() (abstract.Storage, error) {
 		return nil, xerrors.Errorf("unexpected src type: %T", p.transfer.Src)
 	}
 
-	return NewStorage(src, p.logger, p.registry)
+	filters, err := columnFilters(p.transfer, p.logger)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to resolve column filters: %w", err)
+	}
+	storage, err := NewStorage(src, p.logger, p.registry)
+	if err != nil {
+		return nil, err
+	}
+	storage.columnFilters = filters
+	storage.cp = p.cp
+	storage.transferID = p.transfer.ID
+	return storage, nil
 }
 
 func New(lgr log.Logger, registry metrics.Registry, cp coordinator.Coordinator, transfer *model.Transfer) providers.Provider {
@@ -1,19 +1,35 @@
 package iceberg
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/transferia/iceberg/logger"
 	"github.com/transferia/transferia/library/go/core/metrics/solomon"
 	"github.com/transferia/transferia/pkg/abstract"
 
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	go_iceberg "github.com/apache/iceberg-go"
 	"github.com/apache/iceberg-go/io"
+	"github.com/google/uuid"
+	"google.golang.org/api/googleapi"
 
 	"github.com/transferia/transferia/library/go/core/xerrors"
 )
 
+const (
+	recipeBucket   = "iceberg-recipe"
+	azuriteAccount = "devstoreaccount1"
+	// azuriteKey is the well-known key of the Azurite account
+	azuriteKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
 func SourceRecipe() (*Source, error) {
 	if _, ok := os.LookupEnv("AWS_S3_ENDPOINT"); ok {
 		return &Source{
@@ -48,20 +64,111 @@ func DestinationRecipe() (*Destination, error) {
 			CommitInterval: 1 * time.Minute,
 		}, nil
 	}
-	return nil, xerrors.New("recipe not supported")
+	if _, ok := os.LookupEnv("STORAGE_EMULATOR_HOST"); ok {
+		return GCSDestinationRecipe()
+	}
+	if _, ok := os.LookupEnv("AZURITE_ENDPOINT"); ok {
+		return AzureDestinationRecipe()
+	}
+	return LocalDestinationRecipe()
+}
+
+// LocalDestinationRecipe keeps the catalog in a SQLite file and data on the local disk,
+// so tests run without the REST catalog and S3 of the docker recipe.
+func LocalDestinationRecipe() (*Destination, error) {
+	dir, err := os.MkdirTemp("", "iceberg-recipe-")
+	if err != nil {
+		return nil, xerrors.Errorf("unable to create warehouse dir: %w", err)
+	}
+	return &Destination{
+		Properties:     go_iceberg.Properties{"warehouse": "file://" + dir},
+		CatalogType:    CatalogTypeSQL,
+		CatalogURI:     "file:" + filepath.Join(dir, "catalog.db"),
+		Schema:         "default",
+		Prefix:         "file://" + dir,
+		CommitInterval: 1 * time.Minute,
+	}, nil
+}
+
+// GCSDestinationRecipe keeps tables of the hadoop catalog in a fresh directory of the fake-gcs-server
+// at STORAGE_EMULATOR_HOST, the bucket is created if needed.
+func GCSDestinationRecipe() (*Destination, error) {
+	if _, ok := os.LookupEnv("STORAGE_EMULATOR_HOST"); !ok {
+		return nil, xerrors.New("recipe requires STORAGE_EMULATOR_HOST")
+	}
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init GCS client: %w", err)
+	}
+	defer client.Close()
+	var apiErr *googleapi.Error
+	if err := client.Bucket(recipeBucket).Create(ctx, "recipe", nil); err != nil && !(errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict) {
+		return nil, xerrors.Errorf("unable to create bucket: %w", err)
+	}
+	prefix := "gs://" + recipeBucket + "/" + uuid.NewString()
+	return &Destination{
+		Properties:     go_iceberg.Properties{"warehouse": prefix},
+		CatalogType:    CatalogTypeHadoop,
+		Schema:         "default",
+		Prefix:         prefix,
+		CommitInterval: 1 * time.Minute,
+	}, nil
+}
+
+// AzureDestinationRecipe keeps tables of the hadoop catalog in a fresh directory of the Azurite blob service
+// at AZURITE_ENDPOINT, such as http://127.0.0.1:10000/devstoreaccount1, the container is created if needed.
+// Azurite has to be started with --skipApiVersionCheck for the API version of the SDK.
+func AzureDestinationRecipe() (*Destination, error) {
+	endpoint, ok := os.LookupEnv("AZURITE_ENDPOINT")
+	if !ok {
+		return nil, xerrors.New("recipe requires AZURITE_ENDPOINT")
+	}
+	props := go_iceberg.Properties{
+		adlsConnectionStringPrefix + azuriteAccount: endpoint,
+		adlsSharedKeyAccountName:                    azuriteAccount,
+		adlsSharedKeyAccountKey:                     azuriteKey,
+	}
+	cred, err := container.NewSharedKeyCredential(azuriteAccount, azuriteKey)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid Azurite key: %w", err)
+	}
+	client, err := container.NewClientWithSharedKeyCredential(endpoint+"/"+recipeBucket, cred, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init Azurite client: %w", err)
+	}
+	if _, err := client.Create(context.Background(), nil); err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+		return nil, xerrors.Errorf("unable to create container: %w", err)
+	}
+	prefix := "abfss://" + recipeBucket + "@" + azuriteAccount + ".dfs.core.windows.net/" + uuid.NewString()
+	props["warehouse"] = prefix
+	return &Destination{
+		Properties:     props,
+		CatalogType:    CatalogTypeHadoop,
+		Schema:         "default",
+		Prefix:         prefix,
+		CommitInterval: 1 * time.Minute,
+	}, nil
 }
 
 func DestinationRowCount(target *Destination, schema, table string) (uint64, error) {
 	src := &Source{
-		Properties:  target.Properties,
-		CatalogType: target.CatalogType,
-		CatalogURI:  target.CatalogURI,
-		Schema:      "public",
+		Properties:        target.Properties,
+		CatalogType:       target.CatalogType,
+		CatalogURI:        target.CatalogURI,
+		NessieRef:         target.NessieRef,
+		Auth:              target.Auth,
+		SigV4:             target.SigV4,
+		CatalogHTTP:       target.CatalogHTTP,
+		FileIOHTTP:        target.FileIOHTTP,
+		VendedCredentials: target.VendedCredentials,
+		Schema:            "public",
 	}
 	storage, err := NewStorage(src, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
 	if err != nil {
 		return 0, xerrors.Errorf("could not create storage: %w", err)
 	}
+	defer storage.Close()
 	rowsInSrc, err := storage.ExactTableRowsCount(abstract.TableID{
 		Namespace: schema,
 		Name:      table,
@@ -0,0 +1,461 @@
+package iceberg
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"iter"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/catalog/rest"
+	"github.com/apache/iceberg-go/table"
+	"github.com/transferia/transferia/pkg/abstract/model"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+// Catalog properties of the REST authentication, named as in Iceberg.
+const (
+	restTokenKey      = "token"
+	restCredentialKey = "credential"
+	restScopeKey      = "scope"
+	restServerURIKey  = "oauth2-server-uri"
+
+	restDefaultScope = "catalog"
+)
+
+var restAuthKeys = []string{restTokenKey, restCredentialKey, restScopeKey, restServerURIKey}
+
+var (
+	_ catalog.Catalog = (*restCatalog)(nil)
+	_ purger          = (*restCatalog)(nil)
+)
+
+// RESTAuthConfig authenticates the rest and nessie catalogs. Secrets set here take precedence
+// over "token" and "credential" in Properties.
+type RESTAuthConfig struct {
+	Token      model.SecretString // Static bearer token
+	Credential model.SecretString // OAuth2 client credentials as <client_id>:<client_secret>, or a bare secret
+	Scope      string             // OAuth2 scope, catalog when empty
+	ServerURI  string             // OAuth2 token endpoint, <CatalogURI>/v1/oauth/tokens when empty
+}
+
+// props adds the authentication to catalog properties.
+func (a RESTAuthConfig) props(props iceberg.Properties) iceberg.Properties {
+	if a == (RESTAuthConfig{}) {
+		return props
+	}
+	result := iceberg.Properties{}
+	maps.Copy(result, props)
+	for key, value := range map[string]string{
+		restTokenKey:      string(a.Token),
+		restCredentialKey: string(a.Credential),
+		restScopeKey:      a.Scope,
+		restServerURIKey:  a.ServerURI,
+	} {
+		if value != "" {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+func (a RESTAuthConfig) validate() error {
+	if a.ServerURI != "" {
+		if parsed, err := url.Parse(a.ServerURI); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return xerrors.Errorf("OAuth2 server URI %q must be an http or https URL", a.ServerURI)
+		}
+	}
+	if (a.Scope != "" || a.ServerURI != "") && a.Credential == "" {
+		return xerrors.New("OAuth2 scope and server URI require a credential")
+	}
+	return nil
+}
+
+// restTokenSource provides the bearer token of the catalog: the static token, or an access token
+// obtained with the client credentials grant and fetched again shortly before it expires.
+type restTokenSource struct {
+	static     string
+	credential string
+	scope      string
+	serverURI  string
+	client     *http.Client
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+func newRESTTokenSource(catalogURI string, props iceberg.Properties) (*restTokenSource, error) {
+	transport, err := restHTTPTransport(props)
+	if err != nil {
+		return nil, err
+	}
+	serverURI := props.Get(restServerURIKey, "")
+	if serverURI == "" {
+		serverURI = strings.TrimSuffix(catalogURI, "/") + "/v1/oauth/tokens"
+	}
+	return &restTokenSource{
+		static:     props.Get(restTokenKey, ""),
+		credential: props.Get(restCredentialKey, ""),
+		scope:      props.Get(restScopeKey, restDefaultScope),
+		serverURI:  serverURI,
+		client:     &http.Client{Transport: transport},
+	}, nil
+}
+
+// refreshable tells whether tokens are fetched with the credential rather than fixed.
+func (s *restTokenSource) refreshable() bool {
+	return s.credential != ""
+}
+
+func (s *restTokenSource) get(ctx context.Context) (string, error) {
+	if !s.refreshable() {
+		return s.static, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && (s.refreshAt.IsZero() || time.Now().Before(s.refreshAt)) {
+		return s.token, nil
+	}
+
+	clientID, clientSecret, ok := strings.Cut(s.credential, ":")
+	if !ok {
+		clientID, clientSecret = "", clientID
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"scope":         {s.scope},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.serverURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", xerrors.Errorf("build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return "", xerrors.Errorf("fetch OAuth2 token: %w", err)
+	}
+	defer rsp.Body.Close()
+	var tok struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&tok); err != nil && rsp.StatusCode == http.StatusOK {
+		return "", xerrors.Errorf("decode OAuth2 token: %w", err)
+	}
+	if rsp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return "", xerrors.Errorf("fetch OAuth2 token: %s: %s %s", rsp.Status, tok.Error, tok.ErrorDescription)
+	}
+
+	s.token, s.refreshAt = tok.AccessToken, time.Time{}
+	if tok.ExpiresIn > 0 {
+		lifetime := time.Duration(tok.ExpiresIn) * time.Second
+		s.refreshAt = time.Now().Add(lifetime - min(time.Minute, lifetime/10))
+	}
+	return s.token, nil
+}
+
+// invalidate drops the cached token after the catalog rejected it.
+func (s *restTokenSource) invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// loadRESTCatalog opens a REST catalog. With a credential the catalog is wrapped to keep its token fresh,
+// iceberg-go fetches the token once and keeps using it after it expires. The TLS and retry options of
+// the catalog HTTP client and vended credentials need the wrapper too.
+func loadRESTCatalog(ctx context.Context, props iceberg.Properties) (catalog.Catalog, error) {
+	props = withSigV4Defaults(props, props.Get("uri", ""))
+	cfg, err := httpConfigFromProps(props, restHTTPPrefix)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := newRESTTokenSource(props.Get("uri", ""), props)
+	if err != nil {
+		return nil, err
+	}
+	vended := props.GetBool(restVendedCredentialsKey, false)
+	if !tokens.refreshable() && tlsConfig == nil && cfg.MaxAttempts <= 1 && !vended {
+		return catalog.Load(ctx, CatalogTypeREST, props)
+	}
+	restProps := iceberg.Properties{}
+	maps.Copy(restProps, props)
+	for key := range restProps {
+		if slices.Contains(restAuthKeys, key) || strings.HasPrefix(key, restHTTPPrefix) || key == restVendedCredentialsKey {
+			delete(restProps, key)
+		}
+	}
+	c := &restCatalog{props: restProps, tokens: tokens, http: cfg, tlsConfig: tlsConfig}
+	if vended {
+		// table files are accessed with credentials loaded next to iceberg-go, which loads them only once
+		if c.files, err = newRESTClient(ctx, props.Get("uri", ""), props); err != nil {
+			return nil, xerrors.Errorf("vended credentials: %w", err)
+		}
+	}
+	if _, err := c.current(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newIcebergRESTCatalog opens the REST catalog of iceberg-go, which signs requests itself when SigV4 is enabled.
+// A TLS config can only be given to it as an option, not in the properties.
+func newIcebergRESTCatalog(ctx context.Context, props iceberg.Properties, tlsConfig *tls.Config) (catalog.Catalog, error) {
+	if tlsConfig == nil {
+		return catalog.Load(ctx, CatalogTypeREST, props)
+	}
+	additional := iceberg.Properties{}
+	maps.Copy(additional, props)
+	delete(additional, "uri")
+	delete(additional, "type")
+	opts := []rest.Option{rest.WithAdditionalProps(additional), rest.WithTLSConfig(tlsConfig)}
+	// the options of the first request for the catalog config, the properties apply after it
+	if token := props.Get(restTokenKey, ""); token != "" {
+		opts = append(opts, rest.WithOAuthToken(token))
+	}
+	if warehouse := props.Get("warehouse", ""); warehouse != "" {
+		opts = append(opts, rest.WithWarehouseLocation(warehouse))
+	}
+	if prefix := props.Get("prefix", ""); prefix != "" {
+		opts = append(opts, rest.WithPrefix(prefix))
+	}
+	if sigV4Enabled(props) {
+		opts = append(opts, rest.WithSigV4RegionSvc(props.Get(restSigningRegionKey, ""), props.Get(restSigningNameKey, "")))
+	}
+	return rest.NewCatalog(ctx, CatalogTypeREST, props.Get("uri", ""), opts...)
+}
+
+// restCatalog calls the REST catalog with a current token, the catalog is opened again when the token changes.
+// Tables it returns commit through it, so commits use a current token too. With vended credentials
+// their files are accessed through a vendedIO.
+type restCatalog struct {
+	props     iceberg.Properties
+	tokens    *restTokenSource
+	http      HTTPConfig
+	tlsConfig *tls.Config
+	files     *restClient // loads vended credentials of tables, nil when they are not used
+
+	mu    sync.Mutex
+	token string
+	inner catalog.Catalog
+}
+
+func (c *restCatalog) current(ctx context.Context) (catalog.Catalog, error) {
+	token, err := c.tokens.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inner != nil && c.token == token {
+		return c.inner, nil
+	}
+	props := iceberg.Properties{}
+	maps.Copy(props, c.props)
+	if token != "" {
+		props[restTokenKey] = token
+	}
+	inner, err := newIcebergRESTCatalog(ctx, props, c.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	c.inner, c.token = inner, token
+	return inner, nil
+}
+
+// do runs call with the current catalog, once more with a new token if the token was rejected. Calls failing
+// with 503, and idempotent ones failing with another 5xx or a network error, are retried up to MaxAttempts
+// of the catalog HTTP options: iceberg-go can not be given an HTTP client retrying them.
+func (c *restCatalog) do(ctx context.Context, idempotent bool, call func(catalog.Catalog) error) error {
+	intervals := c.http.backoff()
+	for attempt := 1; ; attempt++ {
+		err := c.withToken(ctx, call)
+		if err == nil || attempt >= c.http.MaxAttempts || !retryableCall(ctx, idempotent, err) {
+			return err
+		}
+		timer := time.NewTimer(intervals.NextBackOff())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *restCatalog) withToken(ctx context.Context, call func(catalog.Catalog) error) error {
+	for attempt := 0; ; attempt++ {
+		inner, err := c.current(ctx)
+		if err != nil {
+			return err
+		}
+		err = call(inner)
+		if attempt > 0 || !(errors.Is(err, rest.ErrUnauthorized) || errors.Is(err, rest.ErrAuthorizationExpired)) {
+			return err
+		}
+		c.mu.Lock()
+		c.tokens.invalidate(c.token)
+		c.mu.Unlock()
+	}
+}
+
+func retryableCall(ctx context.Context, idempotent bool, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, rest.ErrServiceUnavailable) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var urlErr *url.Error
+	return idempotent && (errors.Is(err, rest.ErrServerError) || errors.As(err, &urlErr))
+}
+
+func (c *restCatalog) Close() error {
+	return nil
+}
+
+func (c *restCatalog) wrap(tbl *table.Table) *table.Table {
+	fs := tbl.FS()
+	if c.files != nil {
+		fs = newVendedIO(tbl, c.files, c.props)
+	}
+	return table.New(tbl.Identifier(), tbl.Metadata(), tbl.MetadataLocation(), fs, c)
+}
+
+func (c *restCatalog) CatalogType() catalog.Type {
+	return catalog.REST
+}
+
+func (c *restCatalog) CreateTable(ctx context.Context, ident table.Identifier, schema *iceberg.Schema, opts ...catalog.CreateTableOpt) (tbl *table.Table, err error) {
+	err = c.do(ctx, false, func(inner catalog.Catalog) (err error) {
+		tbl, err = inner.CreateTable(ctx, ident, schema, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.wrap(tbl), nil
+}
+
+func (c *restCatalog) CommitTable(ctx context.Context, tbl *table.Table, reqs []table.Requirement, updates []table.Update) (meta table.Metadata, location string, err error) {
+	err = c.do(ctx, false, func(inner catalog.Catalog) (err error) {
+		meta, location, err = inner.CommitTable(ctx, tbl, reqs, updates)
+		return err
+	})
+	return meta, location, err
+}
+
+func (c *restCatalog) ListTables(ctx context.Context, namespace table.Identifier) iter.Seq2[table.Identifier, error] {
+	return func(yield func(table.Identifier, error) bool) {
+		inner, err := c.current(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for ident, err := range inner.ListTables(ctx, namespace) {
+			if !yield(ident, err) {
+				return
+			}
+		}
+	}
+}
+
+func (c *restCatalog) LoadTable(ctx context.Context, ident table.Identifier, props iceberg.Properties) (tbl *table.Table, err error) {
+	err = c.do(ctx, true, func(inner catalog.Catalog) (err error) {
+		tbl, err = inner.LoadTable(ctx, ident, props)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.wrap(tbl), nil
+}
+
+func (c *restCatalog) DropTable(ctx context.Context, ident table.Identifier) error {
+	return c.do(ctx, false, func(inner catalog.Catalog) error {
+		return inner.DropTable(ctx, ident)
+	})
+}
+
+func (c *restCatalog) PurgeTable(ctx context.Context, ident table.Identifier) error {
+	return c.do(ctx, false, func(inner catalog.Catalog) error {
+		p, ok := inner.(purger)
+		if !ok {
+			return xerrors.Errorf("%T can not purge tables", inner)
+		}
+		return p.PurgeTable(ctx, ident)
+	})
+}
+
+func (c *restCatalog) RenameTable(ctx context.Context, from, to table.Identifier) (tbl *table.Table, err error) {
+	err = c.do(ctx, false, func(inner catalog.Catalog) (err error) {
+		tbl, err = inner.RenameTable(ctx, from, to)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.wrap(tbl), nil
+}
+
+func (c *restCatalog) ListNamespaces(ctx context.Context, parent table.Identifier) (namespaces []table.Identifier, err error) {
+	err = c.do(ctx, true, func(inner catalog.Catalog) (err error) {
+		namespaces, err = inner.ListNamespaces(ctx, parent)
+		return err
+	})
+	return namespaces, err
+}
+
+func (c *restCatalog) CreateNamespace(ctx context.Context, namespace table.Identifier, props iceberg.Properties) error {
+	return c.do(ctx, false, func(inner catalog.Catalog) error {
+		return inner.CreateNamespace(ctx, namespace, props)
+	})
+}
+
+func (c *restCatalog) DropNamespace(ctx context.Context, namespace table.Identifier) error {
+	return c.do(ctx, false, func(inner catalog.Catalog) error {
+		return inner.DropNamespace(ctx, namespace)
+	})
+}
+
+func (c *restCatalog) LoadNamespaceProperties(ctx context.Context, namespace table.Identifier) (props iceberg.Properties, err error) {
+	err = c.do(ctx, true, func(inner catalog.Catalog) (err error) {
+		props, err = inner.LoadNamespaceProperties(ctx, namespace)
+		return err
+	})
+	return props, err
+}
+
+func (c *restCatalog) UpdateNamespaceProperties(ctx context.Context, namespace table.Identifier, removals []string, updates iceberg.Properties) (summary catalog.PropertiesUpdateSummary, err error) {
+	err = c.do(ctx, false, func(inner catalog.Catalog) (err error) {
+		summary, err = inner.UpdateNamespaceProperties(ctx, namespace, removals, updates)
+		return err
+	})
+	return summary, err
+}
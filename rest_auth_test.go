@@ -0,0 +1,110 @@
+package iceberg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOAuthCatalog issues numbered tokens and accepts only the tokens it has not revoked.
+type fakeOAuthCatalog struct {
+	mu      sync.Mutex
+	issued  int
+	revoked map[string]bool
+	forms   []string
+}
+
+func (f *fakeOAuthCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/auth/token" {
+		_ = r.ParseForm()
+		f.forms = append(f.forms, r.PostForm.Encode())
+		f.issued++
+		_, _ = fmt.Fprintf(w, `{"access_token":"t%d","token_type":"bearer","expires_in":3600}`, f.issued)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || f.revoked[token] {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"message":"token expired","type":"NotAuthorizedException","code":401}}`))
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/config":
+		_, _ = w.Write([]byte(`{"defaults":{},"overrides":{}}`))
+	case "/v1/namespaces":
+		_, _ = fmt.Fprintf(w, `{"namespaces":[[%q]]}`, token)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRESTAuth(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeOAuthCatalog{revoked: map[string]bool{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	listNamespaces := func(t *testing.T, cat interface {
+		ListNamespaces(context.Context, table.Identifier) ([]table.Identifier, error)
+	}) string {
+		namespaces, err := cat.ListNamespaces(ctx, nil)
+		require.NoError(t, err)
+		require.Len(t, namespaces, 1)
+		return namespaces[0][0]
+	}
+
+	t.Run("client credentials", func(t *testing.T) {
+		src := &Source{CatalogType: CatalogTypeREST, CatalogURI: srv.URL, Auth: RESTAuthConfig{
+			Credential: "client:secret",
+			Scope:      "PRINCIPAL_ROLE:ALL",
+			ServerURI:  srv.URL + "/auth/token",
+		}}
+		require.NoError(t, src.Validate())
+		require.Empty(t, src.Properties, "secrets must not leak into the properties of the config")
+		cat, err := newCatalog(ctx, src.CatalogType, src.CatalogURI, src.catalogProperties())
+		require.NoError(t, err)
+		require.Equal(t, "client_id=client&client_secret=secret&grant_type=client_credentials&scope=PRINCIPAL_ROLE%3AALL", fake.forms[0])
+		require.Equal(t, "t1", listNamespaces(t, cat))
+
+		// the token is fetched again shortly before it expires
+		auth := cat.(*restCatalog)
+		auth.tokens.refreshAt = time.Now().Add(-time.Second)
+		require.Equal(t, "t2", listNamespaces(t, cat))
+		require.Equal(t, "t2", listNamespaces(t, cat))
+
+		// a token revoked by the server is replaced once
+		fake.revoked["t2"] = true
+		require.Equal(t, "t3", listNamespaces(t, cat))
+
+		// atomic commits authenticate with the same credential
+		txs, err := newRESTTransactions(ctx, src.CatalogURI, src.catalogProperties())
+		require.NoError(t, err)
+		req, err := txs.newRequest(ctx, http.MethodPost, txs.baseURI, nil)
+		require.NoError(t, err)
+		require.Equal(t, "Bearer t4", req.Header.Get("Authorization"))
+	})
+
+	t.Run("static token", func(t *testing.T) {
+		src := &Source{CatalogType: CatalogTypeREST, CatalogURI: srv.URL, Auth: RESTAuthConfig{Token: "static"}}
+		cat, err := newCatalog(ctx, src.CatalogType, src.CatalogURI, src.catalogProperties())
+		require.NoError(t, err)
+		require.Equal(t, "static", listNamespaces(t, cat))
+	})
+
+	t.Run("rejected credential", func(t *testing.T) {
+		props := RESTAuthConfig{Credential: "secret", ServerURI: srv.URL + "/missing"}.props(iceberg.Properties{})
+		_, err := newCatalog(ctx, CatalogTypeREST, srv.URL, props)
+		require.ErrorContains(t, err, "fetch OAuth2 token")
+	})
+}
@@ -0,0 +1,137 @@
+package iceberg
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/apache/iceberg-go"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+// restTransport is the transport of requests to the REST catalog sent next to iceberg-go, nil when the default transport fits.
+func restTransport(ctx context.Context, props iceberg.Properties) (http.RoundTripper, error) {
+	if !sigV4Enabled(props) {
+		return restHTTPTransport(props)
+	}
+	cfg, err := httpConfigFromProps(props, restHTTPPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var base http.RoundTripper = http.DefaultTransport
+	if transport, err := cfg.transport(); err != nil {
+		return nil, err
+	} else if transport != nil {
+		base = transport
+	}
+	signed, err := newSigV4Transport(ctx, base, props)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.withRetries(signed), nil
+}
+
+// restHTTPTransport is the transport of the HTTP options of the catalog without signing, as used for OAuth2 tokens.
+func restHTTPTransport(props iceberg.Properties) (http.RoundTripper, error) {
+	cfg, err := httpConfigFromProps(props, restHTTPPrefix)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := cfg.transport()
+	if err != nil {
+		return nil, err
+	}
+	if transport == nil {
+		if cfg.MaxAttempts <= 1 {
+			return nil, nil
+		}
+		return cfg.withRetries(http.DefaultTransport), nil
+	}
+	return cfg.withRetries(transport), nil
+}
+
+// restClient calls REST catalog endpoints iceberg-go does not expose, at the prefix from the catalog config.
+type restClient struct {
+	baseURI   *url.URL
+	client    *http.Client
+	tokens    *restTokenSource
+	endpoints []string // nil when the catalog does not list its endpoints
+}
+
+func newRESTClient(ctx context.Context, uri string, props iceberg.Properties) (*restClient, error) {
+	base, err := url.Parse(uri)
+	if err != nil {
+		return nil, xerrors.Errorf("parse catalog uri: %w", err)
+	}
+	transport, err := restTransport(ctx, props)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := newRESTTokenSource(uri, props)
+	if err != nil {
+		return nil, err
+	}
+	c := &restClient{
+		baseURI: base.JoinPath("v1"),
+		client:  &http.Client{Transport: transport},
+		tokens:  tokens,
+	}
+
+	params := url.Values{}
+	if warehouse := props["warehouse"]; warehouse != "" {
+		params.Set("warehouse", warehouse)
+	}
+	route := c.baseURI.JoinPath("config")
+	route.RawQuery = params.Encode()
+	req, err := c.newRequest(ctx, http.MethodGet, route, nil)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("fetch catalog config: %w", err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, restError(rsp)
+	}
+	var config struct {
+		Defaults  iceberg.Properties `json:"defaults"`
+		Overrides iceberg.Properties `json:"overrides"`
+		Endpoints []string           `json:"endpoints"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&config); err != nil {
+		return nil, xerrors.Errorf("decode catalog config: %w", err)
+	}
+	c.endpoints = config.Endpoints
+
+	prefix := props["prefix"]
+	if override, ok := config.Overrides["prefix"]; ok {
+		prefix = override
+	} else if prefix == "" {
+		prefix = config.Defaults["prefix"]
+	}
+	if prefix != "" {
+		c.baseURI = c.baseURI.JoinPath(prefix)
+	}
+	return c, nil
+}
+
+func (c *restClient) newRequest(ctx context.Context, method string, uri *url.URL, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri.String(), body)
+	if err != nil {
+		return nil, xerrors.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token, err := c.tokens.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
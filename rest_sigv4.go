@@ -0,0 +1,175 @@
+package iceberg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+// Catalog properties of SigV4 request signing, named as in Iceberg.
+const (
+	restSigV4EnabledKey     = "rest.sigv4-enabled"
+	restSigningRegionKey    = "rest.signing-region"
+	restSigningNameKey      = "rest.signing-name"
+	restDefaultSigningName  = "execute-api"
+	restOriginalAuthzHeader = "Original-Authorization"
+)
+
+// SigV4Config signs requests to the rest and nessie catalogs with AWS Signature Version 4,
+// as the Iceberg REST endpoints of AWS Glue and S3 Tables require. The REST catalog of iceberg-go
+// signs its requests itself, with credentials of the default AWS chain (environment, shared config, instance role).
+type SigV4Config struct {
+	Enabled bool
+	// Region of the signature, taken from the endpoint of AWS services or the AWS config when empty
+	Region string
+	// SigningName is the service of the signature: glue, s3tables, taken from the endpoint of AWS services
+	// and execute-api for other endpoints when empty
+	SigningName string
+}
+
+// props adds the signing options to catalog properties.
+func (c SigV4Config) props(props iceberg.Properties) iceberg.Properties {
+	if !c.Enabled {
+		return props
+	}
+	result := iceberg.Properties{}
+	maps.Copy(result, props)
+	result[restSigV4EnabledKey] = "true"
+	for key, value := range map[string]string{
+		restSigningRegionKey: c.Region,
+		restSigningNameKey:   c.SigningName,
+	} {
+		if value != "" {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+func (c SigV4Config) validate() error {
+	if !c.Enabled && c != (SigV4Config{}) {
+		return xerrors.New("SigV4 options are set but SigV4 is not enabled")
+	}
+	return nil
+}
+
+// sigV4Defaults is the signing name and region of an AWS endpoint such as
+// https://glue.us-east-1.amazonaws.com/iceberg or https://s3tables.us-east-1.amazonaws.com/iceberg.
+func sigV4Defaults(uri string) (signingName, region string) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", ""
+	}
+	labels := strings.Split(parsed.Hostname(), ".")
+	if len(labels) < 4 || labels[len(labels)-2] != "amazonaws" {
+		return "", ""
+	}
+	return labels[0], labels[1]
+}
+
+func sigV4Enabled(props iceberg.Properties) bool {
+	return props.GetBool(restSigV4EnabledKey, false)
+}
+
+// withSigV4Defaults sets the signing name and region of the endpoint in uri when SigV4 is enabled without them,
+// the signing name is execute-api for other endpoints.
+func withSigV4Defaults(props iceberg.Properties, uri string) iceberg.Properties {
+	if !sigV4Enabled(props) {
+		return props
+	}
+	result := iceberg.Properties{}
+	maps.Copy(result, props)
+	signingName, region := sigV4Defaults(uri)
+	if signingName == "" {
+		signingName = restDefaultSigningName
+	}
+	if result[restSigningNameKey] == "" {
+		result[restSigningNameKey] = signingName
+	}
+	if result[restSigningRegionKey] == "" && region != "" {
+		result[restSigningRegionKey] = region
+	}
+	return result
+}
+
+// sigV4Transport signs requests of the catalog endpoints called next to iceberg-go before sending them with base.
+// An Authorization header set by the caller, such as a bearer token, is moved to Original-Authorization as Iceberg does.
+type sigV4Transport struct {
+	base        http.RoundTripper
+	signer      *v4.Signer
+	credentials aws.CredentialsProvider
+	region      string
+	service     string
+}
+
+func newSigV4Transport(ctx context.Context, base http.RoundTripper, props iceberg.Properties) (*sigV4Transport, error) {
+	props = withSigV4Defaults(props, props.Get("uri", ""))
+	var opts []func(*config.LoadOptions) error
+	if region := props.Get(restSigningRegionKey, ""); region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, xerrors.New("SigV4 signing region is not set")
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, xerrors.Errorf("retrieve AWS credentials: %w", err)
+	}
+	return &sigV4Transport{
+		base:        base,
+		signer:      v4.NewSigner(),
+		credentials: cfg.Credentials,
+		region:      cfg.Region,
+		service:     props.Get(restSigningNameKey, ""),
+	}, nil
+}
+
+func (t *sigV4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, xerrors.Errorf("read request body: %w", err)
+		}
+	}
+	signed := req.Clone(req.Context())
+	if req.Body != nil {
+		signed.Body = io.NopCloser(bytes.NewReader(body))
+		signed.ContentLength = int64(len(body))
+	}
+	if authz := signed.Header.Get("Authorization"); authz != "" {
+		signed.Header.Del("Authorization")
+		signed.Header.Set(restOriginalAuthzHeader, authz)
+	}
+
+	hash := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(hash[:])
+	signed.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	creds, err := t.credentials.Retrieve(req.Context())
+	if err != nil {
+		return nil, xerrors.Errorf("retrieve AWS credentials: %w", err)
+	}
+	if err := t.signer.SignHTTP(req.Context(), creds, signed, payloadHash, t.service, t.region, time.Now()); err != nil {
+		return nil, xerrors.Errorf("sign request: %w", err)
+	}
+	return t.base.RoundTrip(signed)
+}
@@ -0,0 +1,789 @@
+package iceberg
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/apache/iceberg-go"
+	"github.com/transferia/transferia/library/go/core/xerrors"
+	"github.com/transferia/transferia/pkg/abstract"
+)
+
+// rowFilter is TableDescription.Filter split into the expression Iceberg evaluates and the one checked here.
+// The scan expression prunes partitions and files by their statistics and filters rows of the files read.
+// Parts Iceberg can not express, like comparisons of two columns, are left out of it, and then the whole
+// filter is evaluated against each row read. So is LIKE: the record filter of iceberg-go has no starts_with.
+type rowFilter struct {
+	scan      iceberg.BooleanExpression // nil when no part of the filter is pushed down
+	residual  sqlExpr                   // nil when the scan expression is the whole filter
+	shard     *tableShard               // the files of a part made by ShardTable, nil for whole tables
+	increment *tableIncrement           // the snapshots of an incremental load, nil for the current table
+}
+
+// newRowFilter parses where, parts of it are pushed down when they apply to every one of schemas.
+func newRowFilter(where abstract.WhereStatement, schemas ...*iceberg.Schema) (*rowFilter, error) {
+	if strings.TrimSpace(string(where)) == "" {
+		return &rowFilter{}, nil
+	}
+	expr, err := parseWhere(string(where))
+	if err != nil {
+		return nil, xerrors.Errorf("unable to parse filter %q: %w", where, err)
+	}
+	result := &rowFilter{}
+	if expr, result.shard, result.increment, err = splitSnapshotFilter(expr); err != nil {
+		return nil, xerrors.Errorf("invalid filter %q: %w", where, err)
+	}
+	if expr == nil {
+		return result, nil
+	}
+	scan, exact := pushdown(expr, schemas)
+	if !scan.Equals(iceberg.AlwaysTrue{}) {
+		result.scan = scan
+	}
+	if !exact {
+		result.residual = expr
+	}
+	return result, nil
+}
+
+// splitSnapshotFilter takes the conditions on the snapshot pseudo columns out of the top-level conjunction of expr:
+// the data files of a part made by ShardTable, and the bounds of an incremental load. rest is nil when there is nothing else.
+func splitSnapshotFilter(expr sqlExpr) (rest sqlExpr, shard *tableShard, increment *tableIncrement, err error) {
+	var conds []sqlExpr
+	var flatten func(e sqlExpr)
+	flatten = func(e sqlExpr) {
+		if l, ok := e.(sqlLogical); ok && l.and {
+			flatten(l.left)
+			flatten(l.right)
+			return
+		}
+		conds = append(conds, e)
+	}
+	flatten(expr)
+
+	var snapshotID, after, upTo *int64
+	var files []string
+	var ref string
+	for _, cond := range conds {
+		op, id, err := snapshotCondition(cond)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		switch op {
+		case "=":
+			snapshotID = &id
+			continue
+		case ">":
+			after = &id
+			continue
+		case "<=":
+			upTo = &id
+			continue
+		}
+		if c, ok := cond.(sqlCompare); ok && c.left == sqlColumn(shardIDColumn) {
+			lit, _ := c.right.(sqlLiteral)
+			value, isString := lit.value.(string)
+			if c.op != "=" || !isString || value == "" {
+				return nil, nil, nil, xerrors.Errorf("%s must be equal to a string", shardIDColumn)
+			}
+			ref = value
+			continue
+		}
+		if c, ok := cond.(sqlIn); ok {
+			if col, ok := c.expr.(sqlColumn); ok && col == shardFilesColumn && !c.not {
+				for _, v := range c.values {
+					lit, ok := v.(sqlLiteral)
+					file, isString := lit.value.(string)
+					if !ok || !isString {
+						return nil, nil, nil, xerrors.Errorf("%s must be a list of strings", shardFilesColumn)
+					}
+					files = append(files, file)
+				}
+				continue
+			}
+		}
+		if rest == nil {
+			rest = cond
+		} else {
+			rest = sqlLogical{and: true, left: rest, right: cond}
+		}
+	}
+	if snapshotID == nil && files == nil && ref == "" && after == nil && upTo == nil {
+		return expr, nil, nil, nil
+	}
+	if files != nil && ref != "" {
+		return nil, nil, nil, xerrors.Errorf("%s and %s can not be set together", shardFilesColumn, shardIDColumn)
+	}
+	if (snapshotID == nil) != (files == nil && ref == "") {
+		return nil, nil, nil, xerrors.Errorf("%s and %s or %s must be set together", snapshotIDColumn, shardFilesColumn, shardIDColumn)
+	}
+	if snapshotID != nil {
+		if after != nil {
+			return nil, nil, nil, xerrors.New("parts of a table are not read incrementally")
+		}
+		shard = &tableShard{snapshotID: *snapshotID, id: ref, files: files}
+	}
+	if after != nil || upTo != nil {
+		increment = &tableIncrement{after: after, upTo: upTo}
+	}
+	return rest, shard, increment, nil
+}
+
+// snapshotCondition matches comparisons of the snapshot ID pseudo column, NOT (> id) is returned as <= id.
+func snapshotCondition(e sqlExpr) (op string, id int64, err error) {
+	if not, ok := e.(sqlNot); ok {
+		if op, id, err = snapshotCondition(not.expr); err != nil || op != ">" {
+			return "", 0, err
+		}
+		return "<=", id, nil
+	}
+	c, ok := e.(sqlCompare)
+	if !ok || c.left != sqlColumn(snapshotIDColumn) || (c.op != "=" && c.op != ">") {
+		return "", 0, nil
+	}
+	lit, _ := c.right.(sqlLiteral)
+	id, ok = lit.value.(int64)
+	if !ok {
+		return "", 0, xerrors.Errorf("%s must be compared with an integer", snapshotIDColumn)
+	}
+	return c.op, id, nil
+}
+
+// columns are the columns the residual filter reads.
+func (f *rowFilter) columns() []string {
+	if f.residual == nil {
+		return nil
+	}
+	var names []string
+	walkSQL(f.residual, func(e sqlExpr) {
+		if col, ok := e.(sqlColumn); ok && !slices.Contains(names, string(col)) {
+			names = append(names, string(col))
+		}
+	})
+	return names
+}
+
+// match evaluates the residual filter against a row, value returns the value of a column.
+func (f *rowFilter) match(value func(column string) any) bool {
+	return f.residual == nil || f.residual.eval(value) == true
+}
+
+// pushdown converts expr to an Iceberg expression. When a part of it can not be converted,
+// the result is a weaker expression that still holds for every matching row, and exact is false.
+func pushdown(expr sqlExpr, schemas []*iceberg.Schema) (result iceberg.BooleanExpression, exact bool) {
+	unsupported := iceberg.BooleanExpression(iceberg.AlwaysTrue{})
+	switch e := expr.(type) {
+	case sqlLogical:
+		l, lexact := pushdown(e.left, schemas)
+		r, rexact := pushdown(e.right, schemas)
+		if e.and {
+			return iceberg.NewAnd(l, r), lexact && rexact
+		}
+		if !lexact || !rexact {
+			return unsupported, false
+		}
+		return iceberg.NewOr(l, r), true
+	case sqlNot:
+		child, childExact := pushdown(e.expr, schemas)
+		if !childExact {
+			return unsupported, false
+		}
+		return iceberg.NewNot(child), true
+	}
+
+	var pred iceberg.BooleanExpression
+	switch e := expr.(type) {
+	case sqlCompare:
+		col, lit, op, ok := columnLiteral(e)
+		if !ok {
+			return unsupported, false
+		}
+		pred = iceberg.LiteralPredicate(op, iceberg.Reference(col), lit)
+	case sqlIsNull:
+		col, ok := e.expr.(sqlColumn)
+		if !ok {
+			return unsupported, false
+		}
+		pred = iceberg.IsNull(iceberg.Reference(col))
+		if e.not {
+			pred = iceberg.NotNull(iceberg.Reference(col))
+		}
+	case sqlIn:
+		col, ok := e.expr.(sqlColumn)
+		if !ok {
+			return unsupported, false
+		}
+		lits := make([]iceberg.Literal, 0, len(e.values))
+		for _, v := range e.values {
+			lit, ok := v.(sqlLiteral)
+			if !ok || lit.value == nil {
+				return unsupported, false
+			}
+			lits = append(lits, icebergLiteral(lit.value))
+		}
+		op := iceberg.OpIn
+		if e.not {
+			op = iceberg.OpNotIn
+		}
+		pred = iceberg.SetPredicate(op, iceberg.Reference(col), lits)
+	default:
+		return unsupported, false
+	}
+	// unknown columns and literals of other types than the column are left to the residual filter
+	for _, schema := range schemas {
+		if _, err := iceberg.BindExpr(schema, pred, true); err != nil {
+			return unsupported, false
+		}
+	}
+	return pred, true
+}
+
+// columnLiteral matches comparisons of a column with a non-null literal, in either order.
+func columnLiteral(e sqlCompare) (string, iceberg.Literal, iceberg.Operation, bool) {
+	ops := map[string]iceberg.Operation{
+		"=": iceberg.OpEQ, "!=": iceberg.OpNEQ, "<": iceberg.OpLT, "<=": iceberg.OpLTEQ, ">": iceberg.OpGT, ">=": iceberg.OpGTEQ,
+	}
+	op := ops[e.op]
+	col, colOK := e.left.(sqlColumn)
+	lit, litOK := e.right.(sqlLiteral)
+	if !colOK || !litOK {
+		col, colOK = e.right.(sqlColumn)
+		lit, litOK = e.left.(sqlLiteral)
+		if op != iceberg.OpEQ && op != iceberg.OpNEQ {
+			op = op.FlipLR()
+		}
+	}
+	if !colOK || !litOK || lit.value == nil {
+		return "", nil, 0, false
+	}
+	return string(col), icebergLiteral(lit.value), op, true
+}
+
+func icebergLiteral(v any) iceberg.Literal {
+	switch v := v.(type) {
+	case int64:
+		return iceberg.NewLiteral(v)
+	case float64:
+		return iceberg.NewLiteral(v)
+	case bool:
+		return iceberg.NewLiteral(v)
+	default:
+		return iceberg.NewLiteral(fmt.Sprint(v))
+	}
+}
+
+// sqlExpr is a node of a parsed filter. eval follows SQL semantics: comparisons with NULL are NULL (nil)
+// and a row matches only when the filter is true.
+type sqlExpr interface {
+	eval(value func(column string) any) any
+}
+
+type (
+	sqlColumn  string
+	sqlLiteral struct {
+		value any // nil, int64, float64, string or bool
+	}
+	sqlLogical struct {
+		and         bool
+		left, right sqlExpr
+	}
+	sqlNot     struct{ expr sqlExpr }
+	sqlCompare struct {
+		op          string
+		left, right sqlExpr
+	}
+	sqlIsNull struct {
+		expr sqlExpr
+		not  bool
+	}
+	sqlIn struct {
+		expr   sqlExpr
+		values []sqlExpr
+		not    bool
+	}
+	sqlLike struct {
+		expr    sqlExpr
+		pattern string
+		re      *regexp.Regexp
+		not     bool
+	}
+)
+
+func (c sqlColumn) eval(value func(string) any) any { return value(string(c)) }
+func (l sqlLiteral) eval(func(string) any) any      { return l.value }
+func (n sqlNot) eval(value func(string) any) any    { return not(n.expr.eval(value)) }
+func (n sqlIsNull) eval(value func(string) any) any { return (n.expr.eval(value) == nil) != n.not }
+func (c sqlCompare) eval(value func(string) any) any {
+	return compareOp(c.op, c.left.eval(value), c.right.eval(value))
+}
+func (l sqlLogical) eval(value func(string) any) any {
+	left, right := l.left.eval(value), l.right.eval(value)
+	if l.and {
+		return not(or(not(left), not(right)))
+	}
+	return or(left, right)
+}
+
+func (n sqlIn) eval(value func(string) any) any {
+	v := n.expr.eval(value)
+	var result any = false
+	for _, candidate := range n.values {
+		result = or(result, compareOp("=", v, candidate.eval(value)))
+	}
+	if n.not {
+		return not(result)
+	}
+	return result
+}
+
+func (n sqlLike) eval(value func(string) any) any {
+	v := n.expr.eval(value)
+	if v == nil {
+		return nil
+	}
+	return n.re.MatchString(fmt.Sprint(v)) != n.not
+}
+
+// likeRegexp translates a LIKE pattern, where % matches any string and _ any character.
+func likeRegexp(pattern string) *regexp.Regexp {
+	var re strings.Builder
+	re.WriteString("^(?s)")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			re.WriteString(".*")
+		case '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
+
+func not(v any) any {
+	if b, ok := v.(bool); ok {
+		return !b
+	}
+	return nil
+}
+
+func or(l, r any) any {
+	if l == true || r == true {
+		return true
+	}
+	if l == nil || r == nil {
+		return nil
+	}
+	return false
+}
+
+func compareOp(op string, l, r any) any {
+	if l == nil || r == nil {
+		return nil
+	}
+	c, ok := compareValues(l, r)
+	if !ok {
+		return nil
+	}
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// compareValues compares numbers of any type with each other and with numeric strings, like decimals,
+// and other values by their string form.
+func compareValues(l, r any) (int, bool) {
+	li, lInt := asInt(l)
+	ri, rInt := asInt(r)
+	if lInt && rInt {
+		return compare(li, ri), true
+	}
+	lf, lNum := asFloat(l)
+	rf, rNum := asFloat(r)
+	if lNum != rNum {
+		if lNum {
+			rf, rNum = parseFloat(r)
+		} else {
+			lf, lNum = parseFloat(l)
+		}
+	}
+	if lNum && rNum {
+		if math.IsNaN(lf) || math.IsNaN(rf) {
+			return 0, false
+		}
+		return compare(lf, rf), true
+	}
+	if lNum || rNum {
+		return 0, false
+	}
+	return strings.Compare(fmt.Sprint(l), fmt.Sprint(r)), true
+}
+
+func compare[T int64 | float64](l, r T) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+func asInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func asFloat(v any) (float64, bool) {
+	if i, ok := asInt(v); ok {
+		return float64(i), true
+	}
+	switch v := v.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func parseFloat(v any) (float64, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+func walkSQL(e sqlExpr, visit func(sqlExpr)) {
+	visit(e)
+	switch e := e.(type) {
+	case sqlLogical:
+		walkSQL(e.left, visit)
+		walkSQL(e.right, visit)
+	case sqlNot:
+		walkSQL(e.expr, visit)
+	case sqlCompare:
+		walkSQL(e.left, visit)
+		walkSQL(e.right, visit)
+	case sqlIsNull:
+		walkSQL(e.expr, visit)
+	case sqlIn:
+		walkSQL(e.expr, visit)
+		for _, v := range e.values {
+			walkSQL(v, visit)
+		}
+	case sqlLike:
+		walkSQL(e.expr, visit)
+	}
+}
+
+// parseWhere parses the SQL WHERE clauses transfers use: comparisons, [NOT] IN, IS [NOT] NULL,
+// [NOT] BETWEEN and [NOT] LIKE of columns and literals, combined with AND, OR, NOT and parentheses.
+// Columns are bare or quoted with "" or “, strings are quoted with ”.
+func parseWhere(where string) (sqlExpr, error) {
+	tokens, err := lexWhere(where)
+	if err != nil {
+		return nil, err
+	}
+	p := &whereParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, xerrors.Errorf("unexpected %q", p.peek().text)
+	}
+	return expr, nil
+}
+
+type whereTokenKind int
+
+const (
+	tokenWord whereTokenKind = iota // keyword or bare column
+	tokenColumn
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type whereToken struct {
+	kind whereTokenKind
+	text string
+}
+
+func lexWhere(s string) ([]whereToken, error) {
+	var tokens []whereToken
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"' || r == '`':
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == r {
+					// a doubled quote stands for the quote itself
+					if j+1 < len(runes) && runes[j+1] == r {
+						text.WriteRune(r)
+						j++
+						continue
+					}
+					break
+				}
+				text.WriteRune(runes[j])
+			}
+			if j == len(runes) {
+				return nil, xerrors.Errorf("unterminated %c", r)
+			}
+			kind := tokenColumn
+			if r == '\'' {
+				kind = tokenString
+			}
+			tokens = append(tokens, whereToken{kind: kind, text: text.String()})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '-' || r == '.') && i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.'):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || strings.ContainsRune(".eE", runes[j]) ||
+				(runes[j] == '-' || runes[j] == '+') && (runes[j-1] == 'e' || runes[j-1] == 'E')) {
+				j++
+			}
+			tokens = append(tokens, whereToken{kind: tokenNumber, text: string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, whereToken{kind: tokenWord, text: string(runes[i:j])})
+			i = j
+		default:
+			symbol := string(r)
+			if i+1 < len(runes) && slices.Contains([]string{"<=", ">=", "!=", "<>", "=="}, string(runes[i:i+2])) {
+				symbol = string(runes[i : i+2])
+			} else if !strings.ContainsRune("=<>(),", r) {
+				return nil, xerrors.Errorf("unexpected %q", r)
+			}
+			tokens = append(tokens, whereToken{kind: tokenSymbol, text: symbol})
+			i += len([]rune(symbol))
+		}
+	}
+	return tokens, nil
+}
+
+type whereParser struct {
+	tokens []whereToken
+	pos    int
+}
+
+func (p *whereParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *whereParser) peek() whereToken {
+	if p.done() {
+		return whereToken{kind: tokenSymbol, text: "end of filter"}
+	}
+	return p.tokens[p.pos]
+}
+
+// accept consumes the next token if it is the keyword or symbol.
+func (p *whereParser) accept(text string) bool {
+	t := p.peek()
+	if p.done() || (t.kind != tokenWord && t.kind != tokenSymbol) || !strings.EqualFold(t.text, text) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *whereParser) expect(text string) error {
+	if !p.accept(text) {
+		return xerrors.Errorf("expected %s, got %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *whereParser) parseOr() (sqlExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("OR") {
+		var right sqlExpr
+		if right, err = p.parseAnd(); err == nil {
+			left = sqlLogical{and: false, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *whereParser) parseAnd() (sqlExpr, error) {
+	left, err := p.parseNot()
+	for err == nil && p.accept("AND") {
+		var right sqlExpr
+		if right, err = p.parseNot(); err == nil {
+			left = sqlLogical{and: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *whereParser) parseNot() (sqlExpr, error) {
+	if p.accept("NOT") {
+		expr, err := p.parseNot()
+		return sqlNot{expr: expr}, err
+	}
+	return p.parsePredicate()
+}
+
+func (p *whereParser) parsePredicate() (sqlExpr, error) {
+	if p.accept("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("IS") {
+		not := p.accept("NOT")
+		return sqlIsNull{expr: left, not: not}, p.expect("NULL")
+	}
+	not := p.accept("NOT")
+	switch {
+	case p.accept("IN"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		in := sqlIn{expr: left, not: not}
+		for {
+			value, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			in.values = append(in.values, value)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return in, p.expect(")")
+	case p.accept("BETWEEN"):
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		var between sqlExpr = sqlLogical{and: true, left: sqlCompare{op: ">=", left: left, right: low}, right: sqlCompare{op: "<=", left: left, right: high}}
+		if not {
+			between = sqlNot{expr: between}
+		}
+		return between, nil
+	case p.accept("LIKE"):
+		pattern := p.peek()
+		if pattern.kind != tokenString {
+			return nil, xerrors.Errorf("expected a LIKE pattern, got %q", pattern.text)
+		}
+		p.pos++
+		return sqlLike{expr: left, pattern: pattern.text, re: likeRegexp(pattern.text), not: not}, nil
+	case not:
+		return nil, xerrors.Errorf("expected IN, BETWEEN or LIKE after NOT, got %q", p.peek().text)
+	}
+
+	op := p.peek()
+	if op.kind != tokenSymbol || !slices.Contains([]string{"=", "==", "!=", "<>", "<", "<=", ">", ">="}, op.text) {
+		return nil, xerrors.Errorf("expected a comparison, got %q", op.text)
+	}
+	p.pos++
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch op.text {
+	case "==":
+		op.text = "="
+	case "<>":
+		op.text = "!="
+	}
+	return sqlCompare{op: op.text, left: left, right: right}, nil
+}
+
+func (p *whereParser) parseOperand() (sqlExpr, error) {
+	t := p.peek()
+	if p.done() {
+		return nil, xerrors.New("unexpected end of filter")
+	}
+	p.pos++
+	switch t.kind {
+	case tokenColumn:
+		return sqlColumn(t.text), nil
+	case tokenString:
+		return sqlLiteral{value: t.text}, nil
+	case tokenNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return sqlLiteral{value: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid number %q", t.text)
+		}
+		return sqlLiteral{value: f}, nil
+	case tokenWord:
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			return sqlLiteral{value: nil}, nil
+		case "TRUE":
+			return sqlLiteral{value: true}, nil
+		case "FALSE":
+			return sqlLiteral{value: false}, nil
+		case "AND", "OR", "NOT", "IN", "IS", "BETWEEN", "LIKE":
+			return nil, xerrors.Errorf("unexpected %s", t.text)
+		}
+		return sqlColumn(t.text), nil
+	}
+	return nil, xerrors.Errorf("unexpected %q", t.text)
+}
@@ -0,0 +1,81 @@
+package iceberg
+
+import (
+	"testing"
+
+	"github.com/apache/iceberg-go"
+	"github.com/stretchr/testify/require"
+	"github.com/transferia/transferia/pkg/abstract"
+)
+
+func TestRowFilter(t *testing.T) {
+	schema := iceberg.NewSchema(0,
+		iceberg.NestedField{ID: 1, Name: "id", Type: iceberg.PrimitiveTypes.Int64, Required: true},
+		iceberg.NestedField{ID: 2, Name: "name", Type: iceberg.PrimitiveTypes.String},
+		iceberg.NestedField{ID: 3, Name: "score", Type: iceberg.PrimitiveTypes.Float64},
+	)
+	ref := func(name string) iceberg.Reference { return iceberg.Reference(name) }
+	for _, tc := range []struct {
+		where    abstract.WhereStatement
+		scan     iceberg.BooleanExpression
+		residual bool
+		err      string
+	}{
+		{where: ""},
+		{where: `"id" >= 10 AND name = 'it''s'`, scan: iceberg.NewAnd(iceberg.GreaterThanEqual(ref("id"), int64(10)), iceberg.EqualTo(ref("name"), "it's"))},
+		{where: `10 < id`, scan: iceberg.GreaterThan(ref("id"), int64(10))},
+		{where: `id IN (1, 2) OR name IS NULL`, scan: iceberg.NewOr(iceberg.IsIn(ref("id"), int64(1), int64(2)), iceberg.IsNull(ref("name")))},
+		{where: `NOT (score BETWEEN 0.5 AND 1)`, scan: iceberg.NewNot(iceberg.NewAnd(iceberg.GreaterThanEqual(ref("score"), 0.5), iceberg.LessThanEqual(ref("score"), int64(1))))},
+		{where: `name NOT LIKE 'user%' AND name IS NOT NULL`, scan: iceberg.NotNull(ref("name")), residual: true},
+		// parts Iceberg can not evaluate are checked for every row, the rest still prunes files
+		{where: `id > 1 AND score < id`, scan: iceberg.GreaterThan(ref("id"), int64(1)), residual: true},
+		{where: `id > 1 OR name LIKE '%1'`, residual: true},
+		{where: `NOT (name LIKE 'a_c%')`, residual: true},
+		{where: `missing = 1`, residual: true},
+		{where: `id = 'one'`, residual: true},
+		{where: `id = NULL`, residual: true},
+		{where: `id >`, err: "unexpected end of filter"},
+		{where: `id = 1 id`, err: `unexpected "id"`},
+		{where: `name = 'open`, err: "unterminated"},
+		{where: `lower(name) = 'a'`, err: `expected a comparison, got "("`},
+	} {
+		t.Run(string(tc.where), func(t *testing.T) {
+			f, err := newRowFilter(tc.where, schema)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.scan == nil {
+				require.Nil(t, f.scan)
+			} else {
+				require.True(t, tc.scan.Equals(f.scan), f.scan.String())
+			}
+			require.Equal(t, tc.residual, f.residual != nil)
+		})
+	}
+}
+
+func TestRowFilterMatch(t *testing.T) {
+	row := map[string]any{"id": int64(3), "name": "user 3", "score": 1.5, "missing": nil}
+	value := func(column string) any { return row[column] }
+	for where, match := range map[abstract.WhereStatement]bool{
+		`score < id`:                            true,
+		`score > id`:                            false,
+		`name LIKE 'user _'`:                    true,
+		`name NOT LIKE '%4'`:                    true,
+		`id IN (1, 3)`:                          true,
+		`id NOT IN (1, NULL)`:                   false, // NULL
+		`missing = 1 OR id = 3`:                 true,
+		`missing = 1 AND id = 3`:                false,
+		`NOT (missing = 1)`:                     false,
+		`missing IS NULL AND name IS NOT NULL`:  true,
+		`score BETWEEN 1 AND 2`:                 true,
+		`id = '3'`:                              true,
+		`name > 'user 10' AND name <= 'user 3'`: true,
+	} {
+		expr, err := parseWhere(string(where))
+		require.NoError(t, err, where)
+		require.Equal(t, match, (&rowFilter{residual: expr}).match(value), where)
+	}
+}
@@ -0,0 +1,365 @@
+package iceberg
+
+import (
+	"bytes"
+	"cmp"
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	iceio "github.com/apache/iceberg-go/io"
+	"github.com/apache/iceberg-go/table"
+	"github.com/transferia/transferia/library/go/core/xerrors"
+	"github.com/transferia/transferia/pkg/abstract"
+	"github.com/transferia/transferia/pkg/abstract/coordinator"
+	"go.ytsaurus.tech/library/go/core/log"
+)
+
+var _ abstract.ShardingStorage = (*Storage)(nil)
+
+// Pseudo columns of the filters of parts and increments: a part made by ShardTable reads the listed data files
+// of a snapshot, or the files kept in the coordinator under its shard ID, an incremental load the data appended
+// after one snapshot up to another.
+const (
+	snapshotIDColumn = "__iceberg_snapshot_id"
+	shardFilesColumn = "__iceberg_data_file"
+	shardIDColumn    = "__iceberg_shard"
+)
+
+// tableShard is a set of data files of a snapshot read by one part of a table.
+// A shard with an id keeps its files in the coordinator, files are nil until they are resolved.
+type tableShard struct {
+	snapshotID int64
+	id         string
+	files      []string
+}
+
+func shardFilesKey(tid abstract.TableID, id string) string {
+	return fmt.Sprintf("shard_files_%s/%s", tid.String(), id)
+}
+
+// shardID names the files of a shard, so parts made again for the same files keep their filter and part ID.
+func shardID(files []string) string {
+	hash := sha256.Sum256([]byte(strings.Join(files, "\n")))
+	return hex.EncodeToString(hash[:8])
+}
+
+func (sh *tableShard) where() abstract.WhereStatement {
+	if sh.id != "" {
+		return abstract.WhereStatement(fmt.Sprintf(`"%s" = %d AND "%s" = '%s'`,
+			snapshotIDColumn, sh.snapshotID, shardIDColumn, sh.id))
+	}
+	files := make([]string, len(sh.files))
+	for i, file := range sh.files {
+		files[i] = "'" + strings.ReplaceAll(file, "'", "''") + "'"
+	}
+	return abstract.WhereStatement(fmt.Sprintf(`"%s" = %d AND "%s" IN (%s)`,
+		snapshotIDColumn, sh.snapshotID, shardFilesColumn, strings.Join(files, ", ")))
+}
+
+// ShardTable splits the data files matching the filter of the snapshot the table is read as of into parts of about ShardSize bytes.
+// Every part pins the snapshot, so workers read disjoint files of the same table state.
+func (s *Storage) ShardTable(ctx context.Context, tdesc abstract.TableDescription) ([]abstract.TableDescription, error) {
+	tbl := table.Identifier{tdesc.Schema, tdesc.Name}
+	itable, err := s.cat.LoadTable(ctx, tbl, s.props)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to load table: %v: %w", tbl, err)
+	}
+	where, err := newRowFilter(tdesc.Filter, itable.Schema())
+	if err != nil {
+		return nil, xerrors.Errorf("unable to apply filter to %v: %w", tbl, err)
+	}
+	if where.shard != nil || (where.increment != nil && where.increment.after != nil) {
+		// increments are files of several snapshots, they are not split
+		return []abstract.TableDescription{tdesc}, nil
+	}
+	snapshot, err := s.readSnapshot(itable, where)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to shard %v: %w", tbl, err)
+	}
+	if snapshot == nil {
+		return []abstract.TableDescription{tdesc}, nil
+	}
+	scanOpts := []table.ScanOption{table.WithSnapshotID(snapshot.SnapshotID)}
+	if where.scan != nil {
+		scanOpts = append(scanOpts, table.WithRowFilter(where.scan))
+	}
+	tasks, err := itable.Scan(scanOpts...).PlanFiles(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to plan files to read: %w", err)
+	}
+	shardSize := s.cfg.ShardSize
+	if shardSize <= 0 {
+		shardSize = defaultShardSize
+	}
+	shards := packTasks(tasks, shardSize)
+	if len(shards) <= 1 {
+		return []abstract.TableDescription{tdesc}, nil
+	}
+
+	result := make([]abstract.TableDescription, 0, len(shards))
+	state := map[string]*coordinator.TransferStateData{}
+	for _, tasks := range shards {
+		shard := &tableShard{snapshotID: snapshot.SnapshotID}
+		part := tdesc
+		part.EtaRow = 0
+		for _, task := range tasks {
+			shard.files = append(shard.files, task.File.FilePath())
+			part.EtaRow += uint64(task.File.Count())
+		}
+		slices.Sort(shard.files)
+		if s.cp != nil {
+			// the file lists of large tables do not fit into filters, parts refer to them in the coordinator
+			shard.id = shardID(shard.files)
+			state[shardFilesKey(tdesc.ID(), shard.id)] = &coordinator.TransferStateData{Generic: shard.files}
+		}
+		part.Filter = abstract.FiltersIntersection(tdesc.Filter, shard.where())
+		result = append(result, part)
+	}
+	if s.cp != nil {
+		if err := s.storeShards(tdesc.ID(), state); err != nil {
+			return nil, xerrors.Errorf("unable to store parts of %v: %w", tbl, err)
+		}
+	}
+	s.logger.Info("table is sharded by data files",
+		log.String("table", tdesc.Fqtn()), log.Int64("snapshot", snapshot.SnapshotID),
+		log.Int("files", len(tasks)), log.Int("parts", len(result)))
+	return result, nil
+}
+
+// storeShards keeps the files of the parts of a table in the coordinator and drops files of its former parts.
+func (s *Storage) storeShards(tid abstract.TableID, shards map[string]*coordinator.TransferStateData) error {
+	state, err := s.cp.GetTransferState(s.transferID)
+	if err != nil {
+		return xerrors.Errorf("get transfer state: %w", err)
+	}
+	var stale []string
+	for key := range state {
+		if _, ok := shards[key]; !ok && strings.HasPrefix(key, shardFilesKey(tid, "")) {
+			stale = append(stale, key)
+		}
+	}
+	if len(stale) > 0 {
+		if err := s.cp.RemoveTransferState(s.transferID, stale); err != nil {
+			return xerrors.Errorf("remove transfer state: %w", err)
+		}
+	}
+	if err := s.cp.SetTransferState(s.transferID, shards); err != nil {
+		return xerrors.Errorf("set transfer state: %w", err)
+	}
+	return nil
+}
+
+// resolveShard reads the files of a shard kept in the coordinator.
+func (s *Storage) resolveShard(tid abstract.TableID, shard *tableShard) error {
+	if shard == nil || shard.id == "" {
+		return nil
+	}
+	if s.cp == nil {
+		return xerrors.Errorf("files of shard %s are kept in the coordinator, which is not set", shard.id)
+	}
+	state, err := s.cp.GetTransferState(s.transferID)
+	if err != nil {
+		return xerrors.Errorf("get transfer state: %w", err)
+	}
+	key := shardFilesKey(tid, shard.id)
+	data, ok := state[key]
+	if !ok {
+		return xerrors.Errorf("files of shard %s are not found in the transfer state", shard.id)
+	}
+	if err := decodeState(data.Generic, &shard.files); err != nil {
+		return xerrors.Errorf("read state %s: %w", key, err)
+	}
+	return nil
+}
+
+// packTasks splits tasks into about total size / targetSize shards of close sizes:
+// the largest files go first, each one to the smallest shard so far.
+func packTasks(tasks []table.FileScanTask, targetSize int64) [][]table.FileScanTask {
+	var total int64
+	for _, task := range tasks {
+		total += task.Length
+	}
+	n := min(len(tasks), int(max(1, (total+targetSize-1)/targetSize)))
+	if n == 0 {
+		return nil
+	}
+	sorted := slices.Clone(tasks)
+	slices.SortFunc(sorted, func(a, b table.FileScanTask) int {
+		if c := cmp.Compare(b.Length, a.Length); c != 0 {
+			return c
+		}
+		return strings.Compare(a.File.FilePath(), b.File.FilePath())
+	})
+	bins := make(shardHeap, n)
+	for i := range bins {
+		bins[i] = &shardBin{index: i}
+	}
+	for _, task := range sorted {
+		bins[0].tasks = append(bins[0].tasks, task)
+		bins[0].size += task.Length
+		heap.Fix(&bins, 0)
+	}
+	slices.SortFunc(bins, func(a, b *shardBin) int { return cmp.Compare(a.index, b.index) })
+	shards := make([][]table.FileScanTask, 0, n)
+	for _, bin := range bins {
+		shards = append(shards, bin.tasks)
+	}
+	return shards
+}
+
+type shardBin struct {
+	index int
+	size  int64
+	tasks []table.FileScanTask
+}
+
+// shardHeap orders bins by size, then by index, so packing is deterministic.
+type shardHeap []*shardBin
+
+func (h shardHeap) Len() int { return len(h) }
+func (h shardHeap) Less(i, j int) bool {
+	if h[i].size != h[j].size {
+		return h[i].size < h[j].size
+	}
+	return h[i].index < h[j].index
+}
+func (h shardHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *shardHeap) Push(x any)   { *h = append(*h, x.(*shardBin)) }
+func (h *shardHeap) Pop() any {
+	old := *h
+	bin := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return bin
+}
+
+// shardView is the table as of the snapshot of shard with only the data files of shard, read with schema.
+// iceberg-go scans can not be given a list of files, so the view has a manifest list of its own:
+// data manifests of the snapshot are rewritten in memory keeping just the shard entries,
+// delete manifests are kept as they are and still apply to the files by their sequence numbers.
+func shardView(itable *table.Table, shard *tableShard, schema *iceberg.Schema) (*table.Table, error) {
+	meta := itable.Metadata()
+	snapshot := meta.SnapshotByID(shard.snapshotID)
+	if snapshot == nil {
+		return nil, xerrors.Errorf("snapshot %d is not found, it might be expired", shard.snapshotID)
+	}
+	manifests, err := snapshot.Manifests(itable.FS())
+	if err != nil {
+		return nil, xerrors.Errorf("unable to read manifest list of snapshot %d: %w", snapshot.SnapshotID, err)
+	}
+
+	missing := make(map[string]bool, len(shard.files))
+	for _, file := range shard.files {
+		missing[file] = true
+	}
+	var kept []iceberg.ManifestFile
+	entries := map[int][]iceberg.ManifestEntry{}
+	for _, m := range manifests {
+		if m.ManifestContent() != iceberg.ManifestContentData {
+			kept = append(kept, m)
+			continue
+		}
+		mEntries, err := m.FetchEntries(itable.FS(), true)
+		if err != nil {
+			return nil, xerrors.Errorf("unable to read manifest %s: %w", m.FilePath(), err)
+		}
+		for _, entry := range mEntries {
+			if missing[entry.DataFile().FilePath()] {
+				delete(missing, entry.DataFile().FilePath())
+				entries[int(m.PartitionSpecID())] = append(entries[int(m.PartitionSpecID())], entry)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return nil, xerrors.Errorf("%d data files of the shard are not in snapshot %d", len(missing), snapshot.SnapshotID)
+	}
+
+	fileIO := &shardIO{IO: itable.FS(), files: map[string][]byte{}}
+	for _, specID := range slices.Sorted(maps.Keys(entries)) {
+		spec, err := specByID(meta, specID)
+		if err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		w, err := iceberg.NewManifestWriter(meta.Version(), &out, spec, schema, snapshot.SnapshotID)
+		if err != nil {
+			return nil, xerrors.Errorf("create manifest writer: %w", err)
+		}
+		for _, entry := range entries[specID] {
+			if err := w.Existing(entry); err != nil {
+				return nil, xerrors.Errorf("write entry %s: %w", entry.DataFile().FilePath(), err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			return nil, xerrors.Errorf("close manifest: %w", err)
+		}
+		path := fmt.Sprintf("%s%d-m%d.avro", shardIOPrefix, snapshot.SnapshotID, specID)
+		m, err := w.ToManifestFile(path, int64(out.Len()))
+		if err != nil {
+			return nil, xerrors.Errorf("close manifest: %w", err)
+		}
+		fileIO.files[path] = out.Bytes()
+		kept = append(kept, m)
+	}
+
+	var out bytes.Buffer
+	seqNum := snapshot.SequenceNumber
+	if err := iceberg.WriteManifestList(meta.Version(), &out, snapshot.SnapshotID, snapshot.ParentSnapshotID, &seqNum, kept); err != nil {
+		return nil, xerrors.Errorf("write manifest list: %w", err)
+	}
+	view := *snapshot
+	view.SchemaID = &schema.ID
+	view.ManifestList = fmt.Sprintf("%ssnap-%d.avro", shardIOPrefix, snapshot.SnapshotID)
+	fileIO.files[view.ManifestList] = out.Bytes()
+	return table.New(itable.Identifier(), &shardMetadata{Metadata: meta, snapshot: &view}, itable.MetadataLocation(), fileIO, nil), nil
+}
+
+// shardMetadata is the table metadata with the snapshot of a shard view in place of the original one.
+type shardMetadata struct {
+	table.Metadata
+	snapshot *table.Snapshot
+}
+
+func (m *shardMetadata) SnapshotByID(id int64) *table.Snapshot {
+	if id == m.snapshot.SnapshotID {
+		return m.snapshot
+	}
+	return m.Metadata.SnapshotByID(id)
+}
+
+// shardIOPrefix starts the locations of the manifests of shard views, kept in memory.
+const shardIOPrefix = "memory://shard/"
+
+// shardIO is the FileIO of a shard view, it opens its manifests from memory and the rest with the table FileIO.
+type shardIO struct {
+	iceio.IO
+	files map[string][]byte
+}
+
+func (s *shardIO) Open(name string) (iceio.File, error) {
+	if data, ok := s.files[name]; ok {
+		return &memFile{Reader: bytes.NewReader(data), name: name}, nil
+	}
+	return s.IO.Open(name)
+}
+
+type memFile struct {
+	*bytes.Reader
+	name string
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *memFile) Name() string               { return f.name }
+func (f *memFile) Mode() fs.FileMode          { return fs.ModeIrregular }
+func (f *memFile) ModTime() time.Time         { return time.Time{} }
+func (f *memFile) IsDir() bool                { return false }
+func (f *memFile) Sys() any                   { return nil }
+func (f *memFile) Close() error               { return nil }
@@ -0,0 +1,107 @@
+package iceberg
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+	"github.com/transferia/transferia/pkg/abstract"
+)
+
+type pathDataFile struct {
+	iceberg.DataFile
+	path string
+}
+
+func (f pathDataFile) FilePath() string { return f.path }
+
+func TestPackTasks(t *testing.T) {
+	var tasks []table.FileScanTask
+	for i, size := range []int64{70, 10, 40, 30, 30, 20} {
+		tasks = append(tasks, table.FileScanTask{File: pathDataFile{path: fmt.Sprintf("f%d", i)}, Length: size})
+	}
+	sizes := func(shards [][]table.FileScanTask) []int64 {
+		var result []int64
+		for _, shard := range shards {
+			var size int64
+			for _, task := range shard {
+				size += task.Length
+			}
+			result = append(result, size)
+		}
+		return result
+	}
+
+	shards := packTasks(tasks, 100)
+	require.Equal(t, []int64{100, 100}, sizes(shards))
+	require.Equal(t, []int64{70, 30}, []int64{shards[0][0].Length, shards[0][1].Length})
+	require.Equal(t, shards, packTasks(tasks, 100))
+
+	require.Len(t, packTasks(tasks, 1), len(tasks))
+	require.Len(t, packTasks(tasks, 1000), 1)
+	require.Empty(t, packTasks(nil, 100))
+}
+
+func TestSplitSnapshotFilter(t *testing.T) {
+	shard := &tableShard{snapshotID: 42, files: []string{"s3://bucket/a.parquet", "s3://bucket/it's.parquet"}}
+
+	expr, err := parseWhere(string(shard.where()))
+	require.NoError(t, err)
+	rest, parsed, increment, err := splitSnapshotFilter(expr)
+	require.NoError(t, err)
+	require.Nil(t, rest)
+	require.Equal(t, shard, parsed)
+	require.Nil(t, increment)
+
+	expr, err = parseWhere("(id > 1 OR name = 'x') AND (" + string(shard.where()) + ") AND score < 2")
+	require.NoError(t, err)
+	rest, parsed, increment, err = splitSnapshotFilter(expr)
+	require.NoError(t, err)
+	require.Equal(t, shard, parsed)
+	require.Equal(t, []string{"id", "name", "score"}, (&rowFilter{residual: rest}).columns())
+
+	expr, err = parseWhere(`id = 1 OR "__iceberg_snapshot_id" = 42`)
+	require.NoError(t, err)
+	rest, parsed, increment, err = splitSnapshotFilter(expr)
+	require.NoError(t, err)
+	require.Nil(t, parsed)
+	require.Nil(t, increment)
+	require.Equal(t, expr, rest)
+
+	// the filter of an incremental load merged with the next state by the loader
+	where := abstract.FiltersIntersection(abstract.FiltersIntersection("id > 1", incrementWhere(7)), abstract.NotStatement(incrementWhere(9)))
+	expr, err = parseWhere(string(where))
+	require.NoError(t, err)
+	rest, parsed, increment, err = splitSnapshotFilter(expr)
+	require.NoError(t, err)
+	require.Nil(t, parsed)
+	after, upTo := int64(7), int64(9)
+	require.Equal(t, &tableIncrement{after: &after, upTo: &upTo}, increment)
+	require.Equal(t, []string{"id"}, (&rowFilter{residual: rest}).columns())
+
+	expr, err = parseWhere(`"__iceberg_snapshot_id" > 'x'`)
+	require.NoError(t, err)
+	_, _, _, err = splitSnapshotFilter(expr)
+	require.ErrorContains(t, err, "must be compared with an integer")
+
+	expr, err = parseWhere(`"__iceberg_snapshot_id" = 42`)
+	require.NoError(t, err)
+	_, _, _, err = splitSnapshotFilter(expr)
+	require.ErrorContains(t, err, "must be set together")
+
+	// a part whose files are kept in the coordinator
+	ref := &tableShard{snapshotID: 42, id: shardID(shard.files)}
+	expr, err = parseWhere("id > 1 AND " + string(ref.where()))
+	require.NoError(t, err)
+	rest, parsed, _, err = splitSnapshotFilter(expr)
+	require.NoError(t, err)
+	require.Equal(t, ref, parsed)
+	require.Equal(t, []string{"id"}, (&rowFilter{residual: rest}).columns())
+
+	expr, err = parseWhere(string(abstract.FiltersIntersection(ref.where(), shard.where())))
+	require.NoError(t, err)
+	_, _, _, err = splitSnapshotFilter(expr)
+	require.ErrorContains(t, err, "can not be set together")
+}
@@ -2,38 +2,56 @@ package iceberg
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/apache/iceberg-go"
 	"github.com/apache/iceberg-go/catalog"
-	"github.com/apache/iceberg-go/catalog/glue"
-	"github.com/apache/iceberg-go/catalog/rest"
 	"github.com/apache/iceberg-go/table"
 
+	"github.com/transferia/transferia/library/go/core/metrics"
 	"github.com/transferia/transferia/library/go/core/xerrors"
 	"github.com/transferia/transferia/pkg/abstract"
 	"github.com/transferia/transferia/pkg/abstract/coordinator"
 	"github.com/transferia/transferia/pkg/abstract/model"
+	"github.com/transferia/transferia/pkg/providers"
+	"go.ytsaurus.tech/library/go/core/log"
 )
 
 // To verify providers contract implementation
 var (
-	_ abstract.Sinker = (*SinkSnapshot)(nil)
+	_ abstract.Sinker      = (*SinkSnapshot)(nil)
+	_ abstract.Committable = (*SinkSnapshot)(nil)
 )
 
+// pendingCommitKeyPrefix marks tables waiting for the atomic commit at the end of the snapshot
+const pendingCommitKeyPrefix = "pending_commit_"
+
+// truncateKeyPrefix marks tables truncated by the cleanup of a load committed to a branch,
+// the branch is reset to main when the load starts, so the final commit deletes the old files instead
+const truncateKeyPrefix = "truncate_"
+
 type SinkSnapshot struct {
-	cfg        *Destination
-	catalog    catalog.Catalog
-	ctx        context.Context
-	cancelFunc context.CancelFunc
-	mu         sync.Mutex
-	insertNum  int
-	workerNum  int
-	files      []string
-	cp         coordinator.Coordinator
-	transfer   *model.Transfer
+	cfg     *Destination
+	catalog catalog.Catalog
+	// catalogProps are the catalog properties with the authentication and Nessie references of the transfer
+	catalogProps iceberg.Properties
+	refs         *refNames
+	ctx          context.Context
+	cancelFunc   context.CancelFunc
+	mu           sync.Mutex
+	insertNum    int
+	workerNum    int
+	parts        map[abstract.TablePartID]*partFiles // files written for the parts being loaded
+	cp           coordinator.Coordinator
+	transfer     *model.Transfer
+	logger       log.Logger
+	registry     metrics.Registry
 }
 
 // Close implements abstract.Sinker.
@@ -41,6 +59,7 @@ func (s *SinkSnapshot) Close() error {
 	if s.cancelFunc != nil {
 		s.cancelFunc()
 	}
+	closeCatalog(s.catalog)
 	return nil
 }
 
@@ -50,8 +69,8 @@ func (s *SinkSnapshot) Push(items []abstract.ChangeItem) error {
 		return nil
 	}
 
-	// Group items by table
-	tableGroups := make(map[string][]abstract.ChangeItem)
+	// Group items by table part, files of concurrent parts are kept apart
+	tableGroups := make(map[abstract.TablePartID][]abstract.ChangeItem)
 	for _, item := range items {
 		if !item.IsRowEvent() {
 			if err := s.processControlEvent(item); err != nil {
@@ -60,14 +79,13 @@ func (s *SinkSnapshot) Push(items []abstract.ChangeItem) error {
 			continue
 		}
 
-		tableID := item.TableID().String()
-		tableGroups[tableID] = append(tableGroups[tableID], item)
+		tableGroups[item.TablePartID()] = append(tableGroups[item.TablePartID()], item)
 	}
 
 	// Process each table
-	for tableID, tableItems := range tableGroups {
+	for partID, tableItems := range tableGroups {
 		if err := s.processTable(tableItems); err != nil {
-			return xerrors.Errorf("processing table %s: %w", tableID, err)
+			return xerrors.Errorf("processing table %s: %w", partID.FqtnWithPartID(), err)
 		}
 	}
 
@@ -81,71 +99,473 @@ func (s *SinkSnapshot) processControlEvent(item abstract.ChangeItem) error {
 
 	switch item.Kind {
 	case abstract.DoneTableLoad:
+		// files are persisted once per finished part, a restarted worker only reloads unfinished parts
+		part := s.takePart(item.TablePartID())
 		if err := s.cp.SetTransferState(s.transfer.ID, map[string]*coordinator.TransferStateData{
-			fmt.Sprintf("files_for_%v", s.workerNum): {Generic: s.files},
+			partFilesKey(item.TableID(), item.PartID): {Generic: part},
 		}); err != nil {
 			return xerrors.Errorf("set transfer state: %w", err)
 		}
 		return nil
+	case abstract.InitShardedTableLoad:
+		if s.cfg.StagedLoad {
+			// a staging table left by a failed attempt must not leak its rows into this one,
+			// its files may already be referenced by the target so they are kept
+			if err := s.catalog.DropTable(ctx, s.stagingTableIdent(item)); err != nil && !xerrors.Is(err, catalog.ErrNoSuchTable) {
+				return xerrors.Errorf("drop staging table: %w", err)
+			}
+		}
+		if branch := s.refs.Branch; branch != table.MainBranch {
+			// every load starts from main, not from the head a previous load left on the branch
+			tbl, err := s.catalog.LoadTable(ctx, s.createTableIdent(item), s.cfg.Properties)
+			if err != nil {
+				if xerrors.Is(err, catalog.ErrNoSuchTable) {
+					return nil
+				}
+				return xerrors.Errorf("load table: %w", err)
+			}
+			if _, err := resetBranch(ctx, s.catalog, tbl, branch, s.cfg.SnapshotProps); err != nil {
+				return xerrors.Errorf("reset branch %s: %w", branch, err)
+			}
+		}
+		return nil
 	case abstract.DoneShardedTableLoad:
+		if _, err := s.ensureTable(ctx, s.writeTableIdent(item), item); err != nil {
+			return xerrors.Errorf("ensure table: %w", err)
+		}
+		if s.cfg.StagedLoad {
+			state, err := s.cp.GetTransferState(s.transfer.ID)
+			if err != nil {
+				return xerrors.Errorf("get transfer state: %w", err)
+			}
+			loaded, keys, err := loadedParts(state, item.TableID())
+			if err != nil {
+				return xerrors.Errorf("read loaded parts: %w", err)
+			}
+			tbl, err := s.swapStagingTable(ctx, item, loaded.Files)
+			if err != nil {
+				return xerrors.Errorf("swap staging table: %w", err)
+			}
+			if err := s.removeState(keys); err != nil {
+				return err
+			}
+			return s.finishTable(ctx, tbl, item, loaded.Rows)
+		}
+		if s.cfg.AtomicCommit {
+			// the table is committed together with the others once the whole snapshot is loaded
+			if err := s.cp.SetTransferState(s.transfer.ID, map[string]*coordinator.TransferStateData{
+				pendingCommitKeyPrefix + item.TableID().String(): {Generic: newPendingCommit(item)},
+			}); err != nil {
+				return xerrors.Errorf("set transfer state: %w", err)
+			}
+			return nil
+		}
 		state, err := s.cp.GetTransferState(s.transfer.ID)
 		if err != nil {
 			return xerrors.Errorf("get transfer state: %w", err)
 		}
-		var files []string
-		for k, v := range state {
-			if !strings.Contains(k, "files_for_") {
-				continue
-			}
-			files = append(files, v.Generic.([]string)...)
+		loaded, keys, err := loadedParts(state, item.TableID())
+		if err != nil {
+			return xerrors.Errorf("read loaded parts: %w", err)
 		}
-		tbl, err := s.ensureTable(ctx, item)
+		truncate, truncateKeys := truncated(state, item.TableID())
+		keys = append(keys, truncateKeys...)
+		change, err := s.stageTable(ctx, item, loaded.Files, truncate)
 		if err != nil {
-			return xerrors.Errorf("ensure table: %w", err)
+			return xerrors.Errorf("stage snapshot: %w", err)
 		}
-		tx := tbl.NewTransaction()
-		if err := tx.AddFiles(files, s.cfg.SnapshotProps, false); err != nil {
-			return xerrors.Errorf("add files: %w", err)
+		if change == nil {
+			return s.removeState(keys)
 		}
-
-		if _, err := tx.Commit(ctx); err != nil {
-			return xerrors.Errorf("commit transaction: %w", err)
+		tbl, err := change.commit(ctx, s.catalog)
+		if err != nil {
+			return xerrors.Errorf("commit snapshot: %w", err)
 		}
-		return nil
+		if err := s.removeState(keys); err != nil {
+			return err
+		}
+		return s.finishTable(ctx, tbl, item, loaded.Rows)
 	case abstract.DropTableKind, abstract.TruncateTableKind:
-		tblIdent := s.createTableIdent(item)
-
-		// load table to emulate check for existence
-		_, err := s.catalog.LoadTable(ctx, tblIdent, s.cfg.Properties)
+		if s.cfg.StagedLoad || s.cfg.WriteMode == WriteModeOverwrite || s.cfg.WriteMode == WriteModeDynamicOverwrite {
+			// the final commit replaces the data, the table and its history are kept
+			return nil
+		}
+		tbl, err := s.catalog.LoadTable(ctx, s.createTableIdent(item), s.cfg.Properties)
 		if err != nil {
-			// table exist, skip
+			// table does not exist, nothing to clean up
 			return nil
 		}
 
-		// drop table
-		if err := s.catalog.DropTable(ctx, tblIdent); err != nil {
-			return xerrors.Errorf("drop table: %w", err)
+		if s.refs.Branch != table.MainBranch {
+			// the branch is reset to main when the load starts and the final commit replaces the files of main on it,
+			// dropping the table would drop main before the load is verified and published
+			if err := s.cp.SetTransferState(s.transfer.ID, map[string]*coordinator.TransferStateData{
+				truncateKeyPrefix + item.TableID().String(): {Generic: true},
+			}); err != nil {
+				return xerrors.Errorf("set transfer state: %w", err)
+			}
+			return nil
 		}
-
-		// for TRUNCATE we do drop and create
 		if item.Kind == abstract.TruncateTableKind {
-			schema, err := ConvertToIcebergSchema(item.TableSchema)
+			// truncate keeps the table, a snapshot deleting all files keeps history for time travel
+			_, err := newSnapshotUpdate(s.catalog, tbl, s.cfg.SnapshotProps).overwriteAll().commit(ctx)
 			if err != nil {
-				return xerrors.Errorf("convert schema for truncate: %w", err)
+				return xerrors.Errorf("truncate table: %w", err)
 			}
+			return nil
+		}
 
-			// create table
-			_, err = s.catalog.CreateTable(ctx, tblIdent, schema)
-			if err != nil {
-				return xerrors.Errorf("recreate table after truncate: %w", err)
+		if s.cfg.PurgeOnDrop {
+			if err := purgeTable(ctx, s.catalog, tbl); err != nil {
+				return xerrors.Errorf("purge table: %w", err)
+			}
+			return nil
+		}
+		if err := s.catalog.DropTable(ctx, tbl.Identifier()); err != nil {
+			return xerrors.Errorf("drop table: %w", err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// Commit implements abstract.Committable, it is called once the snapshot load is done.
+// With AtomicCommit all loaded tables are committed here in a single catalog transaction.
+func (s *SinkSnapshot) Commit() error {
+	if s.cfg.AtomicCommit {
+		if err := s.commitPending(); err != nil {
+			return err
+		}
+	}
+	if hasDateTemplate(s.cfg) {
+		// the next load expands the references anew
+		return s.removeState([]string{refNamesKey})
+	}
+	return nil
+}
+
+func (s *SinkSnapshot) commitPending() error {
+	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Minute)
+	defer cancel()
+
+	state, err := s.cp.GetTransferState(s.transfer.ID)
+	if err != nil {
+		return xerrors.Errorf("get transfer state: %w", err)
+	}
+	var (
+		unchanged []string   // keys of tables with nothing to commit
+		tableKeys [][]string // keys of each table of changes
+		items     []abstract.ChangeItem
+		rows      []uint64
+		changes   []*tableChange
+	)
+	for k, v := range state {
+		if !strings.HasPrefix(k, pendingCommitKeyPrefix) {
+			continue
+		}
+		var pending pendingCommit
+		if err := decodeState(v.Generic, &pending); err != nil {
+			return xerrors.Errorf("read state %s: %w", k, err)
+		}
+		item := pending.item()
+		loaded, fileKeys, err := loadedParts(state, item.TableID())
+		if err != nil {
+			return xerrors.Errorf("read loaded parts of %s: %w", item.TableID().String(), err)
+		}
+		truncate, truncateKeys := truncated(state, item.TableID())
+		keys := slices.Concat([]string{k}, fileKeys, truncateKeys)
+		change, err := s.stageTable(ctx, item, loaded.Files, truncate)
+		if err != nil {
+			return xerrors.Errorf("stage snapshot of %s: %w", item.TableID().String(), err)
+		}
+		if change == nil {
+			unchanged = append(unchanged, keys...)
+			continue
+		}
+		tableKeys = append(tableKeys, keys)
+		items = append(items, item)
+		rows = append(rows, loaded.Rows)
+		changes = append(changes, change)
+	}
+	if len(changes) > 0 {
+		var txs *restTransactions
+		if s.cfg.CatalogType == CatalogTypeREST || s.cfg.CatalogType == CatalogTypeNessie {
+			txs, err = newRESTTransactions(ctx, restCatalogURI(s.cfg.CatalogType, s.cfg.CatalogURI, s.catalogProps), s.catalogProps)
+			if err != nil && !xerrors.Is(err, errTransactionsUnsupported) {
+				return xerrors.Errorf("init catalog transactions: %w", err)
+			}
+		}
+		if txs == nil {
+			s.logger.Warnf("catalog does not support multi-table transactions, committing %d tables one by one", len(changes))
+		}
+		tables, committed, err := commitChanges(ctx, s.catalog, txs, changes, s.cfg.Properties)
+		// committed tables are forgotten right away, a rerun must not append their files again
+		if err := s.removeState(slices.Concat(tableKeys[:committed]...)); err != nil {
+			return err
+		}
+		if err != nil {
+			return xerrors.Errorf("commit snapshots: %w", err)
+		}
+		for i, tbl := range tables {
+			if err := s.finishTable(ctx, tbl, items[i], rows[i]); err != nil {
+				return xerrors.Errorf("finish table %s: %w", items[i].TableID().String(), err)
 			}
 		}
+	}
+	return s.removeState(unchanged)
+}
+
+// pendingCommit is the state of a table waiting for the atomic commit kept in the coordinator
+type pendingCommit struct {
+	Schema  string               `json:"schema"`
+	Table   string               `json:"table"`
+	Columns []abstract.ColSchema `json:"columns"`
+}
+
+func newPendingCommit(item abstract.ChangeItem) *pendingCommit {
+	return &pendingCommit{Schema: item.Schema, Table: item.Table, Columns: item.TableSchema.Columns()}
+}
+
+// item is the DoneShardedTableLoad event the table was recorded with
+func (p *pendingCommit) item() abstract.ChangeItem {
+	return abstract.ChangeItem{
+		Kind:        abstract.DoneShardedTableLoad,
+		Schema:      p.Schema,
+		Table:       p.Table,
+		TableSchema: abstract.NewTableSchema(p.Columns),
+	}
+}
+
+// partFilesKey is the coordinator key of files written for a part of a table
+func partFilesKey(tid abstract.TableID, partID string) string {
+	return fmt.Sprintf("files_for_%s/%s", tid.String(), partID)
+}
+
+// partFiles is the state of a finished part kept in the coordinator
+type partFiles struct {
+	Files []string `json:"files"`
+	Rows  uint64   `json:"rows"`
+}
+
+// loadedParts sums up all finished parts of a table and returns the keys they are stored under
+func loadedParts(state map[string]*coordinator.TransferStateData, tid abstract.TableID) (*partFiles, []string, error) {
+	prefix := partFilesKey(tid, "")
+	loaded := &partFiles{Files: nil, Rows: 0}
+	var keys []string
+	for k, v := range state {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		var part partFiles
+		if err := decodeState(v.Generic, &part); err != nil {
+			return nil, nil, xerrors.Errorf("read state %s: %w", k, err)
+		}
+		keys = append(keys, k)
+		loaded.Files = append(loaded.Files, part.Files...)
+		loaded.Rows += part.Rows
+	}
+	return loaded, keys, nil
+}
 
+// decodeState reads a value kept in the coordinator into out, remote coordinators hand JSON-decoded state back.
+func decodeState(generic any, out any) error {
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return xerrors.Errorf("marshal: %w", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return xerrors.Errorf("unmarshal: %w", err)
+	}
+	return nil
+}
+
+// truncated reports whether the table was truncated by the cleanup of the load and returns the key of the mark
+func truncated(state map[string]*coordinator.TransferStateData, tid abstract.TableID) (bool, []string) {
+	key := truncateKeyPrefix + tid.String()
+	if _, ok := state[key]; !ok {
+		return false, nil
+	}
+	return true, []string{key}
+}
+
+// removeState drops committed keys, so the next run of the transfer does not pick them up
+func (s *SinkSnapshot) removeState(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := s.cp.RemoveTransferState(s.transfer.ID, keys); err != nil {
+		return xerrors.Errorf("remove transfer state: %w", err)
+	}
+	return nil
+}
+
+// stageTable prepares the snapshot with files loaded for the table, nil if there is nothing to commit.
+// With truncate the snapshot also deletes all files the table had before the load.
+func (s *SinkSnapshot) stageTable(ctx context.Context, item abstract.ChangeItem, files []string, truncate bool) (*tableChange, error) {
+	tbl, err := s.catalog.LoadTable(ctx, s.createTableIdent(item), s.cfg.Properties)
+	if err != nil {
+		return nil, xerrors.Errorf("load table: %w", err)
+	}
+	update := newSnapshotUpdate(s.catalog, tbl, s.cfg.SnapshotProps).
+		toBranch(s.refs.Branch).
+		appendFiles(files)
+	switch {
+	case truncate || s.cfg.WriteMode == WriteModeOverwrite:
+		update.overwriteAll()
+	case s.cfg.WriteMode == WriteModeDynamicOverwrite:
+		update.overwritePartitions()
+	}
+	return update.stage()
+}
+
+// finishTable runs verification, publish and tagging once the snapshot of a table is committed
+func (s *SinkSnapshot) finishTable(ctx context.Context, tbl *table.Table, item abstract.ChangeItem, pushedRows uint64) error {
+	var err error
+	if s.cfg.Verify.Enabled {
+		if err := s.verify(tbl, item, pushedRows); err != nil {
+			return xerrors.Errorf("verify snapshot: %w", err)
+		}
+	}
+	if s.cfg.Publish.Enabled {
+		if tbl, err = s.publish(ctx, tbl, item); err != nil {
+			return xerrors.Errorf("publish branch: %w", err)
+		}
+	}
+	if s.cfg.Tag.Name != "" {
+		if err := s.tag(ctx, tbl); err != nil {
+			return xerrors.Errorf("tag snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// verify compares added-records of the committed snapshot with rows pushed to the table
+// and, if asked, with the exact row count of the source
+func (s *SinkSnapshot) verify(tbl *table.Table, item abstract.ChangeItem, pushedRows uint64) error {
+	snapshot := branchHead(tbl.Metadata(), s.refs.Branch)
+	if snapshot == nil {
+		snapshot = tbl.CurrentSnapshot()
+	}
+	if snapshot == nil || snapshot.Summary == nil {
+		return nil
+	}
+	added := uint64(snapshot.Summary.Properties.GetInt(summaryAddedRecords, 0))
+
+	var mismatches []string
+	if added != pushedRows {
+		mismatches = append(mismatches, fmt.Sprintf("snapshot %d added %d rows, %d rows were pushed", snapshot.SnapshotID, added, pushedRows))
+	}
+	if s.cfg.Verify.CheckSourceExactCount {
+		exact, err := s.sourceExactRowCount(item.TableID())
+		if err != nil {
+			return xerrors.Errorf("count source rows: %w", err)
+		}
+		if added != exact {
+			mismatches = append(mismatches, fmt.Sprintf("snapshot %d added %d rows, source has %d rows", snapshot.SnapshotID, added, exact))
+		}
+	}
+	if len(mismatches) == 0 {
 		return nil
 	}
+
+	s.registry.WithTags(map[string]string{"table": item.TableID().Fqtn()}).Counter("sink.iceberg.rows_mismatch").Inc()
+	if s.cfg.Verify.FailOnMismatch {
+		return xerrors.Errorf("table %s: %s", item.TableID().Fqtn(), strings.Join(mismatches, "; "))
+	}
+	s.logger.Warnf("table %s: %s", item.TableID().Fqtn(), strings.Join(mismatches, "; "))
 	return nil
 }
 
+// publish fast-forwards main to the load branch once configured checks pass
+func (s *SinkSnapshot) publish(ctx context.Context, tbl *table.Table, item abstract.ChangeItem) (*table.Table, error) {
+	branch := s.refs.Branch
+	if branch == table.MainBranch {
+		return tbl, nil
+	}
+	head := branchHead(tbl.Metadata(), branch)
+	if head == nil {
+		// nothing was committed to the branch
+		return tbl, nil
+	}
+
+	if s.cfg.Publish.CheckRowCount {
+		rows, err := snapshotRowCount(ctx, tbl, head.SnapshotID)
+		if err != nil {
+			return nil, xerrors.Errorf("count branch rows: %w", err)
+		}
+		etaRows, err := s.sourceRowCount(item.TableID())
+		if err != nil {
+			return nil, xerrors.Errorf("count source rows: %w", err)
+		}
+		diff := math.Abs(float64(rows) - float64(etaRows))
+		if diff > s.cfg.Publish.RowCountTolerance*float64(etaRows) {
+			return nil, xerrors.Errorf("branch %s has %d rows, source expects %d", branch, rows, etaRows)
+		}
+	}
+	if s.cfg.Publish.CheckNonNullKeys {
+		hasNulls, err := hasNullKeys(ctx, tbl, head.SnapshotID, item.TableSchema)
+		if err != nil {
+			return nil, xerrors.Errorf("check keys: %w", err)
+		}
+		if hasNulls {
+			return nil, xerrors.Errorf("branch %s has null primary keys", branch)
+		}
+	}
+
+	tbl, err := fastForward(ctx, s.catalog, tbl, branch)
+	if err != nil {
+		return nil, xerrors.Errorf("fast-forward %s: %w", table.MainBranch, err)
+	}
+	s.logger.Infof("published branch %s of %s to %s", branch, item.TableID().String(), table.MainBranch)
+	return tbl, nil
+}
+
+// tag marks the snapshot produced by this load, the branch head is tagged
+// unless the load was already published to main
+func (s *SinkSnapshot) tag(ctx context.Context, tbl *table.Table) error {
+	head := branchHead(tbl.Metadata(), s.refs.Branch)
+	if head == nil {
+		return nil
+	}
+	name := expandRefName(s.cfg.Tag.Name, s.transfer.ID, time.Now())
+	if _, err := tagSnapshot(ctx, s.catalog, tbl, name, head.SnapshotID, s.cfg.Tag.Retention); err != nil {
+		return xerrors.Errorf("tag %s: %w", name, err)
+	}
+	return nil
+}
+
+// sourceRowCount asks the transfer source for the EtaRow of a table
+func (s *SinkSnapshot) sourceRowCount(tid abstract.TableID) (uint64, error) {
+	storage, err := s.sourceStorage()
+	if err != nil {
+		return 0, err
+	}
+	defer storage.Close()
+	return storage.EstimateTableRowsCount(tid)
+}
+
+// sourceExactRowCount asks the transfer source for the exact number of rows in a table
+func (s *SinkSnapshot) sourceExactRowCount(tid abstract.TableID) (uint64, error) {
+	storage, err := s.sourceStorage()
+	if err != nil {
+		return 0, err
+	}
+	defer storage.Close()
+	return storage.ExactTableRowsCount(tid)
+}
+
+func (s *SinkSnapshot) sourceStorage() (abstract.Storage, error) {
+	snapshotter, ok := providers.Source[providers.Snapshot](s.logger, s.registry, s.cp, s.transfer)
+	if !ok {
+		return nil, xerrors.Errorf("source %T does not support snapshots", s.transfer.Src)
+	}
+	storage, err := snapshotter.Storage()
+	if err != nil {
+		return nil, xerrors.Errorf("unable to create source storage: %w", err)
+	}
+	return storage, nil
+}
+
 func (s *SinkSnapshot) processTable(items []abstract.ChangeItem) error {
 	// Skip if no items
 	if len(items) == 0 {
@@ -157,7 +577,7 @@ func (s *SinkSnapshot) processTable(items []abstract.ChangeItem) error {
 	defer cancel()
 
 	// Ensure the table exists
-	tbl, err := s.ensureTable(ctx, items[0])
+	tbl, err := s.ensureTable(ctx, s.writeTableIdent(items[0]), items[0])
 	if err != nil {
 		return xerrors.Errorf("ensure table: %w", err)
 	}
@@ -170,9 +590,19 @@ func (s *SinkSnapshot) createTableIdent(item abstract.ChangeItem) table.Identifi
 	return table.Identifier{item.Schema, item.Table}
 }
 
-func (s *SinkSnapshot) ensureTable(ctx context.Context, item abstract.ChangeItem) (*table.Table, error) {
-	tbl := s.createTableIdent(item)
+// writeTableIdent returns the table rows of item are written to
+func (s *SinkSnapshot) writeTableIdent(item abstract.ChangeItem) table.Identifier {
+	if s.cfg.StagedLoad {
+		return s.stagingTableIdent(item)
+	}
+	return s.createTableIdent(item)
+}
+
+func (s *SinkSnapshot) stagingTableIdent(item abstract.ChangeItem) table.Identifier {
+	return table.Identifier{item.Schema, fmt.Sprintf("%s__tmp_%s", item.Table, s.transfer.ID)}
+}
 
+func (s *SinkSnapshot) ensureTable(ctx context.Context, tbl table.Identifier, item abstract.ChangeItem) (*table.Table, error) {
 	existingTable, err := s.catalog.LoadTable(ctx, tbl, s.cfg.Properties)
 	if err == nil {
 		return existingTable, nil
@@ -183,7 +613,14 @@ func (s *SinkSnapshot) ensureTable(ctx context.Context, item abstract.ChangeItem
 		return nil, xerrors.Errorf("converting to IcebergSchema: %w", err)
 	}
 
-	itable, err := s.catalog.CreateTable(ctx, tbl, schema)
+	if err := ensureNamespace(ctx, s.catalog, tbl); err != nil {
+		return nil, err
+	}
+	itable, err := s.catalog.CreateTable(ctx, tbl, schema, catalog.WithProperties(s.cfg.TableProperties))
+	if xerrors.Is(err, catalog.ErrTableAlreadyExists) {
+		// created by another worker since the table was loaded
+		return s.catalog.LoadTable(ctx, tbl, s.cfg.Properties)
+	}
 	if err != nil {
 		return nil, xerrors.Errorf("creating table: %w", err)
 	}
@@ -205,7 +642,7 @@ func (s *SinkSnapshot) writeBatch(tbl *table.Table, items []abstract.ChangeItem)
 	if err := writeFile(fName, tbl, items); err != nil {
 		return xerrors.Errorf("write file %s: %w", fName, err)
 	}
-	s.storeFile(fName)
+	s.storeFile(items[0].TablePartID(), fName, uint64(len(items)))
 	return nil
 }
 
@@ -216,41 +653,56 @@ func (s *SinkSnapshot) loadInsertNum() int {
 	return s.insertNum
 }
 
-func (s *SinkSnapshot) storeFile(name string) {
+func (s *SinkSnapshot) storeFile(id abstract.TablePartID, name string, rows uint64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.files = append(s.files, name)
-}
-
-func NewSinkSnapshot(cfg *Destination, cp coordinator.Coordinator, transfer *model.Transfer) (*SinkSnapshot, error) {
-	var cat catalog.Catalog
-	if cfg.CatalogType == "rest" {
-		var err error
-		cat, err = rest.NewCatalog(
-			context.Background(),
-			cfg.CatalogType,
-			cfg.CatalogURI,
-			rest.WithAdditionalProps(cfg.Properties),
-		)
-		if err != nil {
-			return nil, xerrors.Errorf("unable to init catalog: %w", err)
-		}
-	} else if cfg.CatalogType == "glue" {
-		cat = glue.NewCatalog()
+	part, ok := s.parts[id]
+	if !ok {
+		part = &partFiles{Files: nil, Rows: 0}
+		s.parts[id] = part
+	}
+	part.Files = append(part.Files, name)
+	part.Rows += rows
+}
+
+func (s *SinkSnapshot) takePart(id abstract.TablePartID) *partFiles {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	part, ok := s.parts[id]
+	if !ok {
+		return &partFiles{Files: nil, Rows: 0}
+	}
+	delete(s.parts, id)
+	return part
+}
+
+func NewSinkSnapshot(cfg *Destination, cp coordinator.Coordinator, transfer *model.Transfer, logger log.Logger, registry metrics.Registry) (*SinkSnapshot, error) {
+	refs, err := resolveRefNames(cfg, cp, transfer.ID)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to resolve branch names: %w", err)
+	}
+	catalogProps := cfg.catalogProperties(refs)
+	cat, err := newCatalog(context.Background(), cfg.CatalogType, cfg.CatalogURI, catalogProps)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init catalog: %w", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &SinkSnapshot{
-		cfg:        cfg,
-		catalog:    cat,
-		ctx:        ctx,
-		cancelFunc: cancel,
-		mu:         sync.Mutex{},
-		insertNum:  0,
-		workerNum:  transfer.CurrentJobIndex(),
-		files:      nil,
-		cp:         cp,
-		transfer:   transfer,
+		cfg:          cfg,
+		catalog:      cat,
+		catalogProps: catalogProps,
+		refs:         refs,
+		ctx:          ctx,
+		cancelFunc:   cancel,
+		mu:           sync.Mutex{},
+		insertNum:    0,
+		workerNum:    transfer.CurrentJobIndex(),
+		parts:        make(map[abstract.TablePartID]*partFiles),
+		cp:           cp,
+		transfer:     transfer,
+		logger:       logger,
+		registry:     registry,
 	}, nil
 }
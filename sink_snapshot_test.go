@@ -0,0 +1,338 @@
+package iceberg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/stretchr/testify/require"
+	"github.com/transferia/iceberg/logger"
+	"github.com/transferia/transferia/library/go/core/metrics/solomon"
+	"github.com/transferia/transferia/pkg/abstract"
+	"github.com/transferia/transferia/pkg/abstract/coordinator"
+	"github.com/transferia/transferia/pkg/abstract/model"
+)
+
+func TestLoadedParts(t *testing.T) {
+	users := abstract.TableID{Namespace: "public", Name: "users"}
+	usersLog := abstract.TableID{Namespace: "public", Name: "users_log"}
+
+	state := map[string]*coordinator.TransferStateData{
+		partFilesKey(users, "p1"): {Generic: &partFiles{Files: []string{"a", "b"}, Rows: 10}},
+		// JSON-decoded state of a remote coordinator
+		partFilesKey(users, "p2"):    {Generic: map[string]any{"files": []any{"c"}, "rows": float64(5)}},
+		partFilesKey(usersLog, "p1"): {Generic: &partFiles{Files: []string{"x"}, Rows: 1}},
+		pendingCommitKeyPrefix + "x": {Generic: "other"},
+	}
+
+	loaded, keys, err := loadedParts(state, users)
+	require.NoError(t, err)
+	sort.Strings(loaded.Files)
+	sort.Strings(keys)
+	require.Equal(t, []string{"a", "b", "c"}, loaded.Files)
+	require.Equal(t, uint64(15), loaded.Rows)
+	require.Equal(t, []string{partFilesKey(users, "p1"), partFilesKey(users, "p2")}, keys)
+
+	loaded, keys, err = loadedParts(state, usersLog)
+	require.NoError(t, err)
+	require.Equal(t, []string{"x"}, loaded.Files)
+	require.Equal(t, uint64(1), loaded.Rows)
+	require.Equal(t, []string{partFilesKey(usersLog, "p1")}, keys)
+
+	loaded, keys, err = loadedParts(state, abstract.TableID{Namespace: "public", Name: "orders"})
+	require.NoError(t, err)
+	require.Empty(t, loaded.Files)
+	require.Empty(t, keys)
+}
+
+func TestSinkSnapshotLocal(t *testing.T) {
+	t.Run("sql", func(t *testing.T) {
+		dst, err := LocalDestinationRecipe()
+		require.NoError(t, err)
+		testSinkSnapshotLocal(t, dst)
+	})
+	t.Run("hadoop", func(t *testing.T) {
+		dst, err := LocalDestinationRecipe()
+		require.NoError(t, err)
+		dst.CatalogType, dst.CatalogURI = CatalogTypeHadoop, ""
+		testSinkSnapshotLocal(t, dst)
+	})
+	t.Run("gcs", func(t *testing.T) {
+		if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+			t.Skip("STORAGE_EMULATOR_HOST of fake-gcs-server is not set")
+		}
+		dst, err := GCSDestinationRecipe()
+		require.NoError(t, err)
+		testSinkSnapshotLocal(t, dst)
+	})
+	t.Run("adls", func(t *testing.T) {
+		if os.Getenv("AZURITE_ENDPOINT") == "" {
+			t.Skip("AZURITE_ENDPOINT is not set")
+		}
+		dst, err := AzureDestinationRecipe()
+		require.NoError(t, err)
+		testSinkSnapshotLocal(t, dst)
+	})
+}
+
+func testSinkSnapshotLocal(t *testing.T, dst *Destination) {
+	t.Cleanup(func() { _ = os.RemoveAll(strings.TrimPrefix(dst.Prefix, "file://")) })
+	dst.WithDefaults()
+	require.NoError(t, dst.Validate())
+
+	cp := coordinator.NewStatefulFakeClient()
+	transfer := &model.Transfer{ID: "local"}
+	sink, err := NewSinkSnapshot(dst, cp, transfer, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	tableSchema := abstract.NewTableSchema([]abstract.ColSchema{
+		{ColumnName: "id", DataType: "INT64", Required: true, PrimaryKey: true},
+		{ColumnName: "name", DataType: "STRING"},
+	})
+	control := func(kind abstract.Kind) abstract.ChangeItem {
+		return abstract.ChangeItem{Kind: kind, Schema: "public", Table: "users", PartID: "p1", TableSchema: tableSchema}
+	}
+	row := func(id int64) abstract.ChangeItem {
+		return abstract.ChangeItem{
+			Kind:         abstract.InsertKind,
+			Schema:       "public",
+			Table:        "users",
+			PartID:       "p1",
+			TableSchema:  tableSchema,
+			ColumnNames:  []string{"id", "name"},
+			ColumnValues: []any{id, fmt.Sprintf("user %d", id)},
+		}
+	}
+
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.InitShardedTableLoad), control(abstract.InitTableLoad)}))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{row(1), row(2)}))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{row(3)}))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.DoneTableLoad), control(abstract.DoneShardedTableLoad)}))
+
+	rows, err := DestinationRowCount(dst, "public", "users")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), rows)
+}
+
+// pushTable loads rows with ids into public.<name> as a single part.
+func pushTable(t *testing.T, sink *SinkSnapshot, name string, ids ...int64) {
+	tableSchema := abstract.NewTableSchema([]abstract.ColSchema{
+		{ColumnName: "id", DataType: "INT64", Required: true, PrimaryKey: true},
+	})
+	control := func(kind abstract.Kind) abstract.ChangeItem {
+		return abstract.ChangeItem{Kind: kind, Schema: "public", Table: name, PartID: "p1", TableSchema: tableSchema}
+	}
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.InitShardedTableLoad), control(abstract.InitTableLoad)}))
+	var items []abstract.ChangeItem
+	for _, id := range ids {
+		items = append(items, abstract.ChangeItem{
+			Kind:         abstract.InsertKind,
+			Schema:       "public",
+			Table:        name,
+			PartID:       "p1",
+			TableSchema:  tableSchema,
+			ColumnNames:  []string{"id"},
+			ColumnValues: []any{id},
+		})
+	}
+	require.NoError(t, sink.Push(items))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.DoneTableLoad), control(abstract.DoneShardedTableLoad)}))
+}
+
+func TestSinkSnapshotAtomicCommit(t *testing.T) {
+	newSink := func(t *testing.T, dst *Destination, cp coordinator.Coordinator) *SinkSnapshot {
+		sink, err := NewSinkSnapshot(dst, cp, &model.Transfer{ID: "local"}, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = sink.Close() })
+		return sink
+	}
+
+	t.Run("state of a remote coordinator", func(t *testing.T) {
+		dst := localDestination(t)
+		dst.AtomicCommit = true
+		cp := coordinator.NewStatefulFakeClient()
+		sink := newSink(t, dst, cp)
+		pushTable(t, sink, "users", 1, 2)
+
+		// remote coordinators hand the state back decoded from JSON
+		state, err := cp.GetTransferState("local")
+		require.NoError(t, err)
+		for k, v := range state {
+			data, err := json.Marshal(v.Generic)
+			require.NoError(t, err)
+			var generic any
+			require.NoError(t, json.Unmarshal(data, &generic))
+			require.NoError(t, cp.SetTransferState("local", map[string]*coordinator.TransferStateData{k: {Generic: generic}}))
+		}
+
+		require.NoError(t, sink.Commit())
+		rows, err := DestinationRowCount(dst, "public", "users")
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), rows)
+		state, err = cp.GetTransferState("local")
+		require.NoError(t, err)
+		require.Empty(t, state)
+	})
+
+	t.Run("malformed state", func(t *testing.T) {
+		dst := localDestination(t)
+		dst.AtomicCommit = true
+		cp := coordinator.NewStatefulFakeClient()
+		require.NoError(t, cp.SetTransferState("local", map[string]*coordinator.TransferStateData{
+			pendingCommitKeyPrefix + "public.users": {Generic: []any{"users"}},
+		}))
+		require.ErrorContains(t, newSink(t, dst, cp).Commit(), pendingCommitKeyPrefix+"public.users")
+	})
+
+	t.Run("committed tables are not committed again", func(t *testing.T) {
+		dst := localDestination(t)
+		dst.AtomicCommit = true
+		dst.Verify = VerifyConfig{Enabled: true, FailOnMismatch: true}
+		cp := coordinator.NewStatefulFakeClient()
+		sink := newSink(t, dst, cp)
+		pushTable(t, sink, "users", 1, 2)
+		pushTable(t, sink, "orders", 1)
+
+		// verification of users fails once it is committed
+		key := partFilesKey(abstract.TableID{Namespace: "public", Name: "users"}, "p1")
+		state, err := cp.GetTransferState("local")
+		require.NoError(t, err)
+		part := *state[key].Generic.(*partFiles)
+		part.Rows = 3
+		require.NoError(t, cp.SetTransferState("local", map[string]*coordinator.TransferStateData{key: {Generic: &part}}))
+		require.ErrorContains(t, sink.Commit(), "verify snapshot")
+
+		state, err = cp.GetTransferState("local")
+		require.NoError(t, err)
+		require.NotContains(t, state, key)
+		require.NotContains(t, state, pendingCommitKeyPrefix+"public.users")
+
+		require.NoError(t, newSink(t, dst, cp).Commit())
+		for name, expected := range map[string]uint64{"users": 2, "orders": 1} {
+			rows, err := DestinationRowCount(dst, "public", name)
+			require.NoError(t, err)
+			require.Equal(t, expected, rows, name)
+		}
+	})
+}
+
+func TestSinkSnapshotCleanup(t *testing.T) {
+	ctx := context.Background()
+	exists := func(t *testing.T, file string) bool {
+		_, err := os.Stat(strings.TrimPrefix(file, "file://"))
+		if os.IsNotExist(err) {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+	for _, tc := range []struct {
+		name         string
+		kind         abstract.Kind
+		configure    func(dst *Destination)
+		dropped      bool
+		filesKept    bool
+		rowsAfter    uint64
+		newSnapshots int
+	}{
+		{name: "drop", kind: abstract.DropTableKind, dropped: true, filesKept: true},
+		{name: "purge", kind: abstract.DropTableKind, configure: func(dst *Destination) { dst.PurgeOnDrop = true }, dropped: true},
+		{name: "truncate", kind: abstract.TruncateTableKind, filesKept: true, rowsAfter: 0, newSnapshots: 1},
+		{name: "overwrite keeps the table", kind: abstract.DropTableKind, configure: func(dst *Destination) { dst.WriteMode = WriteModeOverwrite }, filesKept: true, rowsAfter: 4},
+		{name: "staged load keeps the table", kind: abstract.TruncateTableKind, configure: func(dst *Destination) { dst.StagedLoad = true }, filesKept: true, rowsAfter: 4},
+		{name: "drop on a branch keeps main", kind: abstract.DropTableKind, configure: func(dst *Destination) { dst.Branch = "audit" }, filesKept: true, rowsAfter: 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := localDestination(t)
+			writeUsers(t, dst, 0, 1, 2)
+			writeUsers(t, dst, 2, 1, 2)
+			cat, tbl := usersTable(t, dst)
+			files, err := reachableFiles(tbl)
+			require.NoError(t, err)
+			// 2 data files, their manifests and manifest lists, and metadata files
+			require.Greater(t, len(files), 6)
+			require.Contains(t, files, tbl.MetadataLocation())
+			for _, file := range files {
+				require.True(t, exists(t, file), file)
+			}
+
+			if tc.configure != nil {
+				tc.configure(dst)
+			}
+			sink, err := NewSinkSnapshot(dst, coordinator.NewStatefulFakeClient(), &model.Transfer{ID: "local"}, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+			require.NoError(t, err)
+			defer sink.Close()
+			require.NoError(t, sink.Push([]abstract.ChangeItem{{Kind: tc.kind, Schema: "public", Table: "users"}}))
+
+			for _, file := range files {
+				require.Equal(t, tc.filesKept, exists(t, file), file)
+			}
+			after, err := cat.LoadTable(ctx, tbl.Identifier(), dst.Properties)
+			if tc.dropped {
+				require.ErrorIs(t, err, catalog.ErrNoSuchTable)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, after.Metadata().Snapshots(), len(tbl.Metadata().Snapshots())+tc.newSnapshots)
+			rows, err := DestinationRowCount(dst, "public", "users")
+			require.NoError(t, err)
+			require.Equal(t, tc.rowsAfter, rows)
+		})
+	}
+}
+
+func TestSinkSnapshotInterleavedParts(t *testing.T) {
+	dst := localDestination(t)
+	cp := coordinator.NewStatefulFakeClient()
+	sink, err := NewSinkSnapshot(dst, cp, &model.Transfer{ID: "local"}, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	tableSchema := abstract.NewTableSchema([]abstract.ColSchema{
+		{ColumnName: "id", DataType: "INT64", Required: true, PrimaryKey: true},
+	})
+	control := func(kind abstract.Kind, part string) abstract.ChangeItem {
+		return abstract.ChangeItem{Kind: kind, Schema: "public", Table: "users", PartID: part, TableSchema: tableSchema}
+	}
+	row := func(part string, id int64) abstract.ChangeItem {
+		return abstract.ChangeItem{
+			Kind:         abstract.InsertKind,
+			Schema:       "public",
+			Table:        "users",
+			PartID:       part,
+			TableSchema:  tableSchema,
+			ColumnNames:  []string{"id"},
+			ColumnValues: []any{id},
+		}
+	}
+	users := abstract.TableID{Namespace: "public", Name: "users"}
+	partRows := func(part string) uint64 {
+		state, err := cp.GetTransferState("local")
+		require.NoError(t, err)
+		require.Contains(t, state, partFilesKey(users, part))
+		var files partFiles
+		require.NoError(t, decodeState(state[partFilesKey(users, part)].Generic, &files))
+		return files.Rows
+	}
+
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.InitShardedTableLoad, ""), control(abstract.InitTableLoad, "p1"), control(abstract.InitTableLoad, "p2")}))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{row("p1", 1), row("p2", 2), row("p1", 3)}))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{row("p2", 4)}))
+	// the first part to finish persists only its own files
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.DoneTableLoad, "p2")}))
+	require.Equal(t, uint64(2), partRows("p2"))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{row("p1", 5)}))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.DoneTableLoad, "p1")}))
+	require.Equal(t, uint64(3), partRows("p1"))
+
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.DoneShardedTableLoad, "")}))
+	rows, err := DestinationRowCount(dst, "public", "users")
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), rows)
+}
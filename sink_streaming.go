@@ -9,8 +9,6 @@ import (
 	"time"
 
 	"github.com/apache/iceberg-go/catalog"
-	"github.com/apache/iceberg-go/catalog/glue"
-	"github.com/apache/iceberg-go/catalog/rest"
 	"github.com/apache/iceberg-go/table"
 
 	"github.com/transferia/transferia/library/go/core/xerrors"
@@ -38,16 +36,22 @@ type SinkStreaming struct {
 	insertNum     int
 	workerNum     int
 	files         map[string][]string // Map of tableID -> file paths
+	committed     map[string]bool     // tables the scheduler has committed files of any worker to
+	refs          *refNames
 	cp            coordinator.Coordinator
 	transfer      *model.Transfer
 	commitTicker  *time.Ticker
 	commitDone    chan bool
 	commitTimeout time.Duration
+	rewriteTicker *time.Ticker
 	lgr           log.Logger
 }
 
 // Close implements abstract.Sinker.
 func (s *SinkStreaming) Close() error {
+	if s.rewriteTicker != nil {
+		s.rewriteTicker.Stop()
+	}
 	if s.commitTicker != nil {
 		s.commitTicker.Stop()
 		s.commitDone <- true
@@ -55,6 +59,7 @@ func (s *SinkStreaming) Close() error {
 	if s.cancelFunc != nil {
 		s.cancelFunc()
 	}
+	closeCatalog(s.catalog)
 	return nil
 }
 
@@ -130,7 +135,14 @@ func (s *SinkStreaming) ensureTable(ctx context.Context, item abstract.ChangeIte
 		return nil, xerrors.Errorf("converting to IcebergSchema: %w", err)
 	}
 
-	itable, err := s.catalog.CreateTable(ctx, tblIdent, schema)
+	if err := ensureNamespace(ctx, s.catalog, tblIdent); err != nil {
+		return nil, err
+	}
+	itable, err := s.catalog.CreateTable(ctx, tblIdent, schema, catalog.WithProperties(s.cfg.TableProperties))
+	if xerrors.Is(err, catalog.ErrTableAlreadyExists) {
+		// created by another worker since the table was loaded
+		return s.catalog.LoadTable(ctx, tblIdent, s.cfg.Properties)
+	}
 	if err != nil {
 		return nil, xerrors.Errorf("creating table: %w", err)
 	}
@@ -202,9 +214,20 @@ func (s *SinkStreaming) startCommitScheduler() {
 	s.commitTicker = time.NewTicker(s.commitTimeout)
 	s.commitDone = make(chan bool)
 
+	// Manifest rewrite is optional, a nil channel never fires
+	var rewriteC <-chan time.Time
+	if s.cfg.RewriteManifestsInterval > 0 {
+		s.rewriteTicker = time.NewTicker(s.cfg.RewriteManifestsInterval)
+		rewriteC = s.rewriteTicker.C
+	}
+
 	go func() {
 		for {
 			select {
+			case <-rewriteC:
+				if err := s.rewriteManifests(); err != nil {
+					s.lgr.Warnf("unable to rewrite manifests: %v", err)
+				}
 			case <-s.commitTicker.C:
 				if err := s.commitTables(); err != nil {
 					// Log error but continue
@@ -261,16 +284,18 @@ func (s *SinkStreaming) commitTables() error {
 			continue
 		}
 
-		// Create transaction and add files
-		tx := tbl.NewTransaction()
-		if err := tx.AddFiles(files, s.cfg.SnapshotProps, false); err != nil {
-			return xerrors.Errorf("add files for table %s: %w", tableID, err)
+		// Append files in a single snapshot, merging manifests if the table asks for it
+		_, err = newSnapshotUpdate(s.catalog, tbl, s.cfg.SnapshotProps).
+			toBranch(s.refs.Branch).
+			appendFiles(files).
+			commit(ctx)
+		if err != nil {
+			return xerrors.Errorf("commit snapshot for table %s: %w", tableID, err)
 		}
 
-		// Commit transaction
-		if _, err := tx.Commit(ctx); err != nil {
-			return xerrors.Errorf("commit transaction for table %s: %w", tableID, err)
-		}
+		s.mu.Lock()
+		s.committed[tableID] = true
+		s.mu.Unlock()
 
 		// Clear committed files from coordinator
 		if err := s.clearState(tableID); err != nil {
@@ -281,6 +306,36 @@ func (s *SinkStreaming) commitTables() error {
 	return nil
 }
 
+// rewriteManifests clusters manifests of every table the scheduler has committed to,
+// files of all workers are committed by it, so these are all tables written by the transfer
+func (s *SinkStreaming) rewriteManifests() error {
+	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Minute)
+	defer cancel()
+
+	s.mu.Lock()
+	tableIDs := make([]string, 0, len(s.committed))
+	for tableID := range s.committed {
+		tableIDs = append(tableIDs, tableID)
+	}
+	s.mu.Unlock()
+
+	for _, tableID := range tableIDs {
+		tid, _ := abstract.ParseTableID(tableID)
+		if tid.Namespace == "" {
+			tid.Namespace = s.cfg.DefaultNamespace
+		}
+		tblIdent := table.Identifier{tid.Namespace, tid.Name}
+		tbl, err := s.catalog.LoadTable(ctx, tblIdent, s.cfg.Properties)
+		if err != nil {
+			return xerrors.Errorf("load table %s: %w", tableID, err)
+		}
+		if _, err := RewriteManifests(ctx, s.catalog, tbl, s.refs.Branch, s.cfg.SnapshotProps); err != nil {
+			return xerrors.Errorf("rewrite manifests for table %s: %w", tableID, err)
+		}
+	}
+	return nil
+}
+
 // getTableIDsFromKey extracts table IDs from coordinator keys
 func (s *SinkStreaming) getTableIDsFromKey(key string) []string {
 	// If key is "streaming_files_{tableID}_{workerNum}", extract tableID
@@ -353,20 +408,14 @@ func (s *SinkStreaming) clearState(tableID string) error {
 
 // NewSinkStreaming creates a new streaming sink
 func NewSinkStreaming(cfg *Destination, cp coordinator.Coordinator, transfer *model.Transfer, logger log.Logger) (*SinkStreaming, error) {
-	var cat catalog.Catalog
-	if cfg.CatalogType == "rest" {
-		var err error
-		cat, err = rest.NewCatalog(
-			context.Background(),
-			cfg.CatalogType,
-			cfg.CatalogURI,
-			rest.WithAdditionalProps(cfg.Properties),
-		)
-		if err != nil {
-			return nil, xerrors.Errorf("unable to init catalog: %w", err)
-		}
-	} else if cfg.CatalogType == "glue" {
-		cat = glue.NewCatalog()
+	// references are resolved once, a stream keeps committing to them after midnight
+	refs, err := resolveRefNames(cfg, cp, transfer.ID)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to resolve branch names: %w", err)
+	}
+	cat, err := newCatalog(context.Background(), cfg.CatalogType, cfg.CatalogURI, cfg.catalogProperties(refs))
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init catalog: %w", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -386,6 +435,8 @@ func NewSinkStreaming(cfg *Destination, cp coordinator.Coordinator, transfer *mo
 		insertNum:     0,
 		workerNum:     transfer.CurrentJobIndex(),
 		files:         make(map[string][]string),
+		committed:     make(map[string]bool),
+		refs:          refs,
 		cp:            cp,
 		transfer:      transfer,
 		commitTimeout: commitTimeout,
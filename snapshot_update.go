@@ -0,0 +1,633 @@
+package iceberg
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	iceio "github.com/apache/iceberg-go/io"
+	"github.com/apache/iceberg-go/table"
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+const (
+	summaryAddedDataFiles   = "added-data-files"
+	summaryAddedRecords     = "added-records"
+	summaryAddedFileSize    = "added-files-size"
+	summaryDeletedDataFiles = "deleted-data-files"
+	summaryDeletedRecords   = "deleted-records"
+	summaryRemovedFileSize  = "removed-files-size"
+	summaryTotalDataFiles   = "total-data-files"
+	summaryTotalRecords     = "total-records"
+	summaryTotalFileSize    = "total-files-size"
+
+	summaryManifestsCreated  = "manifests-created"
+	summaryManifestsKept     = "manifests-kept"
+	summaryManifestsReplaced = "manifests-replaced"
+	summaryEntriesProcessed  = "entries-processed"
+	summaryReplacePartitions = "replace-partitions"
+)
+
+// overwriteScope selects live files of the parent snapshot an update deletes.
+type overwriteScope int
+
+const (
+	overwriteNone overwriteScope = iota
+	overwriteTable
+	overwritePartitions
+)
+
+// snapshotUpdate assembles a single snapshot out of data files produced by sinks
+// and commits it through the catalog.
+//
+// iceberg-go transactions can only fast-append, so data files are staged through
+// Transaction.AddFiles to get a manifest with column stats, and the rest of the
+// snapshot (manifest merging, manifest list, refs) is built here.
+type snapshotUpdate struct {
+	cat           catalog.Catalog
+	tbl           *table.Table
+	snapshotProps iceberg.Properties
+	branch        string
+	added         []string
+	overwrite     overwriteScope
+	commitUUID    uuid.UUID
+	manifestNum   int
+}
+
+func newSnapshotUpdate(cat catalog.Catalog, tbl *table.Table, snapshotProps iceberg.Properties) *snapshotUpdate {
+	return &snapshotUpdate{
+		cat:           cat,
+		tbl:           tbl,
+		snapshotProps: snapshotProps,
+		branch:        table.MainBranch,
+		added:         nil,
+		overwrite:     overwriteNone,
+		commitUUID:    uuid.New(),
+		manifestNum:   0,
+	}
+}
+
+// overwriteAll makes the snapshot delete every live file of the parent,
+// it is committed even if there are no files to add.
+func (u *snapshotUpdate) overwriteAll() *snapshotUpdate {
+	u.overwrite = overwriteTable
+	return u
+}
+
+// overwritePartitions makes the snapshot delete live files of the parent
+// in partitions the added files belong to.
+func (u *snapshotUpdate) overwritePartitions() *snapshotUpdate {
+	u.overwrite = overwritePartitions
+	return u
+}
+
+func (u *snapshotUpdate) appendFiles(files []string) *snapshotUpdate {
+	u.added = append(u.added, files...)
+	return u
+}
+
+// toBranch makes the snapshot be committed to branch instead of main,
+// a missing branch is created from the current snapshot of main.
+func (u *snapshotUpdate) toBranch(branch string) *snapshotUpdate {
+	if branch != "" {
+		u.branch = branch
+	}
+	return u
+}
+
+// parent returns the head of the target branch, or the main snapshot
+// the branch is going to be forked from.
+func (u *snapshotUpdate) parent() *table.Snapshot {
+	if head := branchHead(u.tbl.Metadata(), u.branch); head != nil {
+		return head
+	}
+	return u.tbl.CurrentSnapshot()
+}
+
+// commit writes an append snapshot with all added files and merges manifests
+// if the table has commit.manifest-merge.enabled set.
+func (u *snapshotUpdate) commit(ctx context.Context) (*table.Table, error) {
+	change, err := u.stage()
+	if err != nil {
+		return nil, err
+	}
+	if change == nil {
+		return u.tbl, nil
+	}
+	return change.commit(ctx, u.cat)
+}
+
+// stage writes manifests and the manifest list of the snapshot and returns
+// the catalog change without committing it, nil if the snapshot would change nothing.
+func (u *snapshotUpdate) stage() (*tableChange, error) {
+	parent := u.parent()
+	if len(u.added) == 0 && (u.overwrite == overwriteNone || parent == nil) {
+		return nil, nil
+	}
+	fileIO, err := u.writeIO()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		snapshotID = newSnapshotID(u.tbl.Metadata())
+		seqNum     = nextSequenceNumber(u.tbl.Metadata())
+		summary    = iceberg.Properties{}
+		manifests  []iceberg.ManifestFile
+	)
+	maps.Copy(summary, u.snapshotProps)
+	if len(u.added) > 0 {
+		staged, addedManifests, err := u.stageFiles()
+		if err != nil {
+			return nil, xerrors.Errorf("stage files: %w", err)
+		}
+		snapshotID, seqNum = staged.SnapshotID, staged.SequenceNumber
+		summary = maps.Clone(staged.Summary.Properties)
+		manifests = addedManifests
+	}
+
+	operation := table.OpAppend
+	if parent != nil {
+		existing, err := parent.Manifests(u.tbl.FS())
+		if err != nil {
+			return nil, xerrors.Errorf("read manifests of snapshot %d: %w", parent.SnapshotID, err)
+		}
+		if u.overwrite != overwriteNone {
+			var deleted int
+			existing, deleted, err = u.overwriteManifests(fileIO, snapshotID, manifests, existing, summary)
+			if err != nil {
+				return nil, xerrors.Errorf("overwrite files: %w", err)
+			}
+			if deleted > 0 {
+				operation = table.OpOverwrite
+			} else if len(u.added) == 0 {
+				return nil, nil
+			}
+		}
+		manifests = append(manifests, existing...)
+	}
+
+	if u.tbl.Properties().GetBool(table.ManifestMergeEnabledKey, table.ManifestMergeEnabledDefault) {
+		manifests, err = u.mergeManifests(fileIO, snapshotID, manifests)
+		if err != nil {
+			return nil, xerrors.Errorf("merge manifests: %w", err)
+		}
+	}
+
+	updateSummaryTotals(summary, parent)
+
+	return u.stageSnapshot(fileIO, &table.Snapshot{
+		SnapshotID:     snapshotID,
+		SequenceNumber: seqNum,
+		Summary:        &table.Summary{Operation: operation, Properties: summary},
+	}, parent, manifests)
+}
+
+// overwriteManifests marks live data files of the parent replaced by the overwrite as deleted
+// and records them in summary. It returns the manifests to keep and the number of deleted files.
+func (u *snapshotUpdate) overwriteManifests(
+	fileIO iceio.WriteFileIO,
+	snapshotID int64,
+	added []iceberg.ManifestFile,
+	existing []iceberg.ManifestFile,
+	summary iceberg.Properties,
+) ([]iceberg.ManifestFile, int, error) {
+	var partitions map[string]bool
+	if u.overwrite == overwritePartitions {
+		var err error
+		if partitions, err = u.partitionsOf(added); err != nil {
+			return nil, 0, err
+		}
+		summary[summaryReplacePartitions] = "true"
+	}
+	replaced := func(specID int32, df iceberg.DataFile) bool {
+		if u.overwrite == overwriteTable {
+			return true
+		}
+		spec, err := specByID(u.tbl.Metadata(), int(specID))
+		if err != nil {
+			return false
+		}
+		return partitions[fmt.Sprintf("%d/%s", specID, partitionKey(spec, df))]
+	}
+
+	var (
+		result                       []iceberg.ManifestFile
+		deletedFiles, deletedRecords int
+		removedSize                  int64
+	)
+	for _, m := range existing {
+		if m.ManifestContent() != iceberg.ManifestContentData {
+			// delete files only apply to older data files, once all of them are gone so are the deletes
+			if u.overwrite != overwriteTable {
+				result = append(result, m)
+			}
+			continue
+		}
+		entries, err := m.FetchEntries(u.tbl.FS(), true)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("read manifest %s: %w", m.FilePath(), err)
+		}
+		if !slices.ContainsFunc(entries, func(entry iceberg.ManifestEntry) bool {
+			return replaced(m.PartitionSpecID(), entry.DataFile())
+		}) {
+			result = append(result, m)
+			continue
+		}
+		rewritten, err := u.writeManifest(fileIO, snapshotID, int(m.PartitionSpecID()), entries, func(w *iceberg.ManifestWriter, entry iceberg.ManifestEntry) error {
+			if !replaced(m.PartitionSpecID(), entry.DataFile()) {
+				return w.Existing(entry)
+			}
+			deletedFiles++
+			deletedRecords += int(entry.DataFile().Count())
+			removedSize += entry.DataFile().FileSizeBytes()
+			return w.Delete(entry)
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		result = append(result, rewritten)
+	}
+
+	if deletedFiles > 0 {
+		summary[summaryDeletedDataFiles] = strconv.Itoa(deletedFiles)
+		summary[summaryDeletedRecords] = strconv.Itoa(deletedRecords)
+		summary[summaryRemovedFileSize] = strconv.FormatInt(removedSize, 10)
+	}
+	return result, deletedFiles, nil
+}
+
+// partitionsOf collects partitions of all files in manifests, keyed by spec ID and partition values.
+func (u *snapshotUpdate) partitionsOf(manifests []iceberg.ManifestFile) (map[string]bool, error) {
+	partitions := map[string]bool{}
+	for _, m := range manifests {
+		spec, err := specByID(u.tbl.Metadata(), int(m.PartitionSpecID()))
+		if err != nil {
+			return nil, err
+		}
+		entries, err := m.FetchEntries(u.tbl.FS(), true)
+		if err != nil {
+			return nil, xerrors.Errorf("read manifest %s: %w", m.FilePath(), err)
+		}
+		for _, entry := range entries {
+			partitions[fmt.Sprintf("%d/%s", m.PartitionSpecID(), partitionKey(spec, entry.DataFile()))] = true
+		}
+	}
+	return partitions, nil
+}
+
+// stageFiles runs a throwaway fast append over the files and returns the staged
+// snapshot together with the manifests it added.
+func (u *snapshotUpdate) stageFiles() (*table.Snapshot, []iceberg.ManifestFile, error) {
+	tx := u.tbl.NewTransaction()
+	if err := tx.AddFiles(u.added, u.snapshotProps, false); err != nil {
+		return nil, nil, xerrors.Errorf("add files: %w", err)
+	}
+	staged, err := tx.StagedTable()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("build staged table: %w", err)
+	}
+	snapshot := staged.CurrentSnapshot()
+	if snapshot == nil {
+		return nil, nil, xerrors.New("staged table has no snapshot")
+	}
+	manifests, err := snapshot.Manifests(u.tbl.FS())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("read staged manifests: %w", err)
+	}
+	var added []iceberg.ManifestFile
+	for _, m := range manifests {
+		if m.SnapshotID() == snapshot.SnapshotID && m.HasAddedFiles() {
+			added = append(added, m)
+		}
+	}
+	return snapshot, added, nil
+}
+
+// mergeManifests follows the MergeAppend rules of the reference implementation:
+// data manifests of each partition spec are packed into bins of
+// commit.manifest.target-size-bytes, and a bin holding the newest manifest is
+// only merged once it reaches commit.manifest.min-count-to-merge manifests.
+func (u *snapshotUpdate) mergeManifests(fileIO iceio.WriteFileIO, snapshotID int64, manifests []iceberg.ManifestFile) ([]iceberg.ManifestFile, error) {
+	props := u.tbl.Properties()
+	targetSize := int64(props.GetInt(table.ManifestTargetSizeBytesKey, table.ManifestTargetSizeBytesDefault))
+	minCount := props.GetInt(table.ManifestMinMergeCountKey, table.ManifestMinMergeCountDefault)
+
+	var (
+		result  []iceberg.ManifestFile
+		specIDs []int32
+		groups  = map[int32][]iceberg.ManifestFile{}
+	)
+	for _, m := range manifests {
+		if m.ManifestContent() != iceberg.ManifestContentData {
+			result = append(result, m)
+			continue
+		}
+		if _, ok := groups[m.PartitionSpecID()]; !ok {
+			specIDs = append(specIDs, m.PartitionSpecID())
+		}
+		groups[m.PartitionSpecID()] = append(groups[m.PartitionSpecID()], m)
+	}
+
+	var merged []iceberg.ManifestFile
+	for _, specID := range specIDs {
+		group := groups[specID]
+		for _, bin := range packManifests(group, targetSize) {
+			if len(bin) == 1 || (bin[0] == group[0] && len(bin) < minCount) {
+				merged = append(merged, bin...)
+				continue
+			}
+			m, err := u.writeMergedManifest(fileIO, snapshotID, int(specID), bin)
+			if err != nil {
+				return nil, err
+			}
+			if m != nil {
+				merged = append(merged, m)
+			}
+		}
+	}
+	return append(merged, result...), nil
+}
+
+func (u *snapshotUpdate) writeMergedManifest(fileIO iceio.WriteFileIO, snapshotID int64, specID int, bin []iceberg.ManifestFile) (iceberg.ManifestFile, error) {
+	var entries []iceberg.ManifestEntry
+	for _, m := range bin {
+		manifestEntries, err := m.FetchEntries(u.tbl.FS(), false)
+		if err != nil {
+			return nil, xerrors.Errorf("read manifest %s: %w", m.FilePath(), err)
+		}
+		for _, entry := range manifestEntries {
+			// deletes of previous snapshots are already applied, no need to carry them
+			if entry.Status() == iceberg.EntryStatusDELETED && entry.SnapshotID() != snapshotID {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return u.writeManifest(fileIO, snapshotID, specID, entries, func(w *iceberg.ManifestWriter, entry iceberg.ManifestEntry) error {
+		switch {
+		case entry.Status() == iceberg.EntryStatusDELETED:
+			return w.Delete(entry)
+		case entry.Status() == iceberg.EntryStatusADDED && entry.SnapshotID() == snapshotID:
+			return w.Add(entry)
+		default:
+			return w.Existing(entry)
+		}
+	})
+}
+
+// writeManifest writes entries of a single partition spec into a new manifest,
+// write decides which status each entry gets.
+func (u *snapshotUpdate) writeManifest(
+	fileIO iceio.WriteFileIO,
+	snapshotID int64,
+	specID int,
+	entries []iceberg.ManifestEntry,
+	write func(w *iceberg.ManifestWriter, entry iceberg.ManifestEntry) error,
+) (iceberg.ManifestFile, error) {
+	spec, err := specByID(u.tbl.Metadata(), specID)
+	if err != nil {
+		return nil, err
+	}
+	u.manifestNum++
+	path, err := u.metadataLocation(fmt.Sprintf("%s-m%d.avro", u.commitUUID, u.manifestNum))
+	if err != nil {
+		return nil, err
+	}
+	out, err := fileIO.Create(path)
+	if err != nil {
+		return nil, xerrors.Errorf("create manifest %s: %w", path, err)
+	}
+
+	counter := &countingWriter{W: out, Count: 0}
+	w, err := iceberg.NewManifestWriter(u.tbl.Metadata().Version(), counter, spec, u.tbl.Schema(), snapshotID)
+	if err != nil {
+		_ = out.Close()
+		return nil, xerrors.Errorf("create manifest writer: %w", err)
+	}
+	for _, entry := range entries {
+		if err := write(w, entry); err != nil {
+			_ = out.Close()
+			return nil, xerrors.Errorf("write entry %s: %w", entry.DataFile().FilePath(), err)
+		}
+	}
+	// object store writers upload on close, a manifest is only referenced once it is stored
+	if err := w.Close(); err != nil {
+		_ = out.Close()
+		return nil, xerrors.Errorf("close manifest writer %s: %w", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, xerrors.Errorf("close manifest %s: %w", path, err)
+	}
+	m, err := w.ToManifestFile(path, counter.Count)
+	if err != nil {
+		return nil, xerrors.Errorf("close manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// stageSnapshot writes the manifest list for snapshot and returns the change
+// adding it and moving the target branch to it.
+func (u *snapshotUpdate) stageSnapshot(
+	fileIO iceio.WriteFileIO,
+	snapshot *table.Snapshot,
+	parent *table.Snapshot,
+	manifests []iceberg.ManifestFile,
+) (*tableChange, error) {
+	meta := u.tbl.Metadata()
+	var parentID *int64
+	if parent != nil {
+		parentID = &parent.SnapshotID
+	}
+
+	listPath, err := u.metadataLocation(fmt.Sprintf("snap-%d-0-%s.avro", snapshot.SnapshotID, u.commitUUID))
+	if err != nil {
+		return nil, err
+	}
+	out, err := fileIO.Create(listPath)
+	if err != nil {
+		return nil, xerrors.Errorf("create manifest list %s: %w", listPath, err)
+	}
+	seqNum := snapshot.SequenceNumber
+	if err := iceberg.WriteManifestList(meta.Version(), out, snapshot.SnapshotID, parentID, &seqNum, manifests); err != nil {
+		_ = out.Close()
+		return nil, xerrors.Errorf("write manifest list %s: %w", listPath, err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, xerrors.Errorf("close manifest list %s: %w", listPath, err)
+	}
+
+	schemaID := u.tbl.Schema().ID
+	snapshot.ParentSnapshotID = parentID
+	snapshot.ManifestList = listPath
+	snapshot.SchemaID = &schemaID
+	snapshot.TimestampMs = time.Now().UnixMilli()
+
+	updates := []table.Update{
+		table.NewAddSnapshotUpdate(snapshot),
+		table.NewSetSnapshotRefUpdate(u.branch, snapshot.SnapshotID, table.BranchRef, -1, -1, -1),
+	}
+	if meta.NameMapping() == nil {
+		mapping, err := json.Marshal(u.tbl.Schema().NameMapping())
+		if err != nil {
+			return nil, xerrors.Errorf("marshal name mapping: %w", err)
+		}
+		updates = append(updates, table.NewSetPropertiesUpdate(iceberg.Properties{
+			table.DefaultNameMappingKey: string(mapping),
+		}))
+	}
+	// a new branch must not exist yet, an existing one must still point to the parent
+	var refID *int64
+	if head := branchHead(meta, u.branch); head != nil {
+		refID = &head.SnapshotID
+	}
+	return &tableChange{
+		tbl:        u.tbl,
+		snapshotID: snapshot.SnapshotID,
+		requirements: []table.Requirement{
+			table.AssertTableUUID(meta.TableUUID()),
+			table.AssertRefSnapshotID(u.branch, refID),
+		},
+		updates: updates,
+	}, nil
+}
+
+// tableChange is a set of updates of a single table ready to be sent to the catalog.
+type tableChange struct {
+	tbl          *table.Table
+	snapshotID   int64 // snapshot added by the change
+	requirements []table.Requirement
+	updates      []table.Update
+}
+
+func (c *tableChange) commit(ctx context.Context, cat catalog.Catalog) (*table.Table, error) {
+	newMeta, newLoc, err := cat.CommitTable(ctx, c.tbl, c.requirements, c.updates)
+	if err != nil {
+		return nil, xerrors.Errorf("commit table %s: %w", strings.Join(c.tbl.Identifier(), "."), err)
+	}
+	return table.New(c.tbl.Identifier(), newMeta, newLoc, c.tbl.FS(), cat), nil
+}
+
+func (u *snapshotUpdate) writeIO() (iceio.WriteFileIO, error) {
+	fileIO, ok := u.tbl.FS().(iceio.WriteFileIO)
+	if !ok {
+		return nil, xerrors.Errorf("%T does not implement io.WriteFileIO", u.tbl.FS())
+	}
+	return fileIO, nil
+}
+
+func (u *snapshotUpdate) metadataLocation(name string) (string, error) {
+	provider, err := table.LoadLocationProvider(u.tbl.Location(), u.tbl.Properties())
+	if err != nil {
+		return "", xerrors.Errorf("load location provider: %w", err)
+	}
+	return provider.NewMetadataLocation(name), nil
+}
+
+// packManifests greedily splits manifests into bins not larger than targetSize,
+// keeping their order so the newest manifests stay in the first bin.
+func packManifests(manifests []iceberg.ManifestFile, targetSize int64) [][]iceberg.ManifestFile {
+	var (
+		bins    [][]iceberg.ManifestFile
+		current []iceberg.ManifestFile
+		size    int64
+	)
+	for _, m := range manifests {
+		if len(current) > 0 && size+m.Length() > targetSize {
+			bins = append(bins, current)
+			current, size = nil, 0
+		}
+		current = append(current, m)
+		size += m.Length()
+	}
+	if len(current) > 0 {
+		bins = append(bins, current)
+	}
+	return bins
+}
+
+// updateSummaryTotals recomputes total-* summary fields against parent.
+func updateSummaryTotals(summary iceberg.Properties, parent *table.Snapshot) {
+	var previous iceberg.Properties
+	if parent != nil && parent.Summary != nil {
+		previous = parent.Summary.Properties
+	}
+	update := func(total, added, removed string) {
+		value := previous.GetInt(total, 0) + summary.GetInt(added, 0) - summary.GetInt(removed, 0)
+		if value >= 0 {
+			summary[total] = strconv.Itoa(value)
+		}
+	}
+	update(summaryTotalDataFiles, summaryAddedDataFiles, summaryDeletedDataFiles)
+	update(summaryTotalRecords, summaryAddedRecords, summaryDeletedRecords)
+	update(summaryTotalFileSize, summaryAddedFileSize, summaryRemovedFileSize)
+}
+
+// branchHead returns the snapshot a branch points to, nil if there is no such branch.
+func branchHead(meta table.Metadata, branch string) *table.Snapshot {
+	for name, ref := range meta.Refs() {
+		if name == branch && ref.SnapshotRefType == table.BranchRef {
+			return meta.SnapshotByID(ref.SnapshotID)
+		}
+	}
+	return nil
+}
+
+func specByID(meta table.Metadata, id int) (iceberg.PartitionSpec, error) {
+	for _, spec := range meta.PartitionSpecs() {
+		if spec.ID() == id {
+			return spec, nil
+		}
+	}
+	return iceberg.PartitionSpec{}, xerrors.Errorf("partition spec %d not found", id)
+}
+
+// newSnapshotID mirrors the snapshot id generation of iceberg-go.
+func newSnapshotID(meta table.Metadata) int64 {
+	for {
+		id := uuid.New()
+		var out [8]byte
+		for i := range out {
+			out[i] = id[i] ^ id[i+8]
+		}
+		snapshotID := int64(binary.LittleEndian.Uint64(out[:]))
+		if snapshotID < 0 {
+			snapshotID = -snapshotID
+		}
+		if meta.SnapshotByID(snapshotID) == nil {
+			return snapshotID
+		}
+	}
+}
+
+func nextSequenceNumber(meta table.Metadata) int64 {
+	if meta.Version() > 1 {
+		return meta.LastSequenceNumber() + 1
+	}
+	return 0
+}
+
+type countingWriter struct {
+	W     io.Writer
+	Count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.W.Write(p)
+	w.Count += int64(n)
+	return n, err
+}
@@ -0,0 +1,161 @@
+package iceberg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+
+	"github.com/transferia/transferia/pkg/abstract"
+)
+
+func TestPackManifests(t *testing.T) {
+	manifest := func(path string, length int64) iceberg.ManifestFile {
+		return iceberg.NewManifestFile(2, path, length, 0, 1).Build()
+	}
+	manifests := []iceberg.ManifestFile{
+		manifest("a", 40),
+		manifest("b", 40),
+		manifest("c", 40),
+		manifest("d", 120),
+		manifest("e", 10),
+	}
+
+	bins := packManifests(manifests, 100)
+	require.Equal(t, [][]iceberg.ManifestFile{
+		{manifests[0], manifests[1]},
+		{manifests[2]},
+		{manifests[3]},
+		{manifests[4]},
+	}, bins)
+
+	require.Empty(t, packManifests(nil, 100))
+}
+
+func TestUpdateSummaryTotals(t *testing.T) {
+	parent := &table.Snapshot{
+		Summary: &table.Summary{
+			Operation: table.OpAppend,
+			Properties: iceberg.Properties{
+				summaryTotalDataFiles: "3",
+				summaryTotalRecords:   "30",
+				summaryTotalFileSize:  "300",
+			},
+		},
+	}
+	summary := iceberg.Properties{
+		summaryAddedDataFiles:   "2",
+		summaryAddedRecords:     "20",
+		summaryAddedFileSize:    "200",
+		summaryDeletedDataFiles: "1",
+		summaryDeletedRecords:   "10",
+		summaryRemovedFileSize:  "100",
+	}
+	updateSummaryTotals(summary, parent)
+	require.Equal(t, "4", summary[summaryTotalDataFiles])
+	require.Equal(t, "40", summary[summaryTotalRecords])
+	require.Equal(t, "400", summary[summaryTotalFileSize])
+
+	first := iceberg.Properties{summaryAddedDataFiles: "1", summaryAddedRecords: "5", summaryAddedFileSize: "50"}
+	updateSummaryTotals(first, nil)
+	require.Equal(t, "1", first[summaryTotalDataFiles])
+	require.Equal(t, "5", first[summaryTotalRecords])
+	require.Equal(t, "50", first[summaryTotalFileSize])
+}
+
+func TestSnapshotUpdateOverwrite(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	cat, err := newCatalog(ctx, dst.CatalogType, dst.CatalogURI, dst.catalogProperties(dst.refNames("local", time.Now())))
+	require.NoError(t, err)
+	defer closeCatalog(cat)
+
+	ident := table.Identifier{"public", "events"}
+	require.NoError(t, ensureNamespace(ctx, cat, ident))
+	schema := iceberg.NewSchema(0,
+		iceberg.NestedField{ID: 1, Name: "id", Type: iceberg.PrimitiveTypes.Int64, Required: true},
+		iceberg.NestedField{ID: 2, Name: "region", Type: iceberg.PrimitiveTypes.String, Required: true},
+	)
+	spec := iceberg.NewPartitionSpec(iceberg.PartitionField{SourceID: 2, FieldID: 1000, Name: "region", Transform: iceberg.IdentityTransform{}})
+	tbl, err := cat.CreateTable(ctx, ident, schema, catalog.WithPartitionSpec(&spec))
+	require.NoError(t, err)
+
+	tableSchema := abstract.NewTableSchema([]abstract.ColSchema{
+		{ColumnName: "id", DataType: "INT64", Required: true, PrimaryKey: true},
+		{ColumnName: "region", DataType: "STRING", Required: true},
+	})
+	fileNum := 0
+	write := func(region string, ids ...int64) string {
+		var items []abstract.ChangeItem
+		for _, id := range ids {
+			items = append(items, abstract.ChangeItem{
+				Kind:         abstract.InsertKind,
+				TableSchema:  tableSchema,
+				ColumnNames:  []string{"id", "region"},
+				ColumnValues: []any{id, region},
+			})
+		}
+		fileNum++
+		name := fileName(dst.Prefix, fileNum, 0, tbl)
+		require.NoError(t, writeFile(name, tbl, items))
+		return name
+	}
+	requireSnapshot := func(tbl *table.Table, operation table.Operation, summary map[string]string, files ...string) {
+		snapshot := tbl.CurrentSnapshot()
+		require.Equal(t, operation, snapshot.Summary.Operation)
+		for k, v := range summary {
+			require.Equal(t, v, snapshot.Summary.Properties[k], k)
+		}
+		live, err := liveDataFiles(ctx, tbl)
+		require.NoError(t, err)
+		require.ElementsMatch(t, files, live)
+	}
+
+	eu1, us1 := write("eu", 1, 2), write("us", 3)
+	tbl, err = newSnapshotUpdate(cat, tbl, nil).appendFiles([]string{eu1, us1}).commit(ctx)
+	require.NoError(t, err)
+	requireSnapshot(tbl, table.OpAppend, map[string]string{summaryTotalDataFiles: "2", summaryTotalRecords: "3"}, eu1, us1)
+
+	// dynamic overwrite replaces only the partitions of the added files
+	eu2 := write("eu", 4, 5, 6)
+	tbl, err = newSnapshotUpdate(cat, tbl, nil).appendFiles([]string{eu2}).overwritePartitions().commit(ctx)
+	require.NoError(t, err)
+	requireSnapshot(tbl, table.OpOverwrite, map[string]string{
+		summaryReplacePartitions: "true",
+		summaryAddedDataFiles:    "1",
+		summaryAddedRecords:      "3",
+		summaryDeletedDataFiles:  "1",
+		summaryDeletedRecords:    "2",
+		summaryTotalDataFiles:    "2",
+		summaryTotalRecords:      "4",
+	}, us1, eu2)
+
+	// a new partition replaces nothing
+	asia := write("asia", 7)
+	tbl, err = newSnapshotUpdate(cat, tbl, nil).appendFiles([]string{asia}).overwritePartitions().commit(ctx)
+	require.NoError(t, err)
+	requireSnapshot(tbl, table.OpAppend, map[string]string{summaryTotalDataFiles: "3", summaryTotalRecords: "5"}, us1, eu2, asia)
+
+	// overwrite replaces all files
+	us2 := write("us", 8)
+	tbl, err = newSnapshotUpdate(cat, tbl, nil).appendFiles([]string{us2}).overwriteAll().commit(ctx)
+	require.NoError(t, err)
+	requireSnapshot(tbl, table.OpOverwrite, map[string]string{
+		summaryDeletedDataFiles: "3",
+		summaryDeletedRecords:   "5",
+		summaryTotalDataFiles:   "1",
+		summaryTotalRecords:     "1",
+	}, us2)
+
+	// overwrite without files empties the table, an empty table is left as it is
+	tbl, err = newSnapshotUpdate(cat, tbl, nil).overwriteAll().commit(ctx)
+	require.NoError(t, err)
+	requireSnapshot(tbl, table.OpOverwrite, map[string]string{summaryTotalDataFiles: "0", summaryTotalRecords: "0"})
+	same, err := newSnapshotUpdate(cat, tbl, nil).overwriteAll().commit(ctx)
+	require.NoError(t, err)
+	require.Equal(t, tbl.CurrentSnapshot().SnapshotID, same.CurrentSnapshot().SnapshotID)
+}
@@ -1,7 +1,10 @@
 package iceberg
 
 import (
+	"time"
+
 	"github.com/apache/iceberg-go"
+	"github.com/transferia/transferia/library/go/core/xerrors"
 	"github.com/transferia/transferia/pkg/abstract"
 	"github.com/transferia/transferia/pkg/abstract/model"
 )
@@ -16,6 +19,29 @@ type Source struct {
 	CatalogType string
 	CatalogURI  string
 	Schema      string
+
+	// NessieRef is the Nessie branch, tag or <name>@<hash> the nessie catalog reads from, empty means the default branch
+	NessieRef string
+
+	Auth  RESTAuthConfig
+	SigV4 SigV4Config
+
+	// CatalogHTTP configures the HTTP client of the rest and nessie catalogs, FileIOHTTP the one of the S3 FileIO
+	CatalogHTTP HTTPConfig
+	FileIOHTTP  HTTPConfig
+
+	// VendedCredentials makes the rest and nessie catalogs vend storage credentials of each table,
+	// they are used for reading and writing its files instead of the "s3." ones and refreshed before they expire
+	VendedCredentials bool
+
+	// ShardSize is the size of data files a part of a sharded table reads, 1 GiB by default
+	ShardSize int64
+
+	// SnapshotID, AsOf and Ref read tables as of a snapshot: the one with the ID, the current one at the time,
+	// or the head of the branch or tag. At most one of them is set, the current snapshot is read by default
+	SnapshotID int64
+	AsOf       time.Time
+	Ref        string
 }
 
 func (i *Source) GetProviderType() abstract.ProviderType {
@@ -23,10 +49,46 @@ func (i *Source) GetProviderType() abstract.ProviderType {
 }
 
 func (i *Source) Validate() error {
-	return nil
+	if err := validateCatalog(i.CatalogType, i.CatalogURI); err != nil {
+		return err
+	}
+	if err := validateNessieRef(i.CatalogType, i.NessieRef, ""); err != nil {
+		return err
+	}
+	if err := validateRESTAuth(i.CatalogType, i.Auth); err != nil {
+		return err
+	}
+	if err := validateSigV4(i.CatalogType, i.SigV4); err != nil {
+		return err
+	}
+	if err := validateHTTP(i.CatalogType, i.CatalogHTTP, i.FileIOHTTP); err != nil {
+		return err
+	}
+	if err := validateVendedCredentials(i.CatalogType, i.VendedCredentials); err != nil {
+		return err
+	}
+	if err := validateTimeTravel(i.SnapshotID, i.AsOf, i.Ref); err != nil {
+		return err
+	}
+	if i.ShardSize < 0 {
+		return xerrors.Errorf("shard size must not be negative, got %d", i.ShardSize)
+	}
+	return validateProperties("properties", i.Properties)
+}
+
+// catalogProperties returns Properties with the Nessie reference and the REST and FileIO options set.
+func (i *Source) catalogProperties() iceberg.Properties {
+	props := vendedCredentialsProps(i.SigV4.props(i.Auth.props(nessieProps(i.Properties, i.NessieRef, ""))), i.VendedCredentials)
+	return i.FileIOHTTP.props(i.CatalogHTTP.props(props, restHTTPPrefix), s3HTTPPrefix)
 }
 
 func (i *Source) WithDefaults() {
+	if i.Schema == "" {
+		i.Schema = defaultNamespace
+	}
+	if i.ShardSize == 0 {
+		i.ShardSize = defaultShardSize
+	}
 }
 
 func (i *Source) IsSource() {
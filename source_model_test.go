@@ -0,0 +1,59 @@
+package iceberg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		src  *Source
+		err  string
+	}{
+		{name: "rest", src: &Source{CatalogType: CatalogTypeREST, CatalogURI: "https://catalog.example.com"}},
+		{name: "glue", src: &Source{CatalogType: CatalogTypeGlue}},
+		{name: "sql", src: &Source{CatalogType: CatalogTypeSQL, CatalogURI: "postgres://iceberg@localhost/catalog"}},
+		{name: "sql without dsn", src: &Source{CatalogType: CatalogTypeSQL}, err: "DSN is required"},
+		{name: "hive", src: &Source{CatalogType: CatalogTypeHive, CatalogURI: "thrift://metastore:9083"}},
+		{name: "hive without uri", src: &Source{CatalogType: CatalogTypeHive}, err: "metastore address is required"},
+		{name: "nessie tag", src: &Source{CatalogType: CatalogTypeNessie, CatalogURI: "http://nessie:19120/iceberg", NessieRef: "release-1"}},
+		{name: "nessie ref of rest", src: &Source{CatalogType: CatalogTypeREST, CatalogURI: "https://catalog.example.com", NessieRef: "main"}, err: "not supported by the rest catalog"},
+		{name: "oauth2", src: &Source{CatalogType: CatalogTypeREST, CatalogURI: "https://catalog.example.com", Auth: RESTAuthConfig{Credential: "id:secret", Scope: "catalog"}}},
+		{name: "scope without credential", src: &Source{CatalogType: CatalogTypeREST, CatalogURI: "https://catalog.example.com", Auth: RESTAuthConfig{Scope: "catalog"}}, err: "require a credential"},
+		{name: "auth of glue", src: &Source{CatalogType: CatalogTypeGlue, Auth: RESTAuthConfig{Token: "secret"}}, err: "not supported by the glue catalog"},
+		{name: "sigv4", src: &Source{CatalogType: CatalogTypeREST, CatalogURI: "https://glue.us-east-1.amazonaws.com/iceberg", SigV4: SigV4Config{Enabled: true}}},
+		{name: "catalog proxy", src: &Source{CatalogType: CatalogTypeREST, CatalogURI: "https://catalog.example.com", CatalogHTTP: HTTPConfig{ProxyURI: "http://proxy:3128"}}, err: "only supported by the FileIO"},
+		{name: "sigv4 of sql", src: &Source{CatalogType: CatalogTypeSQL, CatalogURI: "sqlite:///tmp/catalog.db", SigV4: SigV4Config{Enabled: true}}, err: "not supported by the sql catalog"},
+		{name: "empty catalog type", src: &Source{}, err: `unknown catalog type ""`},
+		{name: "rest without uri", src: &Source{CatalogType: CatalogTypeREST}, err: "catalog URI is required"},
+		{name: "as of time", src: &Source{CatalogType: CatalogTypeGlue, AsOf: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{name: "snapshot and ref", src: &Source{CatalogType: CatalogTypeGlue, SnapshotID: 1, Ref: "v1"}, err: "only one of snapshot ID, as-of time and ref"},
+		{name: "negative shard size", src: &Source{CatalogType: CatalogTypeGlue, ShardSize: -1}, err: "shard size must not be negative"},
+		{name: "empty property key", src: &Source{CatalogType: CatalogTypeGlue, Properties: iceberg.Properties{"": "x"}}, err: "invalid key"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.src.Validate()
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestSourceWithDefaults(t *testing.T) {
+	src := &Source{}
+	src.WithDefaults()
+	require.Equal(t, defaultNamespace, src.Schema)
+	require.EqualValues(t, defaultShardSize, src.ShardSize)
+
+	src = &Source{Schema: "raw"}
+	src.WithDefaults()
+	require.Equal(t, "raw", src.Schema)
+}
@@ -0,0 +1,186 @@
+package iceberg
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/table"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+	"github.com/transferia/transferia/pkg/abstract"
+)
+
+// swapStagingTable commits loaded files to the staging table of item and swaps it in place of the target.
+//
+// Files the staging table already has are not committed again, so a retry after a failure between
+// the staging commit and the swap does not duplicate rows. A missing target is created with the columns
+// of the load first, so the swap goes to the branch like for an existing one. A target with the same
+// columns gets a single overwrite snapshot with the staging files, so readers switch from the old
+// data to the new one at once and the target keeps its identity and history. When columns differ
+// the same commit also makes the staging schema current, so the table is never missing or half replaced.
+func (s *SinkSnapshot) swapStagingTable(ctx context.Context, item abstract.ChangeItem, files []string) (*table.Table, error) {
+	stagingIdent, targetIdent := s.stagingTableIdent(item), s.createTableIdent(item)
+	staging, err := s.catalog.LoadTable(ctx, stagingIdent, s.cfg.Properties)
+	if err != nil {
+		return nil, xerrors.Errorf("load staging table: %w", err)
+	}
+	alreadyStaged, err := liveDataFiles(ctx, staging)
+	if err != nil {
+		return nil, xerrors.Errorf("list staging files: %w", err)
+	}
+	committed := make(map[string]bool, len(alreadyStaged))
+	for _, file := range alreadyStaged {
+		committed[file] = true
+	}
+	pending := slices.DeleteFunc(slices.Clone(files), func(file string) bool {
+		return committed[file]
+	})
+	staging, err = newSnapshotUpdate(s.catalog, staging, s.cfg.SnapshotProps).appendFiles(pending).commit(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("commit staging table: %w", err)
+	}
+
+	target, err := s.ensureTable(ctx, targetIdent, item)
+	if err != nil {
+		return nil, xerrors.Errorf("ensure table: %w", err)
+	}
+	stagedFiles, err := liveDataFiles(ctx, staging)
+	if err != nil {
+		return nil, xerrors.Errorf("list staging files: %w", err)
+	}
+	if sameColumns(target.Schema(), staging.Schema()) {
+		target, err = newSnapshotUpdate(s.catalog, target, s.cfg.SnapshotProps).
+			toBranch(s.refs.Branch).
+			appendFiles(stagedFiles).
+			overwriteAll().
+			commit(ctx)
+	} else {
+		s.logger.Warnf("columns of %v changed, replacing its schema with the one of %v", targetIdent, stagingIdent)
+		target, err = s.replaceSchemaAndData(ctx, target, staging.Schema(), stagedFiles)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("replace table data: %w", err)
+	}
+	// files now belong to the target, the staging table must not be purged
+	if err := s.catalog.DropTable(ctx, stagingIdent); err != nil {
+		return nil, xerrors.Errorf("drop staging table: %w", err)
+	}
+	return target, nil
+}
+
+// replaceSchemaAndData commits the schema change and the overwrite snapshot of files to target at once.
+func (s *SinkSnapshot) replaceSchemaAndData(ctx context.Context, target *table.Table, schema *iceberg.Schema, files []string) (*table.Table, error) {
+	schema, lastColumnID, err := replacementSchema(target.Metadata(), schema)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := json.Marshal(schema.NameMapping())
+	if err != nil {
+		return nil, xerrors.Errorf("marshal name mapping: %w", err)
+	}
+	schemaUpdates := []table.Update{
+		table.NewAddSchemaUpdate(schema, lastColumnID, false),
+		table.NewSetCurrentSchemaUpdate(schema.ID),
+		table.NewSetPropertiesUpdate(iceberg.Properties{table.DefaultNameMappingKey: string(mapping)}),
+	}
+
+	// the snapshot is staged against the target as it will be after the schema change
+	builder, err := table.MetadataBuilderFromBase(target.Metadata())
+	if err != nil {
+		return nil, xerrors.Errorf("read table metadata: %w", err)
+	}
+	for _, update := range schemaUpdates {
+		if err := update.Apply(builder); err != nil {
+			return nil, xerrors.Errorf("apply schema change: %w", err)
+		}
+	}
+	meta, err := builder.Build()
+	if err != nil {
+		return nil, xerrors.Errorf("apply schema change: %w", err)
+	}
+	view := table.New(target.Identifier(), meta, target.MetadataLocation(), target.FS(), s.catalog)
+	change, err := newSnapshotUpdate(s.catalog, view, s.cfg.SnapshotProps).
+		toBranch(s.refs.Branch).
+		appendFiles(files).
+		overwriteAll().
+		stage()
+	if err != nil {
+		return nil, err
+	}
+	if change == nil {
+		// nothing to replace, only the schema changes
+		change = &tableChange{requirements: []table.Requirement{table.AssertTableUUID(meta.TableUUID())}}
+	}
+	change.tbl = target
+	change.requirements = append(change.requirements, table.AssertCurrentSchemaID(target.Schema().ID))
+	change.updates = append(schemaUpdates, change.updates...)
+	return change.commit(ctx, s.catalog)
+}
+
+// replacementSchema returns the schema with columns of schema to become current in meta and the new last column ID.
+// Top level columns with the name and type of a current column keep its field ID, others get fresh ones.
+func replacementSchema(meta table.Metadata, schema *iceberg.Schema) (*iceberg.Schema, int, error) {
+	current := meta.CurrentSchema()
+	lastColumnID := meta.LastColumnID()
+	nextID := func() int {
+		lastColumnID++
+		return lastColumnID
+	}
+	fields := make([]iceberg.NestedField, 0, len(schema.Fields()))
+	for _, field := range schema.Fields() {
+		if old, ok := current.FindFieldByName(field.Name); ok && field.Type.Equals(old.Type) {
+			if _, primitive := field.Type.(iceberg.PrimitiveType); primitive {
+				field.ID = old.ID
+				fields = append(fields, field)
+				continue
+			}
+		}
+		fresh, err := iceberg.AssignFreshSchemaIDs(iceberg.NewSchema(0, field), nextID)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("assign field IDs of %s: %w", field.Name, err)
+		}
+		fields = append(fields, fresh.Field(0))
+	}
+
+	schemaID := 0
+	for _, sc := range meta.Schemas() {
+		schemaID = max(schemaID, sc.ID+1)
+	}
+	var identifierIDs []int
+	for _, id := range schema.IdentifierFieldIDs {
+		name, _ := schema.FindColumnName(id)
+		idx := slices.IndexFunc(fields, func(f iceberg.NestedField) bool { return f.Name == name })
+		if idx < 0 {
+			return nil, 0, xerrors.Errorf("identifier field %d is not a top level column", id)
+		}
+		identifierIDs = append(identifierIDs, fields[idx].ID)
+	}
+	result := iceberg.NewSchemaWithIdentifiers(schemaID, identifierIDs, fields...)
+	return result, lastColumnID, nil
+}
+
+// sameColumns reports whether schemas have the same top level columns, field IDs aside.
+// Data files are written without field IDs, so they are readable by either schema.
+func sameColumns(a, b *iceberg.Schema) bool {
+	return slices.EqualFunc(a.Fields(), b.Fields(), func(x, y iceberg.NestedField) bool {
+		return x.Name == y.Name && x.Type.Equals(y.Type) && x.Required == y.Required
+	})
+}
+
+// liveDataFiles lists data files of the current snapshot.
+func liveDataFiles(ctx context.Context, tbl *table.Table) ([]string, error) {
+	if tbl.CurrentSnapshot() == nil {
+		return nil, nil
+	}
+	tasks, err := tbl.Scan().PlanFiles(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to plan files to read: %w", err)
+	}
+	files := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		files = append(files, task.File.FilePath())
+	}
+	return files, nil
+}
@@ -0,0 +1,188 @@
+package iceberg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+
+	"github.com/transferia/iceberg/logger"
+	"github.com/transferia/transferia/library/go/core/metrics/solomon"
+	"github.com/transferia/transferia/pkg/abstract"
+	"github.com/transferia/transferia/pkg/abstract/coordinator"
+	"github.com/transferia/transferia/pkg/abstract/model"
+)
+
+func TestSameColumns(t *testing.T) {
+	id := iceberg.NestedField{ID: 1, Name: "id", Type: iceberg.PrimitiveTypes.Int64, Required: true}
+	name := iceberg.NestedField{ID: 2, Name: "name", Type: iceberg.PrimitiveTypes.String}
+	for _, tc := range []struct {
+		name     string
+		a, b     []iceberg.NestedField
+		expected bool
+	}{
+		{name: "equal", a: []iceberg.NestedField{id, name}, b: []iceberg.NestedField{id, name}, expected: true},
+		{name: "other field IDs", a: []iceberg.NestedField{id, name}, b: []iceberg.NestedField{{ID: 5, Name: "id", Type: iceberg.PrimitiveTypes.Int64, Required: true}, {ID: 7, Name: "name", Type: iceberg.PrimitiveTypes.String}}, expected: true},
+		{name: "other order", a: []iceberg.NestedField{id, name}, b: []iceberg.NestedField{name, id}},
+		{name: "added column", a: []iceberg.NestedField{id}, b: []iceberg.NestedField{id, name}},
+		{name: "renamed column", a: []iceberg.NestedField{id, name}, b: []iceberg.NestedField{id, {ID: 2, Name: "title", Type: iceberg.PrimitiveTypes.String}}},
+		{name: "other type", a: []iceberg.NestedField{id, name}, b: []iceberg.NestedField{id, {ID: 2, Name: "name", Type: iceberg.PrimitiveTypes.Binary}}},
+		{name: "other nullability", a: []iceberg.NestedField{id, name}, b: []iceberg.NestedField{{ID: 1, Name: "id", Type: iceberg.PrimitiveTypes.Int64}, name}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, sameColumns(iceberg.NewSchema(0, tc.a...), iceberg.NewSchema(0, tc.b...)))
+		})
+	}
+}
+
+// loadStaged loads rows with columns to public.users through a staging table.
+func loadStaged(t *testing.T, dst *Destination, columns []abstract.ColSchema, rows ...[]any) {
+	sink, err := NewSinkSnapshot(dst, coordinator.NewStatefulFakeClient(), &model.Transfer{ID: "local"}, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	tableSchema := abstract.NewTableSchema(columns)
+	control := func(kind abstract.Kind) abstract.ChangeItem {
+		return abstract.ChangeItem{Kind: kind, Schema: "public", Table: "users", PartID: "p1", TableSchema: tableSchema}
+	}
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.InitShardedTableLoad), control(abstract.InitTableLoad)}))
+	var items []abstract.ChangeItem
+	for _, row := range rows {
+		items = append(items, abstract.ChangeItem{
+			Kind:         abstract.InsertKind,
+			Schema:       "public",
+			Table:        "users",
+			PartID:       "p1",
+			TableSchema:  tableSchema,
+			ColumnNames:  tableSchema.ColumnNames(),
+			ColumnValues: row,
+		})
+	}
+	require.NoError(t, sink.Push(items))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.DoneTableLoad), control(abstract.DoneShardedTableLoad)}))
+}
+
+func TestSwapStagingTable(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	dst.StagedLoad = true
+	users := []abstract.ColSchema{
+		{ColumnName: "id", DataType: "INT64", Required: true, PrimaryKey: true},
+		{ColumnName: "name", DataType: "STRING"},
+	}
+	stagingDropped := func(t *testing.T, cat catalog.Catalog) {
+		_, err := cat.LoadTable(ctx, table.Identifier{"public", "users__tmp_local"}, dst.Properties)
+		require.ErrorIs(t, err, catalog.ErrNoSuchTable)
+	}
+	rowCount := func(t *testing.T, expected uint64) {
+		rows, err := DestinationRowCount(dst, "public", "users")
+		require.NoError(t, err)
+		require.Equal(t, expected, rows)
+	}
+
+	// a missing target is created and overwritten with the staging files
+	loadStaged(t, dst, users, []any{int64(1), "a"}, []any{int64(2), "b"})
+	cat, first := usersTable(t, dst)
+	stagingDropped(t, cat)
+	rowCount(t, 2)
+
+	// the same columns are overwritten in place
+	loadStaged(t, dst, users, []any{int64(3), "c"})
+	_, second := usersTable(t, dst)
+	stagingDropped(t, cat)
+	rowCount(t, 1)
+	require.Equal(t, first.Metadata().TableUUID(), second.Metadata().TableUUID())
+	require.Len(t, second.Metadata().Snapshots(), len(first.Metadata().Snapshots())+1)
+	require.Equal(t, first.Schema().ID, second.Schema().ID)
+
+	// changed columns are swapped in with the data by a single commit
+	changed := []abstract.ColSchema{users[0], {ColumnName: "email", DataType: "STRING"}}
+	loadStaged(t, dst, changed, []any{int64(4), "d@example.com"}, []any{int64(5), "e@example.com"}, []any{int64(6), nil})
+	_, third := usersTable(t, dst)
+	stagingDropped(t, cat)
+	rowCount(t, 3)
+	require.Equal(t, first.Metadata().TableUUID(), third.Metadata().TableUUID())
+	require.Len(t, third.Metadata().Snapshots(), len(second.Metadata().Snapshots())+1)
+	require.NotEqual(t, second.Schema().ID, third.Schema().ID)
+	require.Equal(t, third.Schema().ID, *third.CurrentSnapshot().SchemaID)
+
+	// the unchanged column keeps its field ID, the new one gets a fresh ID
+	id, _ := third.Schema().FindFieldByName("id")
+	oldID, _ := second.Schema().FindFieldByName("id")
+	require.Equal(t, oldID.ID, id.ID)
+	require.Equal(t, []int{id.ID}, third.Schema().IdentifierFieldIDs)
+	email, _ := third.Schema().FindFieldByName("email")
+	require.Greater(t, email.ID, second.Metadata().LastColumnID())
+	require.Equal(t, email.ID, third.Metadata().LastColumnID())
+	_, ok := third.Schema().FindFieldByName("name")
+	require.False(t, ok)
+
+	storage, err := NewStorage(localSource(dst), logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer storage.Close()
+	rows := loadRows(t, storage, abstract.TableDescription{Schema: "public", Name: "users"})
+	require.Len(t, rows, 3)
+	require.Equal(t, []string{"id", "email"}, rows[0].ColumnNames)
+}
+
+func TestSwapStagingTableBranch(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	dst.StagedLoad = true
+	dst.Branch = "audit"
+	users := []abstract.ColSchema{{ColumnName: "id", DataType: "INT64", Required: true, PrimaryKey: true}}
+
+	// a new table is loaded to the branch too, main stays empty until it is published
+	loadStaged(t, dst, users, []any{int64(1)}, []any{int64(2)})
+	_, tbl := usersTable(t, dst)
+	require.Nil(t, tbl.CurrentSnapshot())
+	rows, err := snapshotRowCount(ctx, tbl, branchHead(tbl.Metadata(), "audit").SnapshotID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), rows)
+
+	dst.Publish = PublishConfig{Enabled: true}
+	loadStaged(t, dst, users, []any{int64(3)})
+	rows, err = DestinationRowCount(dst, "public", "users")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), rows)
+}
+
+func TestSwapStagingTableRetry(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	dst.StagedLoad = true
+	cp := coordinator.NewStatefulFakeClient()
+	sink, err := NewSinkSnapshot(dst, cp, &model.Transfer{ID: "local"}, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	tableSchema := abstract.NewTableSchema([]abstract.ColSchema{{ColumnName: "id", DataType: "INT64", Required: true, PrimaryKey: true}})
+	control := func(kind abstract.Kind) abstract.ChangeItem {
+		return abstract.ChangeItem{Kind: kind, Schema: "public", Table: "users", PartID: "p1", TableSchema: tableSchema}
+	}
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.InitShardedTableLoad), control(abstract.InitTableLoad)}))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{
+		{Kind: abstract.InsertKind, Schema: "public", Table: "users", PartID: "p1", TableSchema: tableSchema, ColumnNames: []string{"id"}, ColumnValues: []any{int64(1)}},
+		{Kind: abstract.InsertKind, Schema: "public", Table: "users", PartID: "p1", TableSchema: tableSchema, ColumnNames: []string{"id"}, ColumnValues: []any{int64(2)}},
+	}))
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.DoneTableLoad)}))
+
+	// an earlier attempt committed the files to the staging table and failed before the swap
+	done := control(abstract.DoneShardedTableLoad)
+	state, err := cp.GetTransferState("local")
+	require.NoError(t, err)
+	loaded, _, err := loadedParts(state, done.TableID())
+	require.NoError(t, err)
+	staging, err := sink.catalog.LoadTable(ctx, sink.stagingTableIdent(done), dst.Properties)
+	require.NoError(t, err)
+	_, err = newSnapshotUpdate(sink.catalog, staging, nil).appendFiles(loaded.Files).commit(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Push([]abstract.ChangeItem{done}))
+	rows, err := DestinationRowCount(dst, "public", "users")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), rows)
+}
@@ -2,10 +2,9 @@ package iceberg
 
 import (
 	"context"
+	"slices"
 	"strings"
 
-	"github.com/apache/iceberg-go/catalog/glue"
-	"github.com/apache/iceberg-go/catalog/rest"
 	"github.com/transferia/transferia/pkg/abstract/changeitem"
 
 	"github.com/apache/iceberg-go/catalog"
@@ -15,7 +14,9 @@ import (
 	"github.com/transferia/transferia/library/go/core/metrics"
 	"github.com/transferia/transferia/library/go/core/xerrors"
 	"github.com/transferia/transferia/pkg/abstract"
+	"github.com/transferia/transferia/pkg/abstract/coordinator"
 	"github.com/transferia/transferia/pkg/abstract/typesystem"
+	"github.com/transferia/transferia/pkg/transformer/registry/filter"
 	"go.ytsaurus.tech/library/go/core/log"
 	yt_schema "go.ytsaurus.tech/yt/go/schema"
 )
@@ -30,14 +31,18 @@ var (
 const defaultReadBatchSize = 10 * 1024
 
 type Storage struct {
-	cfg      *Source
-	logger   log.Logger
-	registry metrics.Registry
-	props    iceberg.Properties
-	cat      catalog.Catalog
+	cfg           *Source
+	logger        log.Logger
+	registry      metrics.Registry
+	props         iceberg.Properties
+	cat           catalog.Catalog
+	columnFilters []*filter.FilterColumnsTransformer
+	cp            coordinator.Coordinator // keeps the data files of parts made by ShardTable, filters list them inline when nil
+	transferID    string
 }
 
 func (s *Storage) Close() {
+	closeCatalog(s.cat)
 }
 
 func (s *Storage) Ping() error {
@@ -50,58 +55,107 @@ func (s *Storage) LoadTable(ctx context.Context, tid abstract.TableDescription,
 	if err != nil {
 		return xerrors.Errorf("unable to load table: %v: %w", tbl, err)
 	}
-	_, arrowReadeer, err := itable.Scan().ToArrowRecords(ctx)
+	where, err := newRowFilter(tid.Filter, itable.Schema())
 	if err != nil {
-		return xerrors.Errorf("unable to read arrow table: %v: %w", tbl, err)
+		return xerrors.Errorf("unable to apply filter to %v: %w", tbl, err)
+	}
+	snapshot, err := s.readSnapshot(itable, where)
+	if err != nil {
+		return xerrors.Errorf("unable to read %v: %w", tbl, err)
+	}
+	schema := s.schema(itable.Metadata(), snapshot)
+	if schema.ID != itable.Schema().ID {
+		// iceberg-go evaluates the scan filter with the current schema, so only columns of both schemas are pushed down
+		if where, err = newRowFilter(tid.Filter, schema, itable.Schema()); err != nil {
+			return xerrors.Errorf("unable to apply filter to %v: %w", tbl, err)
+		}
+	}
+	if err := s.resolveShard(tid.ID(), where.shard); err != nil {
+		return xerrors.Errorf("unable to read %v: %w", tbl, err)
+	}
+	tSchema := s.FromIcebergSchema(schema)
+	var scanOpts []table.ScanOption
+	if where.scan != nil {
+		scanOpts = append(scanOpts, table.WithRowFilter(where.scan))
+	}
+	for _, name := range where.columns() {
+		if _, ok := schema.FindFieldByName(name); !ok {
+			return xerrors.Errorf("filter of %v references unknown column %q", tbl, name)
+		}
+	}
+	if columns := s.projection(tid.ID(), tSchema, where.columns()); columns != nil {
+		tSchema = abstract.NewTableSchema(columns)
+		scanOpts = append(scanOpts, table.WithSelectedFields(tSchema.ColumnNames()...))
+	}
+	scans, err := s.scans(itable, where, snapshot, schema, scanOpts)
+	if err != nil {
+		return xerrors.Errorf("unable to read %v: %w", tbl, err)
 	}
 
 	batch := make([]abstract.ChangeItem, 0, defaultReadBatchSize)
-	tSchema, err := s.TableSchema(ctx, tid.ID())
-	if err != nil {
-		return xerrors.Errorf("unable to resolve schema: %w", err)
+	columnNames := tSchema.ColumnNames()
+	columnIndex := make(map[string]int, len(columnNames))
+	for j, name := range columnNames {
+		columnIndex[name] = j
 	}
-	for page, err := range arrowReadeer {
+	for _, scan := range scans {
+		snapshot := scan.Snapshot()
+		_, arrowReadeer, err := scan.ToArrowRecords(ctx)
 		if err != nil {
-			return xerrors.Errorf("unable to read record: %w", err)
+			return xerrors.Errorf("unable to read arrow table: %v: %w", tbl, err)
 		}
-		for i := range page.NumRows() {
-			if len(batch) == defaultReadBatchSize {
-				if err := pusher(batch); err != nil {
-					return xerrors.Errorf("unable to push batch: %w", err)
-				}
-				batch = make([]abstract.ChangeItem, 0, defaultReadBatchSize)
-			}
-			evenSize := changeitem.EventSize{
-				Read:   0,
-				Values: 0,
-			}
-			row := abstract.ChangeItem{
-				ID:           uint32(itable.CurrentSnapshot().SnapshotID),
-				LSN:          uint64(i),
-				CommitTime:   uint64(itable.CurrentSnapshot().TimestampMs) * uint64(1000000),
-				Counter:      int(i),
-				Kind:         abstract.InsertKind,
-				Schema:       tid.Schema,
-				Table:        tid.Name,
-				PartID:       "",
-				ColumnNames:  tSchema.ColumnNames(),
-				ColumnValues: make([]interface{}, len(tSchema.ColumnNames())),
-				TableSchema:  tSchema,
-				OldKeys:      changeitem.OldKeysType{},
-				TxID:         "",
-				Query:        "",
-				Size:         evenSize,
+		for page, err := range arrowReadeer {
+			if err != nil {
+				return xerrors.Errorf("unable to read record: %w", err)
 			}
-			for j := range page.NumCols() {
-				if page.Column(int(j)).IsNull(int(i)) {
+			for i := range page.NumRows() {
+				if !where.match(func(name string) any {
+					col := page.Column(columnIndex[name])
+					if col.IsNull(int(i)) {
+						return nil
+					}
+					return col.GetOneForMarshal(int(i))
+				}) {
 					continue
 				}
-				row.ColumnValues[j] = abstract.Restore(
-					tSchema.Columns()[int(j)],
-					page.Column(int(j)).GetOneForMarshal(int(i)),
-				)
+				if len(batch) == defaultReadBatchSize {
+					if err := pusher(batch); err != nil {
+						return xerrors.Errorf("unable to push batch: %w", err)
+					}
+					batch = make([]abstract.ChangeItem, 0, defaultReadBatchSize)
+				}
+				evenSize := changeitem.EventSize{
+					Read:   0,
+					Values: 0,
+				}
+				row := abstract.ChangeItem{
+					ID:           uint32(snapshot.SnapshotID),
+					LSN:          uint64(i),
+					CommitTime:   uint64(snapshot.TimestampMs) * uint64(1000000),
+					Counter:      int(i),
+					Kind:         abstract.InsertKind,
+					Schema:       tid.Schema,
+					Table:        tid.Name,
+					PartID:       tid.PartID(),
+					ColumnNames:  columnNames,
+					ColumnValues: make([]interface{}, len(columnNames)),
+					TableSchema:  tSchema,
+					OldKeys:      changeitem.OldKeysType{},
+					TxID:         "",
+					Query:        "",
+					Size:         evenSize,
+				}
+				for j := range page.NumCols() {
+					if page.Column(int(j)).IsNull(int(i)) {
+						continue
+					}
+					row.ColumnValues[j] = abstract.Restore(
+						tSchema.Columns()[int(j)],
+						page.Column(int(j)).GetOneForMarshal(int(i)),
+					)
+				}
+				batch = append(batch, row)
 			}
-			batch = append(batch, row)
 		}
 	}
 	if len(batch) > 0 {
@@ -112,13 +166,45 @@ func (s *Storage) LoadTable(ctx context.Context, tid abstract.TableDescription,
 	return nil
 }
 
+// scans read the data of the table the filter selects as of snapshot: a part made by ShardTable,
+// the append snapshots of an increment or the whole table.
+func (s *Storage) scans(itable *table.Table, where *rowFilter, snapshot *table.Snapshot, schema *iceberg.Schema, opts []table.ScanOption) ([]*table.Scan, error) {
+	var shards []*tableShard
+	switch {
+	case where.shard != nil:
+		shards = []*tableShard{where.shard}
+	case where.increment != nil && where.increment.after != nil:
+		var err error
+		if shards, err = s.appendedFiles(itable, snapshot, *where.increment.after); err != nil {
+			return nil, err
+		}
+	case snapshot == nil:
+		return []*table.Scan{itable.Scan(opts...)}, nil
+	default:
+		return []*table.Scan{itable.Scan(append(slices.Clip(opts), table.WithSnapshotID(snapshot.SnapshotID))...)}, nil
+	}
+	scans := make([]*table.Scan, 0, len(shards))
+	for _, shard := range shards {
+		view, err := shardView(itable, shard, schema)
+		if err != nil {
+			return nil, err
+		}
+		scans = append(scans, view.Scan(append(slices.Clip(opts), table.WithSnapshotID(shard.snapshotID))...))
+	}
+	return scans, nil
+}
+
 func (s *Storage) TableSchema(ctx context.Context, tid abstract.TableID) (*abstract.TableSchema, error) {
 	tbl := table.Identifier{tid.Namespace, tid.Name}
 	itable, err := s.cat.LoadTable(ctx, tbl, s.props)
 	if err != nil {
 		return nil, xerrors.Errorf("unable to load table: %v: %w", tbl, err)
 	}
-	return s.FromIcebergSchema(itable.Schema()), nil
+	snapshot, err := s.snapshot(itable)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to read %v: %w", tbl, err)
+	}
+	return s.FromIcebergSchema(s.schema(itable.Metadata(), snapshot)), nil
 }
 
 func (s *Storage) TableList(filter abstract.IncludeTableList) (abstract.TableMap, error) {
@@ -136,18 +222,18 @@ func (s *Storage) TableList(filter abstract.IncludeTableList) (abstract.TableMap
 		if err != nil {
 			return nil, xerrors.Errorf("unable to load table: %v: %w", tbl, err)
 		}
-		files, err := itable.Scan().PlanFiles(context.TODO())
+		snapshot, err := s.snapshot(itable)
 		if err != nil {
-			return nil, xerrors.Errorf("unable to plan files to read: %w", err)
+			return nil, xerrors.Errorf("unable to read %v: %w", tbl, err)
 		}
-		totalCount := uint64(0)
-		for _, file := range files {
-			totalCount = totalCount + uint64(file.File.Count())
+		totalCount, err := rowsCount(context.TODO(), itable, snapshot)
+		if err != nil {
+			return nil, err
 		}
 		res[s.AsTableID(tbl)] = abstract.TableInfo{
 			EtaRow: totalCount,
 			IsView: false,
-			Schema: s.FromIcebergSchema(itable.Schema()),
+			Schema: s.FromIcebergSchema(s.schema(itable.Metadata(), snapshot)),
 		}
 	}
 
@@ -164,7 +250,19 @@ func (s *Storage) EstimateTableRowsCount(tid abstract.TableID) (uint64, error) {
 	if err != nil {
 		return 0, xerrors.Errorf("unable to load table: %v: %w", tbl, err)
 	}
-	files, err := itable.Scan().PlanFiles(context.TODO())
+	snapshot, err := s.snapshot(itable)
+	if err != nil {
+		return 0, xerrors.Errorf("unable to read %v: %w", tbl, err)
+	}
+	return rowsCount(context.TODO(), itable, snapshot)
+}
+
+// rowsCount is the record count of the data files of the table as of snapshot.
+func rowsCount(ctx context.Context, itable *table.Table, snapshot *table.Snapshot) (uint64, error) {
+	if snapshot == nil {
+		return 0, nil
+	}
+	files, err := itable.Scan(table.WithSnapshotID(snapshot.SnapshotID)).PlanFiles(ctx)
 	if err != nil {
 		return 0, xerrors.Errorf("unable to plan files to read: %w", err)
 	}
@@ -241,15 +339,9 @@ func trimSuffix(s string) string {
 }
 
 func NewStorage(src *Source, logger log.Logger, registry metrics.Registry) (*Storage, error) {
-	var cat catalog.Catalog
-	if src.CatalogType == "rest" {
-		var err error
-		cat, err = rest.NewCatalog(context.Background(), src.CatalogType, src.CatalogURI)
-		if err != nil {
-			return nil, xerrors.Errorf("unable to init catalog: %w", err)
-		}
-	} else if src.CatalogType == "glue" {
-		cat = glue.NewCatalog()
+	cat, err := newCatalog(context.Background(), src.CatalogType, src.CatalogURI, src.catalogProperties())
+	if err != nil {
+		return nil, xerrors.Errorf("unable to init catalog: %w", err)
 	}
 	return &Storage{
 		cfg:      src,
@@ -2,6 +2,11 @@ package iceberg
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,7 +16,12 @@ import (
 
 	"github.com/transferia/transferia/library/go/core/metrics/solomon"
 	"github.com/transferia/transferia/pkg/abstract"
+	"github.com/transferia/transferia/pkg/abstract/coordinator"
+	"github.com/transferia/transferia/pkg/abstract/model"
 	"github.com/transferia/transferia/pkg/format"
+	"github.com/transferia/transferia/pkg/transformer"
+	"github.com/transferia/transferia/pkg/transformer/registry/filter"
+	"github.com/transferia/transferia/pkg/transformer/registry/rename"
 	"github.com/transferia/transferia/pkg/util"
 )
 
@@ -55,3 +65,294 @@ func TestStorage(t *testing.T) {
 		})
 	}
 }
+
+// localSourceTable writes rows to the public.users table of a local warehouse and returns the source reading it.
+func localSourceTable(t *testing.T, files, rows int) (*Source, abstract.TableID) {
+	dst := localDestination(t)
+	writeUsers(t, dst, 0, files, rows)
+	return localSource(dst), abstract.TableID{Namespace: "public", Name: "users"}
+}
+
+func localDestination(t *testing.T) *Destination {
+	dst, err := LocalDestinationRecipe()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(strings.TrimPrefix(dst.Prefix, "file://")) })
+	dst.WithDefaults()
+	return dst
+}
+
+func localSource(dst *Destination) *Source {
+	return &Source{
+		Properties:  dst.Properties,
+		CatalogType: dst.CatalogType,
+		CatalogURI:  dst.CatalogURI,
+		Schema:      "public",
+	}
+}
+
+// writeUsers appends files of rows users with IDs from first to public.users in a snapshot of its own.
+func writeUsers(t *testing.T, dst *Destination, first, files, rows int) {
+	writeUsersWith(t, dst, coordinator.NewStatefulFakeClient(), first, files, rows)
+}
+
+// writeUsersWith loads users like writeUsers, keeping the state of the load in cp.
+func writeUsersWith(t *testing.T, dst *Destination, cp coordinator.Coordinator, first, files, rows int) {
+	sink, err := NewSinkSnapshot(dst, cp, &model.Transfer{ID: "local"}, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	tableSchema := abstract.NewTableSchema([]abstract.ColSchema{
+		{ColumnName: "id", DataType: "INT64", Required: true, PrimaryKey: true},
+		{ColumnName: "name", DataType: "STRING"},
+		{ColumnName: "score", DataType: "DOUBLE"},
+	})
+	control := func(kind abstract.Kind, part int) abstract.ChangeItem {
+		return abstract.ChangeItem{Kind: kind, Schema: "public", Table: "users", PartID: fmt.Sprintf("p%d", part), TableSchema: tableSchema}
+	}
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.InitShardedTableLoad, 0)}))
+	// every part of the load is written to a data file of its own
+	for part := range files {
+		require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.InitTableLoad, part)}))
+		var items []abstract.ChangeItem
+		for i := first + part*rows; i < first+(part+1)*rows; i++ {
+			items = append(items, abstract.ChangeItem{
+				Kind:         abstract.InsertKind,
+				Schema:       "public",
+				Table:        "users",
+				PartID:       fmt.Sprintf("p%d", part),
+				TableSchema:  tableSchema,
+				ColumnNames:  []string{"id", "name", "score"},
+				ColumnValues: []any{int64(i), fmt.Sprintf("user %d", i), float64(i) / 2},
+			})
+		}
+		require.NoError(t, sink.Push(items))
+		require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.DoneTableLoad, part)}))
+	}
+	require.NoError(t, sink.Push([]abstract.ChangeItem{control(abstract.DoneShardedTableLoad, 0)}))
+}
+
+// loadRows reads the table with storage and returns its rows.
+func loadRows(t *testing.T, storage abstract.Storage, desc abstract.TableDescription) []abstract.ChangeItem {
+	var rows []abstract.ChangeItem
+	require.NoError(t, storage.LoadTable(context.Background(), desc, func(items []abstract.ChangeItem) error {
+		rows = append(rows, items...)
+		return nil
+	}))
+	return rows
+}
+
+func TestStorageProjection(t *testing.T) {
+	src, tid := localSourceTable(t, 1, 3)
+	transfer := &model.Transfer{
+		Src: src,
+		Transformation: &model.Transformation{Transformers: &transformer.Transformers{Transformers: []transformer.Transformer{
+			{filter.FilterColumnsTransformerType: filter.FilterColumnsConfig{Columns: filter.Columns{ExcludeColumns: []string{"^score$"}}}},
+			// filters of other tables do not narrow the read
+			{filter.FilterColumnsTransformerType: filter.FilterColumnsConfig{
+				Tables:  filter.Tables{IncludeTables: []string{"public.orders"}},
+				Columns: filter.Columns{IncludeColumns: []string{"^id$"}},
+			}},
+		}}},
+	}
+	storage, err := New(logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()), coordinator.NewStatefulFakeClient(), transfer).(*Provider).Storage()
+	require.NoError(t, err)
+	defer storage.Close()
+
+	rows := loadRows(t, storage, abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name})
+	require.Len(t, rows, 3)
+	for _, row := range rows {
+		require.Equal(t, []string{"id", "name"}, row.ColumnNames)
+		require.Equal(t, []string{"id", "name"}, row.TableSchema.ColumnNames())
+		require.Equal(t, fmt.Sprintf("user %v", row.ColumnValues[0]), row.ColumnValues[1])
+	}
+
+	// without filters all columns are read
+	storage, err = NewStorage(src, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer storage.Close()
+	rows = loadRows(t, storage, abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name})
+	require.Equal(t, []string{"id", "name", "score"}, rows[0].ColumnNames)
+}
+
+func TestStorageProjectionAfterTransformer(t *testing.T) {
+	src, tid := localSourceTable(t, 1, 3)
+	exclude := func(column string) transformer.Transformer {
+		return transformer.Transformer{filter.FilterColumnsTransformerType: filter.FilterColumnsConfig{Columns: filter.Columns{ExcludeColumns: []string{column}}}}
+	}
+	transfer := &model.Transfer{
+		Src: src,
+		Transformation: &model.Transformation{Transformers: &transformer.Transformers{Transformers: []transformer.Transformer{
+			exclude("^score$"),
+			// the filter after the rename sees rows of the renamed table, it is left to the transformers
+			{rename.RenameTablesTransformerType: rename.Config{RenameTables: []rename.RenameTable{{
+				OriginalName: rename.Table{Namespace: "public", Name: "users"},
+				NewName:      rename.Table{Namespace: "public", Name: "customers"},
+			}}}},
+			exclude("^name$"),
+		}}},
+	}
+	storage, err := New(logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()), coordinator.NewStatefulFakeClient(), transfer).(*Provider).Storage()
+	require.NoError(t, err)
+	defer storage.Close()
+
+	rows := loadRows(t, storage, abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name})
+	require.Len(t, rows, 3)
+	require.Equal(t, []string{"id", "name"}, rows[0].ColumnNames)
+}
+
+func TestStorageFilter(t *testing.T) {
+	src, tid := localSourceTable(t, 1, 5)
+	transfer := &model.Transfer{
+		Src: src,
+		Transformation: &model.Transformation{Transformers: &transformer.Transformers{Transformers: []transformer.Transformer{
+			{filter.FilterColumnsTransformerType: filter.FilterColumnsConfig{Columns: filter.Columns{ExcludeColumns: []string{"^score$"}}}},
+		}}},
+	}
+	storage, err := New(logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()), coordinator.NewStatefulFakeClient(), transfer).(*Provider).Storage()
+	require.NoError(t, err)
+	defer storage.Close()
+
+	names := func(where abstract.WhereStatement) []any {
+		var result []any
+		for _, row := range loadRows(t, storage, abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name, Filter: where}) {
+			result = append(result, row.ColumnValues[1])
+		}
+		return result
+	}
+	require.Equal(t, []any{"user 1", "user 3"}, names(`id IN (1, 3, 7)`))
+	require.Equal(t, []any{"user 3", "user 4"}, names(`"score" > 1 AND name LIKE 'user%'`))
+	require.Empty(t, names(`name IS NULL`))
+
+	// score is read for the filter evaluated here, the transformer drops it afterwards
+	rows := loadRows(t, storage, abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name, Filter: `score < id AND name LIKE '%2'`})
+	require.Len(t, rows, 1)
+	require.Equal(t, []string{"id", "name", "score"}, rows[0].ColumnNames)
+	require.Equal(t, "user 2", rows[0].ColumnValues[1])
+
+	_, err = storage.(*Storage).TableSchema(context.Background(), tid)
+	require.NoError(t, err)
+	err = storage.LoadTable(context.Background(), abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name, Filter: `id < other`}, func([]abstract.ChangeItem) error { return nil })
+	require.ErrorContains(t, err, `unknown column "other"`)
+	err = storage.LoadTable(context.Background(), abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name, Filter: `id <`}, func([]abstract.ChangeItem) error { return nil })
+	require.ErrorContains(t, err, "unable to parse filter")
+}
+
+func TestStorageShardTable(t *testing.T) {
+	ctx := context.Background()
+	src, tid := localSourceTable(t, 4, 5)
+	src.ShardSize = 1
+	storage, err := NewStorage(src, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer storage.Close()
+	desc := abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name}
+
+	parts, err := storage.ShardTable(ctx, desc)
+	require.NoError(t, err)
+	require.Len(t, parts, 4)
+	ids := map[string]int{}
+	for _, part := range parts {
+		require.EqualValues(t, 5, part.EtaRow)
+		require.Contains(t, string(part.Filter), shardFilesColumn)
+		rows := loadRows(t, storage, part)
+		require.Len(t, rows, 5)
+		for _, row := range rows {
+			// rows of a part are matched with its control events by part ID
+			require.Equal(t, part.PartID(), row.PartID)
+			ids[fmt.Sprint(row.ColumnValues[0])]++
+		}
+	}
+	require.Len(t, ids, 20)
+	for id, count := range ids {
+		require.Equal(t, 1, count, id)
+	}
+
+	// parts are not sharded again
+	again, err := storage.ShardTable(ctx, parts[0])
+	require.NoError(t, err)
+	require.Equal(t, parts[:1], again)
+
+	// the filter of the table applies to its parts
+	parts, err = storage.ShardTable(ctx, abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name, Filter: `id >= 10 AND id != 12`})
+	require.NoError(t, err)
+	var rows []abstract.ChangeItem
+	for _, part := range parts {
+		rows = append(rows, loadRows(t, storage, part)...)
+	}
+	require.Len(t, rows, 9)
+
+	// a table smaller than a shard is read as a whole
+	storage.cfg.ShardSize = defaultShardSize
+	parts, err = storage.ShardTable(ctx, desc)
+	require.NoError(t, err)
+	require.Equal(t, []abstract.TableDescription{desc}, parts)
+
+	expired := desc
+	expired.Filter = (&tableShard{snapshotID: 1, files: []string{"file:///data.parquet"}}).where()
+	err = storage.LoadTable(ctx, expired, func([]abstract.ChangeItem) error { return nil })
+	require.ErrorContains(t, err, "snapshot 1 of the shard is not found")
+}
+
+func TestStorageShardTableCoordinator(t *testing.T) {
+	ctx := context.Background()
+	src, tid := localSourceTable(t, 4, 5)
+	src.ShardSize = 1
+	cp := coordinator.NewStatefulFakeClient()
+	newStorage := func() *Storage {
+		storage, err := NewStorage(src, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+		require.NoError(t, err)
+		storage.cp = cp
+		storage.transferID = "transfer"
+		t.Cleanup(storage.Close)
+		return storage
+	}
+	storage := newStorage()
+	desc := abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name, Filter: "id >= 0"}
+
+	parts, err := storage.ShardTable(ctx, desc)
+	require.NoError(t, err)
+	require.Len(t, parts, 4)
+	state, err := cp.GetTransferState("transfer")
+	require.NoError(t, err)
+	require.Len(t, state, 4)
+	ids := map[string]int{}
+	for _, part := range parts {
+		// the filter refers to the files kept in the coordinator instead of listing them
+		require.NotContains(t, string(part.Filter), shardFilesColumn)
+		require.Contains(t, string(part.Filter), shardIDColumn)
+		// workers read the parts with storages of their own
+		for _, row := range loadRows(t, newStorage(), part) {
+			ids[fmt.Sprint(row.ColumnValues[0])]++
+		}
+	}
+	require.Len(t, ids, 20)
+
+	// sharding the table again into larger parts drops the files of the former parts
+	var total int64
+	for _, data := range state {
+		for _, file := range data.Generic.([]string) {
+			info, err := os.Stat(strings.TrimPrefix(file, "file://"))
+			require.NoError(t, err)
+			total += info.Size()
+		}
+	}
+	storage.cfg.ShardSize = (total + 1) / 2
+	again, err := storage.ShardTable(ctx, desc)
+	require.NoError(t, err)
+	require.Len(t, again, 2)
+	state, err = cp.GetTransferState("transfer")
+	require.NoError(t, err)
+	require.Len(t, state, 2)
+	var dropped int
+	for _, part := range parts {
+		err := storage.LoadTable(ctx, part, func([]abstract.ChangeItem) error { return nil })
+		if err != nil {
+			require.ErrorContains(t, err, "are not found in the transfer state")
+			dropped++
+		}
+	}
+	require.Equal(t, 4, dropped)
+
+	require.NoError(t, cp.RemoveTransferState("transfer", slices.Collect(maps.Keys(state))))
+	err = storage.LoadTable(ctx, again[0], func([]abstract.ChangeItem) error { return nil })
+	require.ErrorContains(t, err, "files of shard")
+}
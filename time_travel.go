@@ -0,0 +1,80 @@
+package iceberg
+
+import (
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/table"
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+// snapshot is the snapshot of the table the source reads: the one of SnapshotID, AsOf or Ref,
+// the current one otherwise. It is nil only for tables without snapshots read as of the current one.
+func (s *Storage) snapshot(itable *table.Table) (*table.Snapshot, error) {
+	meta := itable.Metadata()
+	switch {
+	case s.cfg.SnapshotID != 0:
+		snapshot := meta.SnapshotByID(s.cfg.SnapshotID)
+		if snapshot == nil {
+			return nil, xerrors.Errorf("snapshot %d is not found, it might be expired", s.cfg.SnapshotID)
+		}
+		return snapshot, nil
+	case !s.cfg.AsOf.IsZero():
+		// the snapshot log has the snapshots that were current in order of time
+		asOf := s.cfg.AsOf.UnixMilli()
+		var snapshotID *int64
+		for entry := range meta.SnapshotLogs() {
+			if entry.TimestampMs <= asOf {
+				snapshotID = &entry.SnapshotID
+			}
+		}
+		if snapshotID == nil {
+			return nil, xerrors.Errorf("table has no snapshot as of %v", s.cfg.AsOf)
+		}
+		snapshot := meta.SnapshotByID(*snapshotID)
+		if snapshot == nil {
+			return nil, xerrors.Errorf("snapshot %d current as of %v is expired", *snapshotID, s.cfg.AsOf)
+		}
+		return snapshot, nil
+	case s.cfg.Ref != "":
+		snapshot := meta.SnapshotByName(s.cfg.Ref)
+		if snapshot == nil {
+			return nil, xerrors.Errorf("table has no branch or tag %q", s.cfg.Ref)
+		}
+		return snapshot, nil
+	}
+	return meta.CurrentSnapshot(), nil
+}
+
+// readSnapshot is the snapshot a load reads the table as of: the one of a part or the end of an increment
+// when the filter has them, the one of the source otherwise.
+func (s *Storage) readSnapshot(itable *table.Table, where *rowFilter) (*table.Snapshot, error) {
+	meta := itable.Metadata()
+	switch {
+	case where.shard != nil:
+		snapshot := meta.SnapshotByID(where.shard.snapshotID)
+		if snapshot == nil {
+			return nil, xerrors.Errorf("snapshot %d of the shard is not found, it might be expired", where.shard.snapshotID)
+		}
+		return snapshot, nil
+	case where.increment != nil && where.increment.upTo != nil:
+		snapshot := meta.SnapshotByID(*where.increment.upTo)
+		if snapshot == nil {
+			return nil, xerrors.Errorf("snapshot %d is not found, it might be expired", *where.increment.upTo)
+		}
+		return snapshot, nil
+	}
+	return s.snapshot(itable)
+}
+
+// schema is the schema of the table the source reads snapshot with: the one of the snapshot
+// when the table is read as of another one than the current, the current schema otherwise.
+func (s *Storage) schema(meta table.Metadata, snapshot *table.Snapshot) *iceberg.Schema {
+	timeTravel := s.cfg.SnapshotID != 0 || !s.cfg.AsOf.IsZero() || s.cfg.Ref != ""
+	if timeTravel && snapshot != nil && snapshot.SchemaID != nil {
+		for _, schema := range meta.Schemas() {
+			if schema.ID == *snapshot.SchemaID {
+				return schema
+			}
+		}
+	}
+	return meta.CurrentSchema()
+}
@@ -0,0 +1,112 @@
+package iceberg
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+	"github.com/transferia/iceberg/logger"
+	"github.com/transferia/transferia/library/go/core/metrics/solomon"
+	"github.com/transferia/transferia/pkg/abstract"
+)
+
+func TestStorageTimeTravel(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	writeUsers(t, dst, 0, 2, 2)
+	current, err := NewStorage(localSource(dst), logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer current.Close()
+	tid := abstract.TableID{Namespace: "public", Name: "users"}
+	ident := table.Identifier{"public", "users"}
+	itable, err := current.cat.LoadTable(ctx, ident, nil)
+	require.NoError(t, err)
+	first := itable.CurrentSnapshot()
+
+	// tag the first snapshot, then add a column and append rows
+	time.Sleep(10 * time.Millisecond)
+	asOf := time.Now()
+	schema := itable.Schema()
+	evolved := iceberg.NewSchemaWithIdentifiers(schema.ID+1, schema.IdentifierFieldIDs,
+		append(schema.Fields(), iceberg.NestedField{ID: schema.HighestFieldID() + 1, Name: "email", Type: iceberg.PrimitiveTypes.String})...)
+	_, _, err = current.cat.CommitTable(ctx, itable, nil, []table.Update{
+		table.NewSetSnapshotRefUpdate("v1", first.SnapshotID, table.TagRef, -1, -1, -1),
+		table.NewAddSchemaUpdate(evolved, evolved.HighestFieldID(), false),
+		table.NewSetCurrentSchemaUpdate(-1),
+	})
+	require.NoError(t, err)
+	writeUsers(t, dst, 4, 1, 2)
+
+	ids := func(storage *Storage, desc abstract.TableDescription) []string {
+		var result []string
+		for _, row := range loadRows(t, storage, desc) {
+			result = append(result, fmt.Sprint(row.ColumnValues[0]))
+		}
+		return result
+	}
+	desc := abstract.TableDescription{Schema: tid.Namespace, Name: tid.Name}
+	require.Len(t, ids(current, desc), 6)
+	tableSchema, err := current.TableSchema(ctx, tid)
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "name", "score", "email"}, tableSchema.ColumnNames())
+
+	for name, src := range map[string]func(*Source){
+		"snapshot": func(src *Source) { src.SnapshotID = first.SnapshotID },
+		"as of":    func(src *Source) { src.AsOf = asOf },
+		"tag":      func(src *Source) { src.Ref = "v1" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := localSource(dst)
+			src(cfg)
+			require.NoError(t, cfg.Validate())
+			storage, err := NewStorage(cfg, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+			require.NoError(t, err)
+			defer storage.Close()
+
+			rows := loadRows(t, storage, desc)
+			require.Len(t, rows, 4)
+			require.EqualValues(t, uint32(first.SnapshotID), rows[0].ID)
+			require.Equal(t, []string{"id", "name", "score"}, rows[0].ColumnNames)
+			tableSchema, err := storage.TableSchema(ctx, tid)
+			require.NoError(t, err)
+			require.Equal(t, []string{"id", "name", "score"}, tableSchema.ColumnNames())
+			count, err := storage.EstimateTableRowsCount(tid)
+			require.NoError(t, err)
+			require.EqualValues(t, 4, count)
+			tables, err := storage.TableList(nil)
+			require.NoError(t, err)
+			require.EqualValues(t, 4, tables[tid].EtaRow)
+
+			// parts and increments are read as of the snapshot too
+			storage.cfg.ShardSize = 1
+			parts, err := storage.ShardTable(ctx, desc)
+			require.NoError(t, err)
+			require.Len(t, parts, 2)
+			var partIDs []string
+			for _, part := range parts {
+				partIDs = append(partIDs, ids(storage, part)...)
+			}
+			require.ElementsMatch(t, []string{"0", "1", "2", "3"}, partIDs)
+			next, err := storage.GetIncrementalState(ctx, []abstract.IncrementalTable{{Namespace: tid.Namespace, Name: tid.Name}})
+			require.NoError(t, err)
+			require.Equal(t, incrementWhere(first.SnapshotID), next[0].Filter)
+		})
+	}
+
+	missing := localSource(dst)
+	missing.Ref = "v2"
+	storage, err := NewStorage(missing, logger.Log, solomon.NewRegistry(solomon.NewRegistryOpts()))
+	require.NoError(t, err)
+	defer storage.Close()
+	_, err = storage.TableSchema(ctx, tid)
+	require.ErrorContains(t, err, `no branch or tag "v2"`)
+
+	missing = localSource(dst)
+	missing.AsOf = time.Unix(0, 0)
+	missing.SnapshotID = first.SnapshotID
+	require.ErrorContains(t, missing.Validate(), "only one of")
+}
@@ -0,0 +1,180 @@
+package iceberg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	"github.com/apache/iceberg-go/table"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+const transactionsEndpoint = "POST /v1/{prefix}/transactions/commit"
+
+var (
+	// errTransactionsUnsupported is returned when the catalog has no multi-table commit endpoint.
+	errTransactionsUnsupported = xerrors.New("catalog does not support multi-table transactions")
+	// errCommitStateUnknown is returned when the catalog may have applied a transaction without confirming it.
+	errCommitStateUnknown = xerrors.New("transaction commit state unknown")
+)
+
+// restTransactions commits changes of several tables atomically through
+// the transactions endpoint of the REST catalog.
+type restTransactions struct {
+	*restClient
+}
+
+type restIdentifier struct {
+	Namespace []string `json:"namespace"`
+	Name      string   `json:"name"`
+}
+
+type restTableChange struct {
+	Identifier   restIdentifier      `json:"identifier"`
+	Requirements []table.Requirement `json:"requirements"`
+	Updates      []table.Update      `json:"updates"`
+}
+
+type restErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    int    `json:"code"`
+	} `json:"error"`
+}
+
+// newRESTTransactions resolves the catalog prefix and supported endpoints from the catalog config.
+func newRESTTransactions(ctx context.Context, uri string, props iceberg.Properties) (*restTransactions, error) {
+	client, err := newRESTClient(ctx, uri, props)
+	if err != nil {
+		return nil, err
+	}
+	// catalogs listing their endpoints tell upfront whether transactions are supported
+	if client.endpoints != nil && !slices.Contains(client.endpoints, transactionsEndpoint) {
+		return nil, errTransactionsUnsupported
+	}
+	return &restTransactions{restClient: client}, nil
+}
+
+// commit sends all changes in a single request, the catalog applies all of them or none.
+func (t *restTransactions) commit(ctx context.Context, changes []*tableChange) error {
+	payload := struct {
+		TableChanges []restTableChange `json:"table-changes"`
+	}{}
+	for _, change := range changes {
+		ident := change.tbl.Identifier()
+		payload.TableChanges = append(payload.TableChanges, restTableChange{
+			Identifier:   restIdentifier{Namespace: catalog.NamespaceFromIdent(ident), Name: catalog.TableNameFromIdent(ident)},
+			Requirements: change.requirements,
+			Updates:      change.updates,
+		})
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return xerrors.Errorf("marshal transaction: %w", err)
+	}
+
+	req, err := t.newRequest(ctx, http.MethodPost, t.baseURI.JoinPath("transactions", "commit"), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	rsp, err := t.client.Do(req)
+	if err != nil {
+		// the request may have reached the catalog before the connection failed
+		return xerrors.Errorf("commit transaction: %w: %v", errCommitStateUnknown, err)
+	}
+	defer rsp.Body.Close()
+	switch {
+	case rsp.StatusCode == http.StatusOK || rsp.StatusCode == http.StatusNoContent:
+		return nil
+	case rsp.StatusCode == http.StatusMethodNotAllowed || rsp.StatusCode == http.StatusNotImplemented:
+		return errTransactionsUnsupported
+	case rsp.StatusCode >= http.StatusInternalServerError:
+		return xerrors.Errorf("commit transaction: %w: %v", errCommitStateUnknown, restError(rsp))
+	default:
+		return restError(rsp)
+	}
+}
+
+// restError decodes the catalog error response.
+func restError(rsp *http.Response) error {
+	var e restErrorResponse
+	_ = json.NewDecoder(rsp.Body).Decode(&e)
+	if e.Error.Type == "" {
+		return xerrors.Errorf("catalog responded with %s", rsp.Status)
+	}
+	return xerrors.Errorf("catalog responded with %s: %s: %s", rsp.Status, e.Error.Type, e.Error.Message)
+}
+
+// commitChanges applies changes of several tables, atomically if txs is set and the
+// catalog supports it, otherwise one table at a time. It returns reloaded tables
+// in the order of changes and the number of changes applied, the first ones, even on error.
+func commitChanges(ctx context.Context, cat catalog.Catalog, txs *restTransactions, changes []*tableChange, props iceberg.Properties) ([]*table.Table, int, error) {
+	if txs != nil {
+		err := txs.commit(ctx, changes)
+		switch {
+		case err == nil:
+			tables, err := reloadTables(ctx, cat, changes, props)
+			if err != nil {
+				return nil, len(changes), err
+			}
+			return tables, len(changes), nil
+		case errors.Is(err, errCommitStateUnknown):
+			// the staged snapshots are in the tables if the catalog applied the transaction
+			tables, reloadErr := reloadTables(ctx, cat, changes, props)
+			if reloadErr != nil {
+				return nil, 0, xerrors.Errorf("commit %d tables: %w, reload: %v", len(changes), err, reloadErr)
+			}
+			if !applied(tables, changes) {
+				return nil, 0, xerrors.Errorf("commit %d tables: %w", len(changes), err)
+			}
+			return tables, len(changes), nil
+		case !errors.Is(err, errTransactionsUnsupported):
+			return nil, 0, xerrors.Errorf("commit %d tables: %w", len(changes), err)
+		}
+	}
+
+	tables := make([]*table.Table, 0, len(changes))
+	for _, change := range changes {
+		tbl, err := change.commit(ctx, cat)
+		if err != nil {
+			return tables, len(tables), xerrors.Errorf("%d of %d tables committed: %w", len(tables), len(changes), err)
+		}
+		tables = append(tables, tbl)
+	}
+	return tables, len(tables), nil
+}
+
+func reloadTables(ctx context.Context, cat catalog.Catalog, changes []*tableChange, props iceberg.Properties) ([]*table.Table, error) {
+	tables := make([]*table.Table, 0, len(changes))
+	for _, change := range changes {
+		tbl, err := cat.LoadTable(ctx, change.tbl.Identifier(), props)
+		if err != nil {
+			return nil, xerrors.Errorf("reload table %v: %w", change.tbl.Identifier(), err)
+		}
+		tables = append(tables, tbl)
+	}
+	return tables, nil
+}
+
+// applied tells whether the snapshots staged by changes are in the reloaded tables,
+// false when the changes add no snapshot to tell it by.
+func applied(tables []*table.Table, changes []*tableChange) bool {
+	found := false
+	for i, change := range changes {
+		if change.snapshotID == 0 {
+			continue
+		}
+		if tables[i].Metadata().SnapshotByID(change.snapshotID) == nil {
+			return false
+		}
+		found = true
+	}
+	return found
+}
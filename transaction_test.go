@@ -0,0 +1,161 @@
+package iceberg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRESTTransactions(t *testing.T) {
+	schema := iceberg.NewSchema(0, iceberg.NestedField{ID: 1, Name: "id", Type: iceberg.PrimitiveTypes.Int64, Required: true})
+	meta, err := table.NewMetadata(schema, iceberg.UnpartitionedSpec, table.UnsortedSortOrder, "file:///tmp/tbl", nil)
+	require.NoError(t, err)
+	changes := []*tableChange{{
+		tbl:          table.New(table.Identifier{"db", "tbl"}, meta, "", nil, nil),
+		requirements: []table.Requirement{table.AssertTableUUID(meta.TableUUID())},
+		updates:      []table.Update{table.NewSetPropertiesUpdate(iceberg.Properties{"k": "v"})},
+	}}
+
+	t.Run("commit", func(t *testing.T) {
+		var body map[string][]map[string]any
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/config":
+				require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+				_, _ = w.Write([]byte(`{"defaults":{},"overrides":{"prefix":"wh"}}`))
+			case "/v1/wh/transactions/commit":
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer srv.Close()
+
+		txs, err := newRESTTransactions(context.Background(), srv.URL, iceberg.Properties{"token": "secret"})
+		require.NoError(t, err)
+		require.NoError(t, txs.commit(context.Background(), changes))
+		require.Len(t, body["table-changes"], 1)
+		require.Equal(t, map[string]any{"namespace": []any{"db"}, "name": "tbl"}, body["table-changes"][0]["identifier"])
+		require.Len(t, body["table-changes"][0]["requirements"], 1)
+		require.Len(t, body["table-changes"][0]["updates"], 1)
+	})
+
+	t.Run("endpoint not listed", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"defaults":{},"overrides":{},"endpoints":["POST /v1/{prefix}/namespaces/{namespace}/tables/{table}"]}`))
+		}))
+		defer srv.Close()
+
+		_, err := newRESTTransactions(context.Background(), srv.URL, nil)
+		require.ErrorIs(t, err, errTransactionsUnsupported)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		status, response := http.StatusNotFound, ``
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/config" {
+				_, _ = w.Write([]byte(`{}`))
+				return
+			}
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(response))
+		}))
+		defer srv.Close()
+
+		txs, err := newRESTTransactions(context.Background(), srv.URL, nil)
+		require.NoError(t, err)
+		for _, status = range []int{http.StatusMethodNotAllowed, http.StatusNotImplemented} {
+			require.ErrorIs(t, txs.commit(context.Background(), changes), errTransactionsUnsupported, status)
+		}
+
+		// only a missing endpoint in the catalog config or 405 and 501 fall back to commits one by one
+		status, response = http.StatusNotFound, `{"error":{"message":"no table","type":"NoSuchTableException","code":404}}`
+		err = txs.commit(context.Background(), changes)
+		require.ErrorContains(t, err, "NoSuchTableException")
+		require.NotErrorIs(t, err, errTransactionsUnsupported)
+
+		status, response = http.StatusBadGateway, ``
+		err = txs.commit(context.Background(), changes)
+		require.ErrorIs(t, err, errCommitStateUnknown)
+		require.NotErrorIs(t, err, errTransactionsUnsupported)
+
+		status, response = http.StatusConflict, `{"error":{"message":"requirement failed","type":"CommitFailedException","code":409}}`
+		err = txs.commit(context.Background(), changes)
+		require.ErrorContains(t, err, "CommitFailedException")
+		require.NotErrorIs(t, err, errTransactionsUnsupported)
+	})
+}
+
+func TestCommitChangesStateUnknown(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	writeUsers(t, dst, 0, 1, 2)
+	cat, tbl := usersTable(t, dst)
+	change, err := newSnapshotUpdate(cat, tbl, nil).overwriteAll().stage()
+	require.NoError(t, err)
+
+	// the catalog applies the transaction or not, and fails to respond either way
+	var apply bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/config" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		if apply {
+			_, err := change.commit(ctx, cat)
+			require.NoError(t, err)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	txs, err := newRESTTransactions(ctx, srv.URL, nil)
+	require.NoError(t, err)
+
+	tables, committed, err := commitChanges(ctx, cat, txs, []*tableChange{change}, dst.Properties)
+	require.ErrorIs(t, err, errCommitStateUnknown)
+	require.Zero(t, committed)
+	require.Nil(t, tables)
+
+	apply = true
+	tables, committed, err = commitChanges(ctx, cat, txs, []*tableChange{change}, dst.Properties)
+	require.NoError(t, err)
+	require.Equal(t, 1, committed)
+	require.Equal(t, change.snapshotID, tables[0].CurrentSnapshot().SnapshotID)
+}
+
+func TestCommitChangesOneByOne(t *testing.T) {
+	ctx := context.Background()
+	dst := localDestination(t)
+	writeUsers(t, dst, 0, 1, 2)
+	cat, tbl := usersTable(t, dst)
+	change := func(key string, requirements ...table.Requirement) *tableChange {
+		return &tableChange{
+			tbl:          tbl,
+			requirements: requirements,
+			updates:      []table.Update{table.NewSetPropertiesUpdate(iceberg.Properties{key: "v"})},
+		}
+	}
+
+	// main already has a snapshot, so the second change fails after the first one is applied
+	tables, committed, err := commitChanges(ctx, cat, nil, []*tableChange{
+		change("first"),
+		change("second", table.AssertRefSnapshotID(table.MainBranch, nil)),
+		change("third"),
+	}, dst.Properties)
+	require.ErrorContains(t, err, "1 of 3 tables committed")
+	require.Equal(t, 1, committed)
+	require.Len(t, tables, 1)
+	require.Equal(t, "v", tables[0].Properties()["first"])
+
+	tables, committed, err = commitChanges(ctx, cat, nil, []*tableChange{change("fourth")}, dst.Properties)
+	require.NoError(t, err)
+	require.Equal(t, 1, committed)
+	require.Len(t, tables, 1)
+}
@@ -0,0 +1,224 @@
+package iceberg
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	"github.com/apache/iceberg-go/catalog"
+	iceio "github.com/apache/iceberg-go/io"
+	"github.com/apache/iceberg-go/table"
+	"github.com/apache/iceberg-go/utils"
+
+	"github.com/transferia/transferia/library/go/core/xerrors"
+)
+
+const (
+	// restVendedCredentialsKey makes table files be accessed with credentials vended by the REST catalog
+	restVendedCredentialsKey = "rest.vended-credentials"
+
+	accessDelegationHeader = "X-Iceberg-Access-Delegation"
+	// vendedCredentialsMargin is how long before their expiration credentials are loaded again
+	vendedCredentialsMargin      = 5 * time.Minute
+	vendedCredentialsLoadTimeout = time.Minute
+)
+
+var _ iceio.WriteFileIO = (*vendedIO)(nil)
+
+// vendedCredentialsProps enables vended credentials in catalog properties.
+func vendedCredentialsProps(props iceberg.Properties, enabled bool) iceberg.Properties {
+	if !enabled {
+		return props
+	}
+	result := iceberg.Properties{}
+	maps.Copy(result, props)
+	result[restVendedCredentialsKey] = "true"
+	return result
+}
+
+// loadCredentials loads the storage credentials the catalog vends for the table: the table config,
+// overridden by the storage credential with the longest prefix of the table location.
+func (c *restClient) loadCredentials(ctx context.Context, ident table.Identifier) (iceberg.Properties, error) {
+	route := c.baseURI.JoinPath("namespaces", strings.Join(catalog.NamespaceFromIdent(ident), "\x1f"), "tables", catalog.TableNameFromIdent(ident))
+	route.RawQuery = url.Values{"snapshots": {"refs"}}.Encode()
+	req, err := c.newRequest(ctx, http.MethodGet, route, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(accessDelegationHeader, "vended-credentials")
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("load table %v: %w", ident, err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode == http.StatusNotFound {
+		return nil, xerrors.Errorf("load table %v: %w", ident, catalog.ErrNoSuchTable)
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("load table %v: %w", ident, restError(rsp))
+	}
+	var result struct {
+		Metadata struct {
+			Location string `json:"location"`
+		} `json:"metadata"`
+		Config             iceberg.Properties `json:"config"`
+		StorageCredentials []struct {
+			Prefix string             `json:"prefix"`
+			Config iceberg.Properties `json:"config"`
+		} `json:"storage-credentials"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&result); err != nil {
+		return nil, xerrors.Errorf("decode table %v: %w", ident, err)
+	}
+
+	props := iceberg.Properties{}
+	maps.Copy(props, result.Config)
+	best := -1
+	for i, credential := range result.StorageCredentials {
+		if strings.HasPrefix(result.Metadata.Location, credential.Prefix) &&
+			(best < 0 || len(credential.Prefix) > len(result.StorageCredentials[best].Prefix)) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		maps.Copy(props, result.StorageCredentials[best].Config)
+	}
+	return props, nil
+}
+
+// credentialsExpireAt is the earliest expiration of vended credentials, zero when they do not expire.
+// Catalogs tell it in "<scheme>.*expires-at-ms" properties, such as s3.session-token-expires-at-ms.
+func credentialsExpireAt(props iceberg.Properties) time.Time {
+	var earliest time.Time
+	for key, value := range props {
+		if !strings.Contains(key, "expires-at") {
+			continue
+		}
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if at := time.UnixMilli(ms); earliest.IsZero() || at.Before(earliest) {
+			earliest = at
+		}
+	}
+	return earliest
+}
+
+// vendedIO is the FileIO of a table accessed with credentials vended by the REST catalog. Credentials are
+// loaded on first use and again shortly before they expire, so long streaming runs keep reading and writing.
+type vendedIO struct {
+	ident    table.Identifier
+	location string
+	client   *restClient
+	props    iceberg.Properties // catalog properties vended ones are added to
+
+	mu        sync.Mutex
+	fs        iceio.IO
+	refreshAt time.Time
+	expireAt  time.Time
+}
+
+func newVendedIO(tbl *table.Table, client *restClient, props iceberg.Properties) *vendedIO {
+	return &vendedIO{ident: tbl.Identifier(), location: tbl.Location(), client: client, props: props}
+}
+
+func (v *vendedIO) current() (iceio.IO, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now()
+	if v.fs != nil && (v.refreshAt.IsZero() || now.Before(v.refreshAt)) {
+		return v.fs, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vendedCredentialsLoadTimeout)
+	defer cancel()
+	fs, expireAt, err := v.load(ctx)
+	if err != nil {
+		// credentials are refreshed ahead of time, the current ones serve until they expire
+		if v.fs != nil && now.Before(v.expireAt) {
+			return v.fs, nil
+		}
+		return nil, xerrors.Errorf("vended credentials of %v: %w", v.ident, err)
+	}
+	v.fs, v.expireAt, v.refreshAt = fs, expireAt, time.Time{}
+	if !expireAt.IsZero() {
+		v.refreshAt = expireAt.Add(-min(vendedCredentialsMargin, expireAt.Sub(now)/2))
+	}
+	return fs, nil
+}
+
+func (v *vendedIO) load(ctx context.Context) (iceio.IO, time.Time, error) {
+	vended, err := v.client.loadCredentials(ctx, v.ident)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	props := iceberg.Properties{}
+	maps.Copy(props, v.props)
+	maps.Copy(props, vended)
+	awsConfig, err := s3AWSConfig(ctx, props)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	// the FileIO keeps the context for its requests, it must outlive this load
+	fsCtx := context.Background()
+	if awsConfig != nil {
+		fsCtx = utils.WithAwsConfig(fsCtx, awsConfig)
+	}
+	fs, err := loadFS(fsCtx, props, v.location)
+	if err != nil {
+		return nil, time.Time{}, xerrors.Errorf("load FileIO: %w", err)
+	}
+	return fs, credentialsExpireAt(vended), nil
+}
+
+func (v *vendedIO) Open(name string) (iceio.File, error) {
+	fs, err := v.current()
+	if err != nil {
+		return nil, err
+	}
+	return fs.Open(name)
+}
+
+func (v *vendedIO) Remove(name string) error {
+	fs, err := v.current()
+	if err != nil {
+		return err
+	}
+	return fs.Remove(name)
+}
+
+func (v *vendedIO) Create(name string) (iceio.FileWriter, error) {
+	fs, err := v.writer()
+	if err != nil {
+		return nil, err
+	}
+	return fs.Create(name)
+}
+
+func (v *vendedIO) WriteFile(name string, p []byte) error {
+	fs, err := v.writer()
+	if err != nil {
+		return err
+	}
+	return fs.WriteFile(name, p)
+}
+
+func (v *vendedIO) writer() (iceio.WriteFileIO, error) {
+	fs, err := v.current()
+	if err != nil {
+		return nil, err
+	}
+	writer, ok := fs.(iceio.WriteFileIO)
+	if !ok {
+		return nil, xerrors.Errorf("%T does not implement io.WriteFileIO", fs)
+	}
+	return writer, nil
+}
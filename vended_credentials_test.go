@@ -0,0 +1,123 @@
+package iceberg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/iceberg-go"
+	iceio "github.com/apache/iceberg-go/io"
+	"github.com/apache/iceberg-go/table"
+	"github.com/stretchr/testify/require"
+)
+
+const vendedTableMetadata = `{
+	"format-version": 2,
+	"table-uuid": "9c12d441-03fe-4693-9a96-a0705ddf69c1",
+	"location": "s3://bucket/db/events",
+	"last-sequence-number": 0,
+	"last-updated-ms": 1602638573590,
+	"last-column-id": 1,
+	"current-schema-id": 0,
+	"schemas": [{"type": "struct", "schema-id": 0, "fields": [{"id": 1, "name": "id", "required": false, "type": "long"}]}],
+	"default-spec-id": 0,
+	"partition-specs": [{"spec-id": 0, "fields": []}],
+	"last-partition-id": 999,
+	"default-sort-order-id": 0,
+	"sort-orders": [{"order-id": 0, "fields": []}],
+	"properties": {}
+}`
+
+var s3AccessKeyRe = regexp.MustCompile(`Credential=([^/]+)/`)
+
+// fakeVendingCatalog vends numbered keys for the events table and serves as S3, recording the keys of writes.
+type fakeVendingCatalog struct {
+	mu         sync.Mutex
+	s3URI      string
+	vended     int
+	failLoads  bool
+	delegation []string
+	writes     []string
+}
+
+func (f *fakeVendingCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.URL.Path == "/v1/config":
+		_, _ = w.Write([]byte(`{"defaults":{},"overrides":{}}`))
+	case r.URL.Path == "/v1/namespaces/db/tables/events":
+		if f.failLoads {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		f.vended++
+		f.delegation = append(f.delegation, r.Header.Get(accessDelegationHeader))
+		_, _ = fmt.Fprintf(w, `{"metadata-location":"s3://bucket/db/events/metadata/00000.metadata.json","metadata":%s,
+			"config":{"s3.access-key-id":"config-%[2]d","s3.secret-access-key":"secret","s3.endpoint":%[3]q,"s3.region":"us-east-1"},
+			"storage-credentials":[
+				{"prefix":"s3://bucket/","config":{"s3.access-key-id":"bucket-%[2]d"}},
+				{"prefix":"s3://bucket/db/events","config":{"s3.access-key-id":"table-%[2]d","s3.session-token-expires-at-ms":"%[4]d"}}
+			]}`, vendedTableMetadata, f.vended, f.s3URI, time.Now().Add(time.Hour).UnixMilli())
+	case r.Method == http.MethodPut:
+		_, _ = io.Copy(io.Discard, r.Body)
+		f.writes = append(f.writes, s3AccessKeyRe.FindStringSubmatch(r.Header.Get("Authorization"))[1])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestVendedCredentials(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeVendingCatalog{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	fake.s3URI = srv.URL
+
+	src := &Source{CatalogType: CatalogTypeREST, CatalogURI: srv.URL, VendedCredentials: true, Properties: iceberg.Properties{
+		iceio.S3AccessKeyID:     "static",
+		iceio.S3SecretAccessKey: "secret",
+	}}
+	require.NoError(t, src.Validate())
+	cat, err := newCatalog(ctx, src.CatalogType, src.CatalogURI, src.catalogProperties())
+	require.NoError(t, err)
+	defer closeCatalog(cat)
+
+	tbl, err := cat.LoadTable(ctx, table.Identifier{"db", "events"}, nil)
+	require.NoError(t, err)
+	write := func() {
+		require.NoError(t, tbl.FS().(iceio.WriteFileIO).WriteFile("s3://bucket/db/events/data/file.parquet", []byte("data")))
+	}
+
+	// the credential of the longest prefix of the table location is used
+	write()
+	write()
+	require.Equal(t, []string{"table-2", "table-2"}, fake.writes)
+	require.Equal(t, "vended-credentials", fake.delegation[len(fake.delegation)-1])
+
+	// credentials are loaded again before they expire
+	vended := tbl.FS().(*vendedIO)
+	require.WithinDuration(t, time.Now().Add(time.Hour-vendedCredentialsMargin), vended.refreshAt, time.Minute)
+	vended.refreshAt = time.Now().Add(-time.Second)
+	write()
+	require.Equal(t, "table-3", fake.writes[2])
+
+	// a failed refresh keeps the credentials while they are valid
+	fake.failLoads = true
+	vended.refreshAt = time.Now().Add(-time.Second)
+	write()
+	require.Equal(t, "table-3", fake.writes[3])
+	vended.expireAt = time.Now().Add(-time.Second)
+	require.ErrorContains(t, tbl.FS().(iceio.WriteFileIO).WriteFile("s3://bucket/db/events/data/file.parquet", nil), "vended credentials of")
+
+	t.Run("other catalogs", func(t *testing.T) {
+		src := &Source{CatalogType: CatalogTypeSQL, CatalogURI: "sqlite:///tmp/catalog.db", VendedCredentials: true}
+		require.ErrorContains(t, src.Validate(), "not supported by the sql catalog")
+	})
+}